@@ -0,0 +1,288 @@
+// Package agent implements an ssh-agent style signing daemon for lumen. The
+// agent holds unlocked seeds in memory for a limited time, and signs
+// transactions on behalf of clients connected to its Unix socket, so that
+// clients never see the seeds.
+//
+// The protocol is one JSON request and one JSON response per connection.
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/stellar/go/keypair"
+)
+
+// readTimeout limits how long a client has to send its request, so idle
+// connections don't tie up the agent.
+var readTimeout = 10 * time.Second
+
+// Request operations.
+const (
+	OpAdd  = "add"
+	OpList = "list"
+	OpLock = "lock"
+	OpSign = "sign"
+)
+
+// Request is sent by clients to the agent.
+type Request struct {
+	Op string `json:"op"`
+
+	// For add
+	Name string `json:"name,omitempty"`
+	Seed string `json:"seed,omitempty"`
+	TTL  int64  `json:"ttl,omitempty"` // seconds, 0 for the agent's default
+
+	// For lock (all keys if empty)
+	Names []string `json:"names,omitempty"`
+
+	// For sign
+	Tx      string   `json:"tx,omitempty"`      // base64-encoded transaction envelope
+	Network string   `json:"network,omitempty"` // microstellar network spec
+	Signers []string `json:"signers,omitempty"` // addresses
+}
+
+// Response is returned by the agent.
+type Response struct {
+	Error string `json:"error,omitempty"`
+	Keys  []Key  `json:"keys,omitempty"`
+	Tx    string `json:"tx,omitempty"`
+}
+
+// Key describes an unlocked key. Seeds never leave the agent.
+type Key struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Expires time.Time `json:"expires"`
+}
+
+type entry struct {
+	Key
+	seed  string
+	timer *time.Timer
+}
+
+// Agent holds unlocked keys and signs transactions with them.
+type Agent struct {
+	mu         *sync.Mutex // protects keys
+	keys       map[string]*entry
+	defaultTTL time.Duration
+}
+
+// TempSocket returns a path for the agent socket in a new directory that only
+// the current user can access, like ssh-agent does. Other users can't create
+// or replace a socket there. The caller removes the directory when it's done.
+func TempSocket() (string, error) {
+	dir, err := ioutil.TempDir("", "lumen-agent-")
+	if err != nil {
+		return "", errors.Wrap(err, "can't create socket directory")
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("agent.%d.sock", os.Getpid())), nil
+}
+
+// New returns an agent that keeps keys for defaultTTL, unless the client
+// asks for a different TTL.
+func New(defaultTTL time.Duration) *Agent {
+	return &Agent{
+		mu:         &sync.Mutex{},
+		keys:       map[string]*entry{},
+		defaultTTL: defaultTTL,
+	}
+}
+
+// Listen creates the Unix socket at path, readable only by the current user.
+// It's only private from the moment it's created if its directory is (see
+// TempSocket.) Stale sockets from dead agents are removed.
+func Listen(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("agent already running at %s", path)
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't listen")
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "can't set socket permissions")
+	}
+
+	return l, nil
+}
+
+// Serve handles connections on l until it's closed.
+func (agent *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go agent.handle(conn)
+	}
+}
+
+func (agent *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	logFields := log.Fields{"type": "agent"}
+
+	if err := checkPeer(conn); err != nil {
+		log.WithFields(logFields).Warnf("rejected connection: %v", err)
+		json.NewEncoder(conn).Encode(&Response{Error: "permission denied"})
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+	req := &Request{}
+	if err := json.NewDecoder(conn).Decode(req); err != nil {
+		log.WithFields(logFields).Debugf("bad request: %v", err)
+		json.NewEncoder(conn).Encode(&Response{Error: "bad request"})
+		return
+	}
+
+	log.WithFields(logFields).Debugf("request: %s", req.Op)
+	resp := agent.Handle(req)
+	if resp.Error != "" {
+		log.WithFields(logFields).Debugf("%s failed: %s", req.Op, resp.Error)
+	}
+
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// Handle processes a single request.
+func (agent *Agent) Handle(req *Request) *Response {
+	var err error
+	resp := &Response{}
+
+	switch req.Op {
+	case OpAdd:
+		err = agent.add(req.Name, req.Seed, time.Duration(req.TTL)*time.Second)
+	case OpList:
+		resp.Keys = agent.list()
+	case OpLock:
+		agent.lock(req.Names)
+	case OpSign:
+		resp.Tx, err = agent.sign(req.Tx, req.Network, req.Signers)
+	default:
+		err = errors.Errorf("unknown op: %s", req.Op)
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	return resp
+}
+
+func (agent *Agent) add(name, seed string, ttl time.Duration) error {
+	if microstellar.ValidSeed(seed) != nil {
+		return errors.Errorf("invalid seed for %s", name)
+	}
+
+	if ttl <= 0 {
+		ttl = agent.defaultTTL
+	}
+
+	kp, err := keypair.Parse(seed)
+	if err != nil {
+		return errors.Wrapf(err, "invalid seed for %s", name)
+	}
+	address := kp.Address()
+
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	if old, ok := agent.keys[address]; ok {
+		old.timer.Stop()
+	}
+
+	e := &entry{
+		Key:  Key{Name: name, Address: address, Expires: time.Now().Add(ttl)},
+		seed: seed,
+	}
+
+	e.timer = time.AfterFunc(ttl, func() {
+		agent.mu.Lock()
+		defer agent.mu.Unlock()
+		if agent.keys[address] == e {
+			delete(agent.keys, address)
+		}
+	})
+
+	agent.keys[address] = e
+	return nil
+}
+
+func (agent *Agent) list() []Key {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	keys := []Key{}
+	for _, e := range agent.keys {
+		keys = append(keys, e.Key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// lock forgets the keys with the given names, or all keys if names is empty.
+func (agent *Agent) lock(names []string) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+
+	remove := map[string]bool{}
+	for _, name := range names {
+		remove[name] = true
+	}
+
+	for address, e := range agent.keys {
+		if len(names) == 0 || remove[e.Name] || remove[address] {
+			e.timer.Stop()
+			delete(agent.keys, address)
+		}
+	}
+}
+
+func (agent *Agent) sign(tx, network string, signers []string) (string, error) {
+	if len(signers) == 0 {
+		return "", errors.Errorf("no signers")
+	}
+
+	agent.mu.Lock()
+	seeds := []string{}
+	for _, address := range signers {
+		e, ok := agent.keys[address]
+		if !ok {
+			agent.mu.Unlock()
+			return "", errors.Errorf("no key for %s, use: lumen agent add", address)
+		}
+		seeds = append(seeds, e.seed)
+	}
+	agent.mu.Unlock()
+
+	signed, err := microstellar.NewFromSpec(network).SignTransaction(tx, seeds...)
+	if err != nil {
+		return "", errors.Wrap(err, "can't sign transaction")
+	}
+
+	return signed, nil
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/0xfe/microstellar"
+	"github.com/stellar/go/build"
+)
+
+const (
+	testSeed    = "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU"
+	testAddress = "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4"
+)
+
+// unsignedTx returns an unsigned payment from source on the test network.
+func unsignedTx(t *testing.T, source string) string {
+	tx, err := build.Transaction(
+		build.SourceAccount{AddressOrSeed: source},
+		build.TestNetwork,
+		build.Sequence{Sequence: 1},
+		build.Payment(build.Destination{AddressOrSeed: testAddress}, build.NativeAmount{Amount: "1"}),
+	)
+	if err != nil {
+		t.Fatalf("can't build transaction: %v", err)
+	}
+
+	var txe build.TransactionEnvelopeBuilder
+	txe.Mutate(tx)
+	b64, err := txe.Base64()
+	if err != nil {
+		t.Fatalf("can't encode transaction: %v", err)
+	}
+
+	return b64
+}
+
+func startTestAgent(t *testing.T) (*Client, func()) {
+	dir, err := ioutil.TempDir("", "lumen-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("can't start agent: %v", err)
+	}
+
+	go New(time.Hour).Serve(l)
+
+	return NewClient(socket), func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAgent_AddListLock(t *testing.T) {
+	client, done := startTestAgent(t)
+	defer done()
+
+	if err := client.Add("mo", "SBADSEED", 0); err == nil {
+		t.Errorf("want error adding bad seed")
+	}
+
+	if err := client.Add("mo", testSeed, 0); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	keys, err := client.List()
+	if err != nil || len(keys) != 1 || keys[0].Address != testAddress || keys[0].Name != "mo" {
+		t.Fatalf("wrong keys: %+v, %v", keys, err)
+	}
+
+	if address, err := client.Lookup("mo"); err != nil || address != testAddress {
+		t.Errorf("lookup failed: %v, %v", address, err)
+	}
+
+	if err := client.Lock(); err != nil {
+		t.Fatalf("lock failed: %v", err)
+	}
+
+	if keys, _ := client.List(); len(keys) != 0 {
+		t.Errorf("keys not locked: %+v", keys)
+	}
+}
+
+func TestAgent_TTL(t *testing.T) {
+	client, done := startTestAgent(t)
+	defer done()
+
+	if err := client.Add("mo", testSeed, time.Second); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if keys, _ := client.List(); len(keys) != 0 {
+		t.Errorf("key not expired: %+v", keys)
+	}
+}
+
+func TestAgent_Sign(t *testing.T) {
+	client, done := startTestAgent(t)
+	defer done()
+
+	tx := unsignedTx(t, testAddress)
+	if _, err := client.Sign(tx, "test", []string{testAddress}); err == nil {
+		t.Errorf("want error signing with locked key")
+	}
+
+	client.Add("mo", testSeed, 0)
+	signed, err := client.Sign(tx, "test", []string{testAddress})
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	want, _ := microstellar.NewFromSpec("test").SignTransaction(tx, testSeed)
+	if signed != want {
+		t.Errorf("wrong signature: want %v, got %v", want, signed)
+	}
+}
+
+func TestAgent_Socket(t *testing.T) {
+	socket, err := TempSocket()
+	if err != nil {
+		t.Fatalf("can't get socket path: %v", err)
+	}
+	defer os.RemoveAll(filepath.Dir(socket))
+
+	if info, err := os.Stat(filepath.Dir(socket)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("socket directory: want mode 0700, got %v, %v", info, err)
+	}
+
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("can't start agent: %v", err)
+	}
+	defer l.Close()
+
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket: want mode 0600, got %v, %v", info, err)
+	}
+
+	if _, err := Listen(socket); err == nil {
+		t.Errorf("want error listening on a running agent's socket")
+	}
+}
+
+func TestAgent_ReadTimeout(t *testing.T) {
+	old := readTimeout
+	readTimeout = 50 * time.Millisecond
+	defer func() { readTimeout = old }()
+
+	client, done := startTestAgent(t)
+	defer done()
+
+	// A client that never sends its request is dropped.
+	conn, err := net.Dial("unix", client.Socket())
+	if err != nil {
+		t.Fatalf("can't connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	resp := &Response{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil || resp.Error != "bad request" {
+		t.Errorf("idle connection: want bad request, got %+v, %v", resp, err)
+	}
+}
+
+func TestAgent_CheckPeer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only checked on linux")
+	}
+
+	client, done := startTestAgent(t)
+	defer done()
+
+	if _, err := client.List(); err != nil {
+		t.Errorf("connection from the same user: got %v", err)
+	}
+
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	if err := checkPeer(conn); err == nil {
+		t.Errorf("want error checking a connection that isn't a unix socket")
+	}
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Client talks to an agent over its Unix socket.
+type Client struct {
+	socket string
+}
+
+// NewClient returns a client for the agent listening on socket.
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// Socket returns the path of the agent socket.
+func (client *Client) Socket() string {
+	return client.socket
+}
+
+func (client *Client) call(req *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", client.socket, 5*time.Second)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't reach agent at %s", client.socket)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, errors.Wrap(err, "can't send request to agent")
+	}
+
+	resp := &Response{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, errors.Wrap(err, "bad response from agent")
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// Add unlocks seed in the agent for ttl (or the agent's default if 0.)
+func (client *Client) Add(name, seed string, ttl time.Duration) error {
+	_, err := client.call(&Request{Op: OpAdd, Name: name, Seed: seed, TTL: int64(ttl / time.Second)})
+	return err
+}
+
+// List returns the keys unlocked in the agent.
+func (client *Client) List() ([]Key, error) {
+	resp, err := client.call(&Request{Op: OpList})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Keys, nil
+}
+
+// Lookup returns the address of the unlocked key called name.
+func (client *Client) Lookup(name string) (string, error) {
+	keys, err := client.List()
+	if err != nil {
+		return "", err
+	}
+
+	for _, key := range keys {
+		if key.Name == name {
+			return key.Address, nil
+		}
+	}
+
+	return "", errors.Errorf("no key named %s in agent", name)
+}
+
+// Lock removes the named keys (or addresses) from the agent, or all keys if
+// names is empty.
+func (client *Client) Lock(names ...string) error {
+	_, err := client.call(&Request{Op: OpLock, Names: names})
+	return err
+}
+
+// Sign signs the base64-encoded transaction tx on network (a microstellar
+// network spec) with the keys for addresses.
+func (client *Client) Sign(tx, network string, addresses []string) (string, error) {
+	resp, err := client.call(&Request{Op: OpSign, Tx: tx, Network: network, Signers: addresses})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Tx, nil
+}
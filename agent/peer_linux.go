@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package agent
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// checkPeer returns an error unless conn is a Unix socket connection from a
+// process running as the same user as the agent, using SO_PEERCRED.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.Errorf("not a unix socket connection")
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return errors.Wrap(err, "can't get peer credentials")
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+
+	if err == nil {
+		err = credErr
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "can't get peer credentials")
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return errors.Errorf("peer uid %d is not %d", cred.Uid, os.Getuid())
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package agent
+
+import "net"
+
+// checkPeer accepts every connection. Without SO_PEERCRED, the agent relies
+// on the permissions of the socket and its directory.
+func checkPeer(conn net.Conn) error {
+	return nil
+}
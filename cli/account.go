@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 
 	"github.com/sirupsen/logrus"
@@ -12,12 +13,12 @@ import (
 
 func (cli *CLI) buildAccountCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "account [new|set|address|seed|del]",
+		Use:   "account [new|set|address|seed|del|list]",
 		Short: "manage stellar keypairs and accounts",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				showError(logrus.Fields{"cmd": "accounts"}, "unrecognized account command: %s, expecting: new|set|address|seed|del", args[0])
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "accounts"}, "unrecognized account command: %s, expecting: new|set|address|seed|del|list", args[0])
 				return
 			}
 		},
@@ -28,43 +29,58 @@ func (cli *CLI) buildAccountCmd() *cobra.Command {
 	cmd.AddCommand(cli.buildAccountDelCmd())
 	cmd.AddCommand(cli.buildAccountAddressCmd())
 	cmd.AddCommand(cli.buildAccountSeedCmd())
+	cmd.AddCommand(cli.buildAccountListCmd())
 
 	return cmd
 }
 
+// keyResult is the output of "account new", "address", "seed", and "del"
+type keyResult struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address,omitempty"`
+	Seed    string `json:"seed,omitempty"`
+}
+
 func (cli *CLI) buildAccountNewCmd() *cobra.Command {
 	accountNewCmd := &cobra.Command{
 		Use:   "new [name]",
 		Short: "create a new random keypair named [name]",
 		Args:  cobra.MinimumNArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "account", "subcmd": "new"}
 			pair, err := cli.ms.CreateKeyPair()
-			showSuccess("%s %s", pair.Address, pair.Seed)
 
-			if len(args) == 0 {
+			if err != nil {
+				cli.error(logFields, "could not create keypair: %v", err)
 				return
 			}
 
-			name := args[0]
+			result := keyResult{Address: pair.Address, Seed: pair.Seed}
+			show := func() { cli.showSuccess("%s %s", pair.Address, pair.Seed) }
 
-			if err != nil {
-				showError(logrus.Fields{"cmd": "account", "subcmd": "new"}, "could not create keypair: %s", name)
+			if len(args) == 0 {
+				cli.showResult(logFields, result, show)
 				return
 			}
 
+			name := args[0]
+			result.Name = name
+
 			err = cli.SetVar(fmt.Sprintf("account:%s:address", name), pair.Address)
 
 			if err != nil {
-				showError(logrus.Fields{"cmd": "account", "subcmd": "new"}, "could not save keypair: %s", name)
+				cli.errorKind(ErrStore, logFields, "could not save keypair: %s", name)
 				return
 			}
 
 			err = cli.SetVar(fmt.Sprintf("account:%s:seed", name), pair.Seed)
 
 			if err != nil {
-				showError(logrus.Fields{"cmd": "account", "subcmd": "new"}, "could not save keypair: %s", name)
+				cli.errorKind(ErrStore, logFields, "could not save keypair: %s", name)
 				return
 			}
+
+			cli.showResult(logFields, result, show)
 		},
 	}
 
@@ -74,8 +90,8 @@ func (cli *CLI) buildAccountNewCmd() *cobra.Command {
 
 func (cli *CLI) buildAccountSetCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "set [name] [address|seed]...",
-		Short: "set address or seed of [name]",
+		Use:   "set [name] [address|seed|env:VAR|exec:COMMAND]...",
+		Short: "set address or seed (or seed reference) of [name]",
 		Args:  cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
@@ -91,20 +107,22 @@ func (cli *CLI) buildAccountSetCmd() *cobra.Command {
 				key := fmt.Sprintf("account:%s:", name)
 				if microstellar.ValidAddress(code) == nil || strings.Contains(code, "*") {
 					keyType = "address"
-				} else if microstellar.ValidSeed(code) == nil {
+				} else if microstellar.ValidSeed(code) == nil || client.IsSecretRef(code) {
 					keyType = "seed"
 				} else {
-					logrus.WithFields(logrus.Fields{"cmd": "account", "subcmd": "sed"}).Errorf("skipping invalid seed or address: %v", code)
+					cli.logger.WithFields(logrus.Fields{"cmd": "account", "subcmd": "sed"}).Errorf("skipping invalid seed or address: %v", code)
 					continue
 				}
 
 				err := cli.SetVar(key+keyType, code)
 
 				if err != nil {
-					cli.error(logrus.Fields{"cmd": "account", "subcmd": "set"}, "could not save account: %s", name)
+					cli.errorKind(ErrStore, logrus.Fields{"cmd": "account", "subcmd": "set"}, "could not save account: %s", name)
 					return
 				}
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "account", "subcmd": "set"}, cli.getAccountEntry(name), nil)
 		},
 	}
 }
@@ -119,11 +137,13 @@ func (cli *CLI) buildAccountAddressCmd() *cobra.Command {
 			code, err := cli.ResolveAccount(logrus.Fields{"cmd": "account", "subcmd": "address"}, name, "address")
 
 			if err != nil || microstellar.ValidSeed(code) == nil {
-				cli.error(logrus.Fields{"cmd": "account", "subcmd": "address"}, "could not get address for account: %s", name)
+				cli.errorKind(ErrResolution, logrus.Fields{"cmd": "account", "subcmd": "address"}, "could not get address for account: %s", name)
 				return
 			}
 
-			showSuccess(code)
+			cli.showResult(logrus.Fields{"cmd": "account", "subcmd": "address"}, keyResult{Name: name, Address: code}, func() {
+				cli.showSuccess("%s", code)
+			})
 		},
 	}
 }
@@ -135,16 +155,16 @@ func (cli *CLI) buildAccountSeedCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			key := fmt.Sprintf("account:%s:seed", name)
-
-			code, err := cli.GetVar(key)
+			code, err := cli.GetAccount(name, "seed")
 
 			if err != nil {
-				cli.error(logrus.Fields{"cmd": "account", "subcmd": "seed"}, "could not get seed for account: %s", name)
+				cli.errorKind(ErrResolution, logrus.Fields{"cmd": "account", "subcmd": "seed"}, "could not get seed for account: %s", name)
 				return
 			}
 
-			showSuccess(code)
+			cli.showResult(logrus.Fields{"cmd": "account", "subcmd": "seed"}, keyResult{Name: name, Seed: code}, func() {
+				cli.showSuccess("%s", code)
+			})
 		},
 	}
 }
@@ -161,9 +181,73 @@ func (cli *CLI) buildAccountDelCmd() *cobra.Command {
 			err = cli.DelVar(fmt.Sprintf("account:%s:address", name))
 
 			if err != nil {
-				cli.error(logrus.Fields{"cmd": "account", "subcmd": "del"}, "could not delete account: %s", name)
+				cli.errorKind(ErrStore, logrus.Fields{"cmd": "account", "subcmd": "del"}, "could not delete account: %s", name)
 				return
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "account", "subcmd": "del"}, keyResult{Name: name}, nil)
 		},
 	}
 }
+
+// accountEntry is a row in the output of "account list", and the output of
+// "account set"
+type accountEntry struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	HasSeed bool   `json:"has_seed"`
+}
+
+func (cli *CLI) getAccountEntry(name string) accountEntry {
+	address, _ := cli.GetVar(fmt.Sprintf("account:%s:address", name))
+	seedKeys, _ := cli.ListVars(fmt.Sprintf("account:%s:seed", name))
+	return accountEntry{
+		Name:    name,
+		Address: address,
+		HasSeed: len(seedKeys) > 0,
+	}
+}
+
+func (cli *CLI) buildAccountListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list all accounts in the namespace",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "account", "subcmd": "list"}
+
+			names, err := cli.listAliases("account")
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not list accounts: %v", err)
+				return
+			}
+
+			entries := []accountEntry{}
+			for _, name := range names {
+				entries = append(entries, cli.getAccountEntry(name))
+			}
+
+			cli.showResult(logFields, entries, func() {
+				rows := [][]string{}
+				for _, entry := range entries {
+					address := entry.Address
+					if address == "" {
+						address = "-"
+					}
+
+					seed := "no"
+					if entry.HasSeed {
+						seed = "yes"
+					}
+
+					rows = append(rows, []string{entry.Name, address, seed})
+				}
+
+				cli.showTable([]string{"NAME", "ADDRESS", "SEED"}, rows)
+			})
+		},
+	}
+
+	addFormatAlias(cmd)
+	return cmd
+}
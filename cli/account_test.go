@@ -1,6 +1,9 @@
 package cli
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // Note: add -v to any of these commands to enable verbose logging
 
@@ -22,8 +25,20 @@ func TestAccounts(t *testing.T) {
 		t.Error("not a seed: ", result)
 	}
 
+	cli.TestCommand("account set watcher GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	result = cli.TestCommand("account list --format json")
+	if !strings.Contains(result, `"name": "watcher"`) || !strings.Contains(result, `"has_seed": false`) {
+		t.Error("watcher missing from account list: ", result)
+	}
+
+	lines := strings.Split(strings.TrimSpace(cli.TestCommand("account list")), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "master") || !strings.HasSuffix(lines[1], "yes") {
+		t.Error("bad account list: ", lines)
+	}
+
 	cli.TestCommand("ns other")
 	expectOutput(t, cli, "error", "account address master")
+	expectOutput(t, cli, "NAME  ADDRESS  SEED", "account list")
 
 	cli.TestCommand("ns test")
 	cli.TestCommand("account del master")
@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/0xfe/lumen/agent"
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// setupAgent connects to the signing agent if LUMEN_AGENT_SOCK is set.
+func (cli *CLI) setupAgent() {
+	cli.agent = nil
+
+	if socket := os.Getenv("LUMEN_AGENT_SOCK"); socket != "" {
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using signing agent at %s", socket)
+		cli.agent = agent.NewClient(socket)
+	}
+}
+
+func (cli *CLI) agentClient() (*agent.Client, error) {
+	if cli.agent == nil {
+		return nil, errors.Errorf("no agent: set LUMEN_AGENT_SOCK (see: lumen agent start)")
+	}
+
+	return cli.agent, nil
+}
+
+func (cli *CLI) buildAgentCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent [start|add|list|lock]",
+		Short: "manage the signing agent",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "agent"}, "unrecognized agent command: %s, expecting: start|add|list|lock", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(cli.buildAgentStartCmd())
+	cmd.AddCommand(cli.buildAgentAddCmd())
+	cmd.AddCommand(cli.buildAgentListCmd())
+	cmd.AddCommand(cli.buildAgentLockCmd())
+
+	return cmd
+}
+
+// agentResult is the output of "agent start", "add", and "lock"
+type agentResult struct {
+	Socket string   `json:"socket,omitempty"`
+	Names  []string `json:"names,omitempty"`
+}
+
+func (cli *CLI) buildAgentStartCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "start [--socket path] [--ttl duration]",
+		Short: "run the signing agent in the foreground",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "agent", "subcmd": "start"}
+
+			ttl, _ := cmd.Flags().GetDuration("ttl")
+			if ttl <= 0 {
+				cli.errorKind(ErrUsage, logFields, "bad --ttl: %v", ttl)
+				return
+			}
+
+			socket, _ := cmd.Flags().GetString("socket")
+			if socket == "" {
+				var err error
+				if socket, err = agent.TempSocket(); err != nil {
+					cli.error(logFields, "can't start agent: %v", err)
+					return
+				}
+				defer os.RemoveAll(filepath.Dir(socket))
+			}
+
+			l, err := agent.Listen(socket)
+			if err != nil {
+				cli.error(logFields, "can't start agent: %v", err)
+				return
+			}
+			defer os.Remove(socket)
+
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+			go func() {
+				select {
+				case <-sigs:
+				case <-cli.ctx.Done():
+				}
+				l.Close()
+			}()
+
+			cli.showResult(logFields, agentResult{Socket: socket}, func() {
+				cli.showSuccess("LUMEN_AGENT_SOCK=%s; export LUMEN_AGENT_SOCK;", socket)
+			})
+			agent.New(ttl).Serve(l)
+		},
+	}
+
+	cmd.Flags().String("socket", "", "listen on this Unix socket (default: in a new private temp directory)")
+	cmd.Flags().Duration("ttl", 15*time.Minute, "default time to keep keys unlocked")
+	return cmd
+}
+
+func (cli *CLI) buildAgentAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add [name]... [--ttl duration]",
+		Short: "unlock the seeds of accounts [name]... in the agent",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "agent", "subcmd": "add"}
+
+			client, err := cli.agentClient()
+			if err != nil {
+				cli.error(logFields, "%v", err)
+				return
+			}
+
+			ttl, _ := cmd.Flags().GetDuration("ttl")
+			for _, name := range args {
+				seed, err := cli.GetAccount(name, "seed")
+				if err != nil || microstellar.ValidSeed(seed) != nil {
+					cli.errorKind(ErrResolution, logFields, "could not get seed for account: %s", name)
+					return
+				}
+
+				if err := client.Add(name, seed, ttl); err != nil {
+					cli.error(logFields, "could not add %s to agent: %v", name, err)
+					return
+				}
+			}
+
+			cli.showResult(logFields, agentResult{Names: args}, func() {
+				for _, name := range args {
+					cli.showSuccess("added %s", name)
+				}
+			})
+		},
+	}
+
+	cmd.Flags().Duration("ttl", 0, "time to keep the keys unlocked (default: the agent's --ttl)")
+	return cmd
+}
+
+func (cli *CLI) buildAgentListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the keys unlocked in the agent",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "agent", "subcmd": "list"}
+
+			client, err := cli.agentClient()
+			if err != nil {
+				cli.error(logFields, "%v", err)
+				return
+			}
+
+			keys, err := client.List()
+			if err != nil {
+				cli.error(logFields, "could not list keys: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, keys, func() {
+				rows := [][]string{}
+				for _, key := range keys {
+					rows = append(rows, []string{key.Name, key.Address, key.Expires.Local().Format("2006-01-02 15:04:05")})
+				}
+
+				cli.showTable([]string{"NAME", "ADDRESS", "EXPIRES"}, rows)
+			})
+		},
+	}
+
+	addFormatAlias(cmd)
+	return cmd
+}
+
+func (cli *CLI) buildAgentLockCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lock [name]...",
+		Short: "remove keys [name]... (or all keys) from the agent",
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "agent", "subcmd": "lock"}
+
+			client, err := cli.agentClient()
+			if err != nil {
+				cli.error(logFields, "%v", err)
+				return
+			}
+
+			if err := client.Lock(args...); err != nil {
+				cli.error(logFields, "could not lock agent: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, agentResult{Names: args}, func() {
+				cli.showSuccess("locked")
+			})
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xfe/lumen/agent"
+	"github.com/stellar/go/build"
+)
+
+func TestAgentSign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumen-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "agent.sock")
+	l, err := agent.Listen(socket)
+	if err != nil {
+		t.Fatalf("can't start agent: %v", err)
+	}
+	defer l.Close()
+	go agent.New(time.Hour).Serve(l)
+
+	os.Setenv("LUMEN_AGENT_SOCK", socket)
+	defer os.Unsetenv("LUMEN_AGENT_SOCK")
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set kelly SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+
+	tx, _ := build.Transaction(
+		build.SourceAccount{AddressOrSeed: "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4"},
+		build.TestNetwork,
+		build.Sequence{Sequence: 1},
+		build.Payment(build.Destination{AddressOrSeed: "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM"}, build.NativeAmount{Amount: "1"}),
+	)
+	var txe build.TransactionEnvelopeBuilder
+	txe.Mutate(tx)
+	b64tx, _ := txe.Base64()
+
+	expectOutput(t, cli, "error", "tx sign "+b64tx+" --signers kelly")
+	expectOutput(t, cli, "added kelly", "agent add kelly")
+
+	if got := cli.TestCommand("agent list"); !strings.Contains(got, "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4") {
+		t.Errorf("agent list: want kelly's address, got %v", got)
+	}
+
+	// The agent's signature must match a local one
+	os.Unsetenv("LUMEN_AGENT_SOCK")
+	want := cli.TestCommand("tx sign " + b64tx + " --signers kelly")
+	os.Setenv("LUMEN_AGENT_SOCK", socket)
+
+	expectOutput(t, cli, strings.TrimSpace(want), "tx sign "+b64tx+" --signers kelly")
+
+	expectOutput(t, cli, "locked", "agent lock")
+	expectOutput(t, cli, "error", "tx sign "+b64tx+" --signers kelly")
+}
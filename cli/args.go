@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// SplitCommand splits a command line into arguments like a POSIX shell, so
+// that arguments can contain spaces, e.g.:
+//
+//	pay 5 --from bob --to mary --memotext 'thanks for the fish'
+//
+// Single quotes preserve everything up to the closing quote. In double
+// quotes, a backslash escapes ", \, $, and `. Elsewhere, a backslash escapes
+// the next character. Variables and globs are not expanded.
+func SplitCommand(command string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg := false // needed for empty quoted arguments, e.g., ''
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+				i++
+				arg.WriteRune(runes[i])
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, errors.Errorf("trailing backslash in command: %s", command)
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c quote in command: %s", quote, command)
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
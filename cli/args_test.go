@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"", []string{}},
+		{"  ns   test ", []string{"ns", "test"}},
+		{"pay 5 --memotext 'thanks for the fish'", []string{"pay", "5", "--memotext", "thanks for the fish"}},
+		{`set greeting "say \"hi\" to \\ $HOME"`, []string{"set", "greeting", `say "hi" to \ $HOME`}},
+		{`set path a\ b`, []string{"set", "path", "a b"}},
+		{`set empty ''`, []string{"set", "empty", ""}},
+		{`set mixed ab'c d'"e"`, []string{"set", "mixed", "abc de"}},
+		{`set single 'no \escapes'`, []string{"set", "single", `no \escapes`}},
+	}
+
+	for _, test := range tests {
+		got, err := SplitCommand(test.command)
+		if err != nil {
+			t.Errorf("SplitCommand(%q): %v", test.command, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SplitCommand(%q): want %q, got %q", test.command, test.want, got)
+		}
+	}
+
+	for _, command := range []string{"set foo 'bar", `set foo "bar`, `set foo bar\`} {
+		if _, err := SplitCommand(command); err == nil {
+			t.Errorf("SplitCommand(%q): want error", command)
+		}
+	}
+}
@@ -11,12 +11,12 @@ import (
 
 func (cli *CLI) buildAssetCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "asset [set|del|code|issuer|type]",
+		Use:   "asset [set|del|code|issuer|type|list]",
 		Short: "manage stellar assets",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				cli.error(logrus.Fields{"cmd": "asset"}, "unrecognized asset command: %s, expecting: set|del|code|issuer|type", args[0])
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "asset"}, "unrecognized asset command: %s, expecting: set|del|code|issuer|type|list", args[0])
 				return
 			}
 		},
@@ -27,6 +27,7 @@ func (cli *CLI) buildAssetCmd() *cobra.Command {
 	cmd.AddCommand(cli.buildAssetIssuerCmd())
 	cmd.AddCommand(cli.buildAssetTypeCmd())
 	cmd.AddCommand(cli.buildAssetDelCmd())
+	cmd.AddCommand(cli.buildAssetListCmd())
 
 	return cmd
 }
@@ -52,7 +53,8 @@ func (cli *CLI) buildAssetSetCmd() *cobra.Command {
 						var err error
 						value, err = cli.GetAccount(issuer, "address")
 						if err != nil {
-							cli.error(logrus.Fields{"cmd": "asset", "subcmd": "set"}, "invalid issuer: %s", issuer)
+							cli.errorKind(ErrResolution, logrus.Fields{"cmd": "asset", "subcmd": "set"}, "invalid issuer: %s", issuer)
+							return
 						}
 					}
 				}
@@ -75,7 +77,7 @@ func (cli *CLI) buildAssetSetCmd() *cobra.Command {
 							string(microstellar.NativeType):
 							break
 						default:
-							cli.error(logrus.Fields{"cmd": "asset", "subcmd": "set"}, "bad asset type: %s", assetType)
+							cli.errorKind(ErrUsage, logrus.Fields{"cmd": "asset", "subcmd": "set"}, "bad asset type: %s", assetType)
 							return
 						}
 					} else {
@@ -89,15 +91,17 @@ func (cli *CLI) buildAssetSetCmd() *cobra.Command {
 					value = assetType
 				}
 
-				logrus.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "set"}).Debugf("saving asset %s: %s %s", name, part, value)
+				cli.logger.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "set"}).Debugf("saving asset %s: %s %s", name, part, value)
 				err := cli.SetVar(key, value)
 
 				if err != nil {
-					logrus.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "set"}).Debugf("%v", err)
-					cli.error(logrus.Fields{"cmd": "asset", "subcmd": "set"}, "could not save asset: %s", name)
+					cli.logger.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "set"}).Debugf("%v", err)
+					cli.errorKind(ErrStore, logrus.Fields{"cmd": "asset", "subcmd": "set"}, "could not save asset: %s", name)
 					return
 				}
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "asset", "subcmd": "set"}, cli.getAssetEntry(name, nil), nil)
 		},
 	}
 
@@ -115,11 +119,13 @@ func (cli *CLI) buildAssetCodeCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
 			if asset, err := cli.ResolveAsset(name); err != nil {
-				logrus.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "code"}).Debugf("%v", err)
-				cli.error(logrus.Fields{"cmd": "asset", "subcmd": "code"}, "could not load asset: %s", name)
+				cli.logger.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "code"}).Debugf("%v", err)
+				cli.errorKind(ErrResolution, logrus.Fields{"cmd": "asset", "subcmd": "code"}, "could not load asset: %s", name)
 				return
 			} else {
-				showSuccess(asset.Code)
+				cli.showResult(logrus.Fields{"cmd": "asset", "subcmd": "code"}, newAssetEntry(name, asset), func() {
+					cli.showSuccess("%s", asset.Code)
+				})
 			}
 		},
 	}
@@ -135,11 +141,13 @@ func (cli *CLI) buildAssetIssuerCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
 			if asset, err := cli.ResolveAsset(name); err != nil {
-				logrus.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "issuer"}).Debugf("%v", err)
-				cli.error(logrus.Fields{"cmd": "asset", "subcmd": "issuer"}, "could not load asset: %s", name)
+				cli.logger.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "issuer"}).Debugf("%v", err)
+				cli.errorKind(ErrResolution, logrus.Fields{"cmd": "asset", "subcmd": "issuer"}, "could not load asset: %s", name)
 				return
 			} else {
-				showSuccess(asset.Issuer)
+				cli.showResult(logrus.Fields{"cmd": "asset", "subcmd": "issuer"}, newAssetEntry(name, asset), func() {
+					cli.showSuccess("%s", asset.Issuer)
+				})
 			}
 		},
 	}
@@ -155,17 +163,14 @@ func (cli *CLI) buildAssetTypeCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
 			if asset, err := cli.ResolveAsset(name); err != nil {
-				logrus.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "type"}).Debugf("%v", err)
-				cli.error(logrus.Fields{"cmd": "asset", "subcmd": "type"}, "could not load asset: %s", name)
+				cli.logger.WithFields(logrus.Fields{"cmd": "asset", "subcmd": "type"}).Debugf("%v", err)
+				cli.errorKind(ErrResolution, logrus.Fields{"cmd": "asset", "subcmd": "type"}, "could not load asset: %s", name)
 				return
 			} else {
-				assetType := microstellar.NativeType
-				if asset.Type == microstellar.Credit4Type {
-					assetType = microstellar.Credit4Type
-				} else if asset.Type == microstellar.Credit12Type {
-					assetType = microstellar.Credit12Type
-				}
-				showSuccess(string(assetType))
+				entry := newAssetEntry(name, asset)
+				cli.showResult(logrus.Fields{"cmd": "asset", "subcmd": "type"}, entry, func() {
+					cli.showSuccess("%s", entry.Type)
+				})
 			}
 		},
 	}
@@ -184,8 +189,91 @@ func (cli *CLI) buildAssetDelCmd() *cobra.Command {
 				key := fmt.Sprintf("asset:%s:%s", name, part)
 				cli.DelVar(key)
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "asset", "subcmd": "del"}, assetEntry{Name: name}, nil)
+		},
+	}
+
+	return cmd
+}
+
+// assetEntry is a row in the output of "asset list", and the output of the
+// other asset commands
+type assetEntry struct {
+	Name        string `json:"name"`
+	Code        string `json:"code"`
+	Issuer      string `json:"issuer"`
+	IssuerAlias string `json:"issuer_alias,omitempty"`
+	Type        string `json:"type"`
+}
+
+// getAssetEntry reads asset name from the store. aliases maps issuer addresses to
+// account names, and can be nil.
+func (cli *CLI) getAssetEntry(name string, aliases map[string]string) assetEntry {
+	entry := assetEntry{Name: name}
+	entry.Code, _ = cli.GetVar(fmt.Sprintf("asset:%s:code", name))
+	entry.Issuer, _ = cli.GetVar(fmt.Sprintf("asset:%s:issuer", name))
+	entry.Type, _ = cli.GetVar(fmt.Sprintf("asset:%s:type", name))
+	entry.IssuerAlias = aliases[entry.Issuer]
+	return entry
+}
+
+// newAssetEntry returns the entry for asset, resolved from name.
+func newAssetEntry(name string, asset *microstellar.Asset) assetEntry {
+	assetType := microstellar.NativeType
+	if asset.Type == microstellar.Credit4Type {
+		assetType = microstellar.Credit4Type
+	} else if asset.Type == microstellar.Credit12Type {
+		assetType = microstellar.Credit12Type
+	}
+
+	return assetEntry{Name: name, Code: asset.Code, Issuer: asset.Issuer, Type: string(assetType)}
+}
+
+func (cli *CLI) buildAssetListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list all assets in the namespace",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "asset", "subcmd": "list"}
+
+			names, err := cli.listAliases("asset")
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not list assets: %v", err)
+				return
+			}
+
+			// Map issuer addresses back to account aliases
+			accounts, _ := cli.listAliases("account")
+			aliases := map[string]string{}
+			for _, account := range accounts {
+				if address, err := cli.GetVar(fmt.Sprintf("account:%s:address", account)); err == nil {
+					aliases[address] = account
+				}
+			}
+
+			entries := []assetEntry{}
+			for _, name := range names {
+				entries = append(entries, cli.getAssetEntry(name, aliases))
+			}
+
+			cli.showResult(logFields, entries, func() {
+				rows := [][]string{}
+				for _, entry := range entries {
+					issuer := entry.Issuer
+					if entry.IssuerAlias != "" {
+						issuer = fmt.Sprintf("%s (%s)", issuer, entry.IssuerAlias)
+					}
+
+					rows = append(rows, []string{entry.Name, entry.Code, issuer, entry.Type})
+				}
+
+				cli.showTable([]string{"NAME", "CODE", "ISSUER", "TYPE"}, rows)
+			})
 		},
 	}
 
+	addFormatAlias(cmd)
 	return cmd
 }
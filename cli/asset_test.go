@@ -1,6 +1,9 @@
 package cli
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // Note: add -v to any of these commands to enable verbose logging
 
@@ -25,6 +28,11 @@ func TestAssets(t *testing.T) {
 	expectOutput(t, cli, "error", "asset set USD-bad GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM --type credit16")
 	expectOutput(t, cli, "", "asset set USD-bad GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM --type native")
 
+	result := cli.TestCommand("asset list --format json")
+	if !strings.Contains(result, `"name": "USD-chase"`) || !strings.Contains(result, `"issuer_alias": "chase_bank"`) {
+		t.Error("bad asset list: ", result)
+	}
+
 	cli.TestCommand("asset del USD-chase")
 	expectOutput(t, cli, "error", "asset issuer USD-chase")
 
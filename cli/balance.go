@@ -3,11 +3,17 @@ package cli
 import (
 	"encoding/json"
 
-	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// balanceResult is the output of "balance"
+type balanceResult struct {
+	Account string `json:"account"`
+	Asset   string `json:"asset"`
+	Balance string `json:"balance"`
+}
+
 func (cli *CLI) buildBalanceCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "balance [account] [asset]",
@@ -15,33 +21,26 @@ func (cli *CLI) buildBalanceCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			asset := microstellar.NativeAsset
-
-			logFields := logrus.Fields{"cmd": "balance"}
-
+			assetName := ""
 			if len(args) > 1 {
-				var err error
-				assetName := args[1]
-				asset, err = cli.ResolveAsset(assetName)
-
-				if err != nil {
-					cli.error(logFields, "bad asset: %s", assetName)
-					return
-				}
+				assetName = args[1]
 			}
 
-			account := cli.LoadAccount(logFields, name)
-			if account == nil {
+			logFields := logrus.Fields{"cmd": "balance"}
+
+			balance, err := cli.client.Balance(cli.ctx, name, assetName)
+			if err != nil {
+				cli.error(logFields, "%s", err)
 				return
 			}
 
-			balance := account.GetBalance(asset)
-
-			if balance == "" {
-				showSuccess("0")
-			} else {
-				showSuccess(balance)
+			if assetName == "" {
+				assetName = "native"
 			}
+
+			cli.showResult(logFields, balanceResult{name, assetName, balance}, func() {
+				cli.showSuccess("%s", balance)
+			})
 		},
 	}
 
@@ -55,14 +54,16 @@ func (cli *CLI) buildInfoCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			logFields := logrus.Fields{"cmd": "balance"}
+			logFields := logrus.Fields{"cmd": "info"}
 			account := cli.LoadAccount(logFields, name)
 			if account == nil {
 				return
 			}
 
-			info, _ := json.MarshalIndent(*account, "", "  ")
-			showSuccess(string(info))
+			cli.showResult(logFields, account, func() {
+				info, _ := json.MarshalIndent(*account, "", "  ")
+				cli.showSuccess("%s", string(info))
+			})
 		},
 	}
 
@@ -5,24 +5,51 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// versionResult is the output of "version"
+type versionResult struct {
+	Version string `json:"version"`
+}
+
 func (cli *CLI) buildVersionCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "get version of lumen CLI",
 		Run: func(cmd *cobra.Command, args []string) {
-			showSuccess(cli.version)
+			cli.showResult(logrus.Fields{"cmd": "version"}, versionResult{cli.version}, func() {
+				cli.showSuccess("%s", cli.version)
+			})
 		},
 	}
 
 	return cmd
 }
 
+// nsResult is the output of "ns"
+type nsResult struct {
+	Namespace string `json:"namespace"`
+	Protected bool   `json:"protected,omitempty"`
+}
+
+// protectedKey is the global var that marks namespace ns as protected, so its
+// transactions must be confirmed.
+func protectedKey(ns string) string {
+	return "protected:" + ns
+}
+
+// isProtected returns true if namespace ns is protected.
+func (cli *CLI) isProtected(ns string) bool {
+	protected, err := cli.GetGlobalVar(protectedKey(ns))
+	return err == nil && protected == "true"
+}
+
 func (cli *CLI) buildNSCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "ns [namespace]",
@@ -34,19 +61,61 @@ func (cli *CLI) buildNSCmd() *cobra.Command {
 
 				err := cli.SetGlobalVar("ns", ns)
 				if err != nil {
-					cli.error(logrus.Fields{"cmd": "setNS"}, "set failed: ", err)
+					cli.errorKind(ErrStore, logrus.Fields{"cmd": "setNS"}, "set failed: %v", err)
 					return
 				}
 
-				cli.ns = ns
-			} else {
-				showSuccess(cli.ns)
+				cli.ns, cli.nsSource = ns, "store"
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "ns"}, nsResult{cli.ns, cli.isProtected(cli.ns)}, func() {
+				if len(args) == 0 {
+					cli.showSuccess("%s", cli.ns)
+				}
+			})
 		},
 	}
+
+	cmd.AddCommand(cli.buildNSProtectCmd(true))
+	cmd.AddCommand(cli.buildNSProtectCmd(false))
 	return cmd
 }
 
+// buildNSProtectCmd returns "ns protect" or, if protect is false, "ns unprotect".
+func (cli *CLI) buildNSProtectCmd(protect bool) *cobra.Command {
+	name, short := "protect", "require confirmation for transactions in [namespace] (default: current)"
+	if !protect {
+		name, short = "unprotect", "stop requiring confirmation for transactions in [namespace] (default: current)"
+	}
+
+	return &cobra.Command{
+		Use:   name + " [namespace]",
+		Short: short,
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "ns", "subcmd": name}
+			ns := cli.ns
+			if len(args) > 0 {
+				ns = args[0]
+			}
+
+			var err error
+			if protect {
+				err = cli.SetGlobalVar(protectedKey(ns), "true")
+			} else if cli.isProtected(ns) {
+				err = cli.DelGlobalVar(protectedKey(ns))
+			}
+
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "%s failed: %v", name, err)
+				return
+			}
+
+			cli.showResult(logFields, nsResult{ns, protect}, nil)
+		},
+	}
+}
+
 func (cli *CLI) buildSetCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "set [key] [value]",
@@ -58,9 +127,11 @@ func (cli *CLI) buildSetCmd() *cobra.Command {
 
 			err := cli.SetVar(key, val)
 			if err != nil {
-				cli.error(logrus.Fields{"cmd": "set"}, "set failed: ", err)
+				cli.errorKind(ErrStore, logrus.Fields{"cmd": "set"}, "set failed: %v", err)
 				return
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "set"}, varEntry{Name: args[0], Value: val}, nil)
 		},
 	}
 
@@ -76,12 +147,14 @@ func (cli *CLI) buildGetCmd() *cobra.Command {
 			key := fmt.Sprintf("vars:%s", args[0])
 
 			val, err := cli.GetVar(key)
-			if err == nil {
-				showSuccess(val)
-			} else {
-				cli.error(logrus.Fields{"cmd": "get"}, "no such variable: %s\n", args[0])
+			if err != nil {
+				cli.errorKind(ErrResolution, logrus.Fields{"cmd": "get"}, "no such variable: %s\n", args[0])
 				return
 			}
+
+			cli.showResult(logrus.Fields{"cmd": "get"}, varEntry{Name: args[0], Value: val}, func() {
+				cli.showSuccess("%s", val)
+			})
 		},
 	}
 
@@ -98,18 +171,93 @@ func (cli *CLI) buildDelCmd() *cobra.Command {
 
 			err := cli.DelVar(key)
 			if err != nil {
-				cli.error(logrus.Fields{"cmd": "del"}, "del failed: %s\n", err)
+				cli.errorKind(ErrStore, logrus.Fields{"cmd": "del"}, "del failed: %s\n", err)
+				return
+			}
+
+			cli.showResult(logrus.Fields{"cmd": "del"}, varEntry{Name: args[0]}, nil)
+		},
+	}
+	return cmd
+}
+
+func (cli *CLI) buildVarsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vars [list]",
+		Short: "manage variables",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "vars"}, "unrecognized vars command: %s, expecting: list", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(cli.buildVarsListCmd())
+	return cmd
+}
+
+// varEntry is a variable in the output of "vars list", "get", "set", and "del"
+type varEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (cli *CLI) buildVarsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list [prefix]",
+		Short: "list variables in the namespace (that start with [prefix])",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "vars", "subcmd": "list"}
+
+			prefix := ""
+			if len(args) > 0 {
+				prefix = args[0]
+			}
+
+			keys, err := cli.ListVars("vars:" + prefix)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not list variables: %v", err)
 				return
 			}
+
+			entries := []varEntry{}
+			for _, key := range keys {
+				val, err := cli.GetVar(key)
+				if err != nil {
+					continue
+				}
+
+				entries = append(entries, varEntry{Name: strings.TrimPrefix(key, "vars:"), Value: val})
+			}
+
+			cli.showResult(logFields, entries, func() {
+				rows := [][]string{}
+				for _, entry := range entries {
+					rows = append(rows, []string{entry.Name, entry.Value})
+				}
+
+				cli.showTable([]string{"NAME", "VALUE"}, rows)
+			})
 		},
 	}
+
+	addFormatAlias(cmd)
 	return cmd
 }
 
+// friendbotResult is the output of "friendbot"
+type friendbotResult struct {
+	Address  string `json:"address"`
+	Response string `json:"response"`
+}
+
 func (cli *CLI) buildFriendbotCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "friendbot [address]",
-		Short: "fund [address] on the test network with friendbot",
+		Short: "fund [address] with the network's friendbot",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
@@ -118,18 +266,27 @@ func (cli *CLI) buildFriendbotCmd() *cobra.Command {
 			address, err := cli.ResolveAccount(logFields, name, "address")
 
 			if err != nil {
-				cli.error(logFields, "invalid account: %s", name)
+				cli.errorKind(ErrResolution, logFields, "invalid account: %s", name)
+				return
+			}
+
+			if cli.dryRun {
+				cli.showResult(logFields, friendbotResult{address, ""}, func() {
+					cli.showSuccess("dry run: not funding %s", address)
+				})
 				return
 			}
 
-			response, err := microstellar.FundWithFriendBot(address)
+			response, err := cli.client.Fund(cli.ctx, address)
 
 			if err != nil {
 				cli.error(logFields, "friendbot error: %v", err)
 				return
 			}
 
-			showSuccess("friendbot says:\n %v", response)
+			cli.showResult(logFields, friendbotResult{address, response}, func() {
+				cli.showSuccess("friendbot says:\n %v", response)
+			})
 		},
 	}
 
@@ -145,13 +302,6 @@ func (cli *CLI) buildFlagsCmd() *cobra.Command {
 			name := args[0]
 
 			logFields := logrus.Fields{"cmd": "flags"}
-			address, err := cli.ResolveAccount(logFields, name, "seed")
-
-			if err != nil {
-				cli.error(logFields, "invalid account: %s", name)
-				return
-			}
-
 			flags := microstellar.FlagsNone
 
 			for i, flag := range args {
@@ -169,27 +319,23 @@ func (cli *CLI) buildFlagsCmd() *cobra.Command {
 				case "auth_immutable":
 					flags |= microstellar.FlagAuthImmutable
 				default:
-					cli.error(logFields, "bad flag: %s", flag)
+					cli.errorKind(ErrUsage, logFields, "bad flag: %s", flag)
 					return
 				}
 			}
 
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate transaction: %v", err)
-				return
-			}
+			shouldClear, _ := cmd.Flags().GetBool("clear")
 
-			shouldClear, err := cmd.Flags().GetBool("clear")
+			err := cli.submitTx(logFields, cmd, name, func(b client.Builder, source string, opts *microstellar.Options) error {
+				if shouldClear {
+					return b.ClearFlags(source, flags, opts)
+				}
 
-			if shouldClear {
-				err = cli.ms.ClearFlags(address, flags, opts)
-			} else {
-				err = cli.ms.SetFlags(address, flags, opts)
-			}
+				return b.SetFlags(source, flags, opts)
+			})
 
 			if err != nil {
-				cli.error(logFields, "can't set flags: %v", microstellar.ErrorString(err))
+				cli.error(logFields, "can't set flags: %v", err)
 				return
 			}
 		},
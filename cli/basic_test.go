@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"testing"
 )
 
@@ -23,6 +24,11 @@ func TestVariables(t *testing.T) {
 	cli.TestCommand("ns test")
 	expectOutput(t, cli, "bar", "get foo")
 
+	cli.TestCommand("set config:fee 100")
+	expectOutput(t, cli, "NAME        VALUE\nconfig:fee  100\nfoo         bar", "vars list")
+	expectOutput(t, cli, "NAME        VALUE\nconfig:fee  100", "vars list config:")
+	cli.TestCommand("del config:fee")
+
 	cli.TestCommand("del foo")
 	expectOutput(t, cli, "error", "get foo")
 
@@ -33,3 +39,35 @@ func TestVariables(t *testing.T) {
 	expectOutput(t, cli, "", "flags mo none")
 	expectOutput(t, cli, "", "flags mo auth_revocable auth_immutable")
 }
+
+func TestProtectedNamespaces(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns treasury")
+	cli.TestCommand("set config:network fake")
+	cli.TestCommand("account new mo")
+	cli.TestCommand("account new kelly")
+
+	expectOutput(t, cli, "", "ns protect")
+	expectOutput(t, cli, "true", "ns -o template={{.protected}}")
+
+	// Transactions in protected namespaces must be confirmed.
+	_, err := cli.RunContext(context.Background(), []string{"pay", "1", "--from", "mo", "--to", "kelly"}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || cliErr.Kind != ErrNotConfirmed || cliErr.ExitCode() != 11 {
+		t.Errorf("pay in protected namespace: want not confirmed error, got %v", err)
+	}
+
+	expectOutput(t, cli, "", "pay 1 --from mo --to kelly --yes")
+	expectOutput(t, cli, "", "pay 1 --from mo --to kelly -y")
+	expectOutput(t, cli, "error", "pay 1 --from mo --to kelly")
+	expectOutput(t, cli, "FAKE", "pay 1 --from mo --to kelly --nosubmit")
+	expectOutput(t, cli, "error", "tx submit FAKE")
+
+	// Other namespaces aren't affected.
+	expectOutput(t, cli, "", "ns protect other")
+	expectOutput(t, cli, "", "ns unprotect")
+	expectOutput(t, cli, "", "pay 1 --from mo --to kelly")
+	expectOutput(t, cli, "", "ns unprotect")
+	expectOutput(t, cli, "<no value>", "ns -o template={{.protected}}")
+	expectOutput(t, cli, "true", "ns other -o template={{.protected}}")
+	expectOutput(t, cli, "error", "ns protect a b")
+}
@@ -2,19 +2,30 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/0xfe/lumen/agent"
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/lumen/store"
 	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 )
 
-// CLI represents a command-line interface. This class is
-// not threadsafe.
+// CLI represents a command-line interface. A CLI runs one command at a time,
+// but RunContext can be called concurrently: each call runs on a copy of the CLI
+// that shares its store.
 type CLI struct {
 	store       store.API
 	ms          *microstellar.MicroStellar
@@ -23,6 +34,44 @@ type CLI struct {
 	version     string
 	testing     bool
 	stopWatcher func()
+	mu          *sync.Mutex                 // protects stopWatcher and running
+	running     map[*CLI]context.CancelFunc // commands started by RunContext
+
+	ctx    context.Context
+	stdout io.Writer
+	stderr io.Writer
+	logger *logrus.Logger
+	err    *Error // first error from the current command
+
+	passphraseFile string   // passphrase file for encrypted stores
+	cmdLine        string   // command being executed, for the history
+	pluginArgs     []string // arguments for the plugin being executed
+
+	shared *shared // state shared with copies of this CLI
+
+	network   string         // network spec
+	friendbot string         // friendbot URL of the network profile, if any
+	agent     *agent.Client  // signing agent, if LUMEN_AGENT_SOCK is set
+	client    *client.Client // resolves aliases, and builds transactions
+
+	config       *config       // the configuration file
+	settings     []setting     // the effective configuration, for "config show"
+	nsSource     string        // where ns came from
+	inShell      bool          // running the commands of a shell session
+	inScript     bool          // running the commands of a script
+	dryRun       bool          // build transactions without signing or submitting them
+	dryRunScript bool          // running a script with --dry-run, with changes to the store in memory
+	offline      bool          // refuse network access, and print transactions instead of submitting them
+	fee          uint32        // base fee in stroops, or 0 for the default
+	timeout      time.Duration // transaction timeout, or 0 for none
+}
+
+// shared is the state shared by a CLI and the copies RunContext makes of it.
+type shared struct {
+	historyMu   *sync.Mutex       // serializes changes to the store, so the history stays consistent
+	secrets     *client.Secrets   // seeds fetched from secret references
+	pluginsOnce *sync.Once        // PATH is searched for plugins once
+	plugins     map[string]string // paths of plugins, by name
 }
 
 // NewCLI returns an initialized CLI
@@ -35,15 +84,104 @@ func NewCLI() *CLI {
 		version:     "v0.0",
 		testing:     false,
 		stopWatcher: func() {},
+		mu:          &sync.Mutex{},
+		running:     map[*CLI]context.CancelFunc{},
+		ctx:         context.Background(),
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		logger:      newLogger(os.Stderr),
+		shared: &shared{
+			historyMu:   &sync.Mutex{},
+			secrets:     client.NewSecrets(),
+			pluginsOnce: &sync.Once{},
+		},
 	}
 
 	cli.buildRootCmd()
 	return cli
 }
 
-// Execute parses the command line and processes it.
+// newLogger returns a logger that writes to out. Each CLI has its own logger,
+// so that embedding programs keep control of the global logger.
+func newLogger(out io.Writer) *logrus.Logger {
+	logger := logrus.New()
+	logger.Out = out
+	return logger
+}
+
+// fork returns a copy of cli for a single command, writing to stdout and stderr.
+func (cli *CLI) fork(ctx context.Context, stdout, stderr io.Writer) *CLI {
+	c := &CLI{
+		store:       cli.store,
+		version:     cli.version,
+		testing:     cli.testing,
+		stopWatcher: func() {},
+		mu:          &sync.Mutex{},
+		running:     map[*CLI]context.CancelFunc{},
+		ctx:         ctx,
+		stdout:      stdout,
+		stderr:      stderr,
+		logger:      newLogger(stderr),
+		shared:      cli.shared,
+	}
+
+	c.buildRootCmd()
+	return c
+}
+
+// Execute parses the command line and processes it. If the command fails,
+// the process exits with the status for the kind of error (see ErrorKind.)
 func (cli *CLI) Execute() {
-	cli.rootCmd.Execute()
+	// This is the lumen binary, so log with the global logger, along with
+	// the other packages.
+	cli.logger = logrus.StandardLogger()
+
+	if err := cli.execute(); err != nil {
+		os.Exit(err.(*Error).ExitCode())
+	}
+}
+
+// execute runs the root command and returns the first error from it.
+func (cli *CLI) execute() error {
+	cli.err = nil
+	cli.rootCmd.SilenceErrors = true
+	cli.rootCmd.SilenceUsage = true // printed below, for bad flags and arguments only
+	cli.rootCmd.SetOutput(cli.stderr)
+
+	if cmd, err := cli.rootCmd.ExecuteC(); err != nil && cli.err == nil {
+		// Cobra errors are bad flags and arguments.
+		if cli.errorFormat() != "json" {
+			fmt.Fprintf(cli.stderr, "Error: %v\n", err)
+			fmt.Fprint(cli.stderr, cmd.UsageString())
+		}
+		cli.fail(newUsageError(cmd, err.Error()))
+	}
+
+	if cli.err != nil {
+		if cli.errorFormat() == "json" {
+			cli.showErrorJSON(cli.err)
+		}
+		return cli.err
+	}
+
+	return nil
+}
+
+// errorFormat returns the value of --error-format.
+func (cli *CLI) errorFormat() string {
+	format, _ := cli.rootCmd.PersistentFlags().GetString("error-format")
+	return format
+}
+
+// showErrorJSON writes err to stderr as a single line of JSON, along with
+// the exit status.
+func (cli *CLI) showErrorJSON(err *Error) {
+	data, _ := json.Marshal(struct {
+		*Error
+		ExitCode int `json:"exit_code"`
+	}{err, err.ExitCode()})
+
+	fmt.Fprintln(cli.stderr, string(data))
 }
 
 // SetStore lets you set the data store (used for testing.)
@@ -51,201 +189,462 @@ func (cli *CLI) SetStore(store store.API) {
 	cli.store = store
 }
 
-// Embeddable returns a CLI that you can embed into your own Go programs. This
-// is not thread-safe.
+// Embeddable returns a CLI that you can embed into your own Go programs. Use
+// RunContext to run commands: it's safe for concurrent use. Set a store with
+// SetStore to share it between commands, otherwise each command opens the
+// store selected by --store, LUMEN_STORE, or the config file.
 func (cli *CLI) Embeddable() *CLI {
 	cli.testing = true
 	return cli
 }
 
-// Run executes CLI with the given arguments. Used for testing. Not thread safe.
-func (cli *CLI) Run(args ...string) string {
-	oldStdout := os.Stdout
+// RunContext executes a command with the given arguments, and returns its
+// output and error, if any. Output and logs are also written to stdout and
+// stderr, which can be nil. If ctx is cancelled, streaming commands such as
+// watch stop. RunContext doesn't modify cli, and can be called concurrently.
+func (cli *CLI) RunContext(ctx context.Context, args []string, stdout, stderr io.Writer) (string, error) {
+	var output bytes.Buffer
 
-	r, w, _ := os.Pipe()
+	out := io.Writer(&output)
+	if stdout != nil {
+		out = io.MultiWriter(&output, stdout)
+	}
 
-	os.Stdout = w
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
 
-	cli.rootCmd.SetArgs(args)
-	cli.rootCmd.Execute()
-	cli.buildRootCmd()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := cli.fork(ctx, out, stderr)
+	c.rootCmd.SetArgs(args)
+
+	cli.mu.Lock()
+	cli.running[c] = cancel
+	cli.mu.Unlock()
 
-	w.Close()
+	defer func() {
+		cli.mu.Lock()
+		delete(cli.running, c)
+		cli.mu.Unlock()
+	}()
 
-	os.Stdout = oldStdout
+	go func() {
+		<-ctx.Done()
+		c.StopWatcher()
+	}()
 
-	var stdOut bytes.Buffer
-	io.Copy(&stdOut, r)
-	return stdOut.String()
+	err := c.execute()
+	return output.String(), err
+}
+
+// Run executes CLI with the given arguments and returns its output. Errors
+// are logged (or reported as "error" in test mode.) Unlike RunContext, the
+// command runs on cli itself, so state such as the namespace is kept for later
+// calls to methods like ResolveAccount. Not thread safe.
+func (cli *CLI) Run(args ...string) string {
+	stdout, stderr, logOut := cli.stdout, cli.stderr, cli.logger.Out
+
+	var output bytes.Buffer
+	cli.stdout = &output
+	if cli.testing {
+		cli.stderr = ioutil.Discard
+		cli.logger.Out = cli.stderr
+	}
+
+	cli.rootCmd.SetArgs(args)
+	cli.execute()
+	cli.buildRootCmd()
+
+	cli.stdout, cli.stderr, cli.logger.Out = stdout, stderr, logOut
+	return output.String()
 }
 
 // RunCommand is a helper that lets you send a full command line to Run, so you don't
-// have to break up your arguments.
+// have to break up your arguments. Arguments can be quoted as in the shell.
 func (cli *CLI) RunCommand(command string) string {
-	result := cli.Run(strings.Fields(command)...)
-	return result
+	args, err := SplitCommand(command)
+	if err != nil {
+		cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "RunCommand"}).Errorf("%v", err)
+		if cli.testing {
+			return "error\n"
+		}
+		return ""
+	}
+
+	return cli.Run(args...)
 }
 
-// TestCommand is a helper function that calls Run(...) in test mode. When running
-// in test mode, os.Exit is not called on errors.
+// TestCommand is a helper function that calls RunCommand(...) in test mode. When
+// running in test mode, failed commands print "error".
 func (cli *CLI) TestCommand(command string) string {
 	cli.testing = true
-	result := cli.Run(strings.Fields(command)...)
+	result := cli.RunCommand(command)
 	cli.testing = false
 	return result
 }
 
-// Stop an existing watcher from streaming.
+// StopWatcher stops existing watchers from streaming, including those started
+// with Run or RunContext.
 func (cli *CLI) StopWatcher() {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
 	cli.stopWatcher()
 	cli.stopWatcher = func() {}
+
+	for _, cancel := range cli.running {
+		cancel()
+	}
+}
+
+// setStopWatcher sets the function that stops the current watcher. If the
+// command has been cancelled, the watcher is stopped right away.
+func (cli *CLI) setStopWatcher(stop func()) {
+	cli.mu.Lock()
+	defer cli.mu.Unlock()
+
+	cli.stopWatcher = stop
+	if cli.ctx.Err() != nil {
+		stop()
+	}
 }
 
 // SetGlobalVar writes the kv pair to the global namespace in the storage backend
 func (cli *CLI) SetGlobalVar(key string, value string) error {
 	key = fmt.Sprintf("global:%s", key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "SetGlobalVar"}).Debugf("setting %s: %s", key, value)
-	return cli.store.Set(key, value, 0)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "SetGlobalVar"}).Debugf("setting %s: %s", key, value)
+	return cli.setKey(key, value)
 }
 
 // GetGlobalVar reads global var "key"
 func (cli *CLI) GetGlobalVar(key string) (string, error) {
 	key = fmt.Sprintf("global:%s", key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "GetGlobalVar"}).Debugf("getting %s", key)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "GetGlobalVar"}).Debugf("getting %s", key)
 	return cli.store.Get(key)
 }
 
+// DelGlobalVar deletes global var "key"
+func (cli *CLI) DelGlobalVar(key string) error {
+	key = fmt.Sprintf("global:%s", key)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "DelGlobalVar"}).Debugf("deleting %s", key)
+	return cli.deleteKey(key)
+}
+
 // SetVar writes the kv pair to the storage backend
 func (cli *CLI) SetVar(key string, value string) error {
 	key = fmt.Sprintf("%s:%s", cli.ns, key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "SetVar"}).Debugf("setting %s: %s", key, value)
-	return cli.store.Set(key, value, 0)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "SetVar"}).Debugf("setting %s: %s", key, value)
+	return cli.setKey(key, value)
 }
 
 func (cli *CLI) GetVar(key string) (string, error) {
 	key = fmt.Sprintf("%s:%s", cli.ns, key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "GetVar"}).Debugf("getting %s", key)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "GetVar"}).Debugf("getting %s", key)
 	return cli.store.Get(key)
 }
 
+// ListVars returns the keys in the current namespace that start with prefix,
+// in sorted order. The namespace is stripped from the returned keys.
+func (cli *CLI) ListVars(prefix string) ([]string, error) {
+	nsPrefix := fmt.Sprintf("%s:", cli.ns)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "ListVars"}).Debugf("listing %s%s", nsPrefix, prefix)
+	keys, err := cli.store.Keys(nsPrefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range keys {
+		keys[i] = strings.TrimPrefix(keys[i], nsPrefix)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
 func (cli *CLI) DelVar(key string) error {
 	key = fmt.Sprintf("%s:%s", cli.ns, key)
-	logrus.WithFields(logrus.Fields{"type": "cli", "method": "DelVar"}).Debugf("deleting %s", key)
-	return cli.store.Delete(key)
+	cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "DelVar"}).Debugf("deleting %s", key)
+	return cli.deleteKey(key)
 }
 
 // setup turns up the CLI environment, and gets called by Cobra before
 // a command is executed.
-func (cli *CLI) setup(cmd *cobra.Command, args []string) {
-	if cli.testing {
-		buf := new(bytes.Buffer)
-		logrus.SetOutput(buf)
+func (cli *CLI) setup(cmd *cobra.Command, args []string) error {
+	cli.cmdLine = commandLine(cmd, args)
+
+	// Plugins parse their own flags, except for lumen's global flags.
+	if _, ok := cmd.Annotations[pluginAnnotation]; ok {
+		cli.pluginArgs = cli.parseGlobalFlags(args)
+		if verbose, _ := cli.rootCmd.PersistentFlags().GetBool("verbose"); verbose {
+			cli.setVerbose()
+		}
 	}
 
 	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
-		logrus.SetOutput(os.Stderr)
-		logrus.SetLevel(logrus.DebugLevel)
-		logrus.SetFormatter(&logrus.TextFormatter{})
+		cli.setVerbose()
 	}
 
+	// Every command in a script run with --dry-run is a dry run.
+	cli.dryRun, _ = cli.rootCmd.PersistentFlags().GetBool("dry-run")
+	cli.dryRun = cli.dryRun || cli.dryRunScript
+	cli.offline, _ = cli.rootCmd.PersistentFlags().GetBool("offline")
+
 	env := os.Getenv("LUMEN_ENV")
 	if env != "" {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("env LUMEN_ENV: %s", env)
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("env LUMEN_ENV: %s", env)
 	} else {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("LUMEN_ENV not set")
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("LUMEN_ENV not set")
+	}
+
+	// Shell sessions read the configuration file once.
+	config, err := cli.config, error(nil)
+	if !cli.inShell || config == nil {
+		cli.settings = nil
+		config, err = cli.readConfig(env)
+		cli.config = config
 	}
 
-	config := readConfig(env)
+	if err != nil && !isConfigValidateCmd(cmd) {
+		cli.errorKind(ErrConfig, logrus.Fields{"type": "setup"}, "%v", err)
+		return cli.err
+	}
 
 	// Do this again if the configuration file says so
 	if config.verbose {
-		logrus.SetOutput(os.Stderr)
-		logrus.SetLevel(logrus.DebugLevel)
-		logrus.SetFormatter(&logrus.TextFormatter{})
+		cli.setVerbose()
+	}
+
+	if config.logFormat == "json" {
+		cli.logger.Formatter = &logrus.JSONFormatter{}
+	}
+
+	cli.setupSettings(cmd)
+
+	cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using storage driver %s with %s", config.storageDriver, store.DisplayParams(config.storageDriver, config.storageParams))
+
+	if format := cli.errorFormat(); format != "text" && format != "json" {
+		cli.errorKind(ErrUsage, logrus.Fields{"type": "setup"}, "bad --error-format: %s, expecting: text|json", format)
+		return cli.err
+	}
+
+	if err := cli.setupFormatAlias(cmd); err != nil {
+		cli.errorKind(ErrUsage, logrus.Fields{"type": "setup"}, "%v", err)
+		return cli.err
+	}
+
+	if err := checkOutputFormat(cli.outputFormat()); err != nil {
+		cli.errorKind(ErrUsage, logrus.Fields{"type": "setup"}, "%v", err)
+		return cli.err
+	}
+
+	// "config validate" reports problems with the file, which may include a
+	// store that can't be opened.
+	if isConfigValidateCmd(cmd) {
+		return nil
 	}
 
-	logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using storage driver %s with %s", config.storageDriver, config.storageParams)
+	if err := cli.setupStore(config.storageDriver, config.storageParams); err != nil {
+		cli.errorKind(ErrStore, logrus.Fields{"type": "setup"}, "%v", err)
+		return err
+	}
 
-	cli.setupStore(config.storageDriver, config.storageParams)
+	cli.setupEncryption(config.passphraseFile)
 	cli.setupNameSpace()
 	cli.setupNetwork()
+	cli.setupTxDefaults()
+	cli.setupAgent()
+	cli.setupClient()
+	return nil
+}
+
+// setVerbose turns on debug logging.
+func (cli *CLI) setVerbose() {
+	cli.logger.Out = cli.stderr
+	if _, ok := cli.logger.Formatter.(*logrus.JSONFormatter); !ok {
+		cli.logger.Formatter = &logrus.TextFormatter{}
+	}
+	cli.logger.SetLevel(logrus.DebugLevel)
+}
+
+// parseStoreSpec splits a store spec of the form "driver,params".
+func parseStoreSpec(spec string) (driver, params string) {
+	// Split on the first comma only, so params (e.g., DSNs) can contain commas.
+	parts := strings.SplitN(spec, ",", 2)
+	driver = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		params = strings.TrimSpace(parts[1])
+	}
+
+	return driver, params
 }
 
 // setupStore sets up the storage backend.
-func (cli *CLI) setupStore(driver, params string) {
+func (cli *CLI) setupStore(driver, params string) error {
 	if cli.store != nil {
 		// Custom store takes precedence
-		return
+		return nil
 	}
 
-	parseStoreParams := func(store string) {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store %s", store)
-		parts := strings.Split(store, ",")
-		driver = strings.TrimSpace(parts[0])
-		if len(parts) > 1 {
-			params = strings.TrimSpace(parts[1])
-		} else {
-			params = ""
-		}
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("selecting store driver: %s params: %s", driver, params)
+	parseStoreParams := func(spec string) {
+		driver, params = parseStoreSpec(spec)
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("selecting store driver: %s params: %s", driver, store.DisplayParams(driver, params))
 	}
 
+	source := "default"
 	if cli.rootCmd.Flag("store").Changed {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store from flag --store")
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store from flag --store")
 		store, _ := cli.rootCmd.Flags().GetString("store")
 		parseStoreParams(store)
+		source = "flag"
 	} else if os.Getenv("LUMEN_STORE") != "" {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store from env LUMEN_STORE")
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store from env LUMEN_STORE")
 		parseStoreParams(os.Getenv("LUMEN_STORE"))
+		source = "env"
+	} else if _, configSource, ok := cli.config.lookup("", "storage"); ok {
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using store from config file")
+		source = configSource
 	} else {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using default store")
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using default store")
 	}
 
+	cli.setSetting("storage.driver", driver, source)
+	cli.setSetting("storage.params", store.DisplayParams(driver, params), source)
+
 	var err error
 	cli.store, err = store.NewStore(driver, params)
 
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Fatalf("could not initialize filestore: %s:%s", driver, params)
+		return errors.Wrapf(err, "could not initialize store: %s:%s", driver, store.DisplayParams(driver, params))
+	}
+
+	return nil
+}
+
+// setupEncryption wraps the store so that seeds are encrypted at rest. The
+// passphrase is only requested if a secret is read or written.
+func (cli *CLI) setupEncryption(passphraseFile string) {
+	if _, ok := cli.store.(*store.Encrypted); ok {
 		return
 	}
+
+	source := "default"
+	if file := os.Getenv("LUMEN_PASSPHRASE_FILE"); file != "" {
+		passphraseFile, source = file, "env"
+	} else if _, configSource, ok := cli.config.lookup("", "storage.passphrase_file"); ok {
+		source = configSource
+	}
+	cli.setSetting("storage.passphrase_file", passphraseFile, source)
+
+	cli.passphraseFile = passphraseFile
+	cli.store = store.NewEncryptedStore(cli.store, cli.passphraseFunc("LUMEN_PASSPHRASE", passphraseFile, false))
 }
 
 // setupNameSpace makes sure that storage commands used the correct namespace.
 func (cli *CLI) setupNameSpace() {
+	defer func() { cli.setSetting("namespace", cli.ns, cli.nsSource) }()
+
 	if cli.ns != "" {
 		return
 	}
 
 	if cli.rootCmd.Flag("ns").Changed {
 		ns, _ := cli.rootCmd.Flags().GetString("ns")
-		cli.ns = ns
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from flag --ns")
+		cli.ns, cli.nsSource = ns, "flag"
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from flag --ns")
 	} else if ns := os.Getenv("LUMEN_NS"); ns != "" {
-		cli.ns = ns
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from env LUMEN_NS")
+		cli.ns, cli.nsSource = ns, "env"
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from env LUMEN_NS")
 	} else if ns, err := cli.GetGlobalVar("ns"); err == nil {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from store")
-		cli.ns = ns
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from store")
+		cli.ns, cli.nsSource = ns, "store"
+	} else if ns, source, ok := cli.config.lookup("", "namespace"); ok {
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using namespace from config file")
+		cli.ns, cli.nsSource = cast.ToString(ns), source
 	} else {
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using default namespace")
-		cli.ns = "default"
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using default namespace")
+		cli.ns, cli.nsSource = "default", "default"
 	}
 
-	logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("namespace: %s", cli.ns)
+	cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("namespace: %s", cli.ns)
 }
 
-// setupNetwork ensures that lumen is operating on the correct network.
+// setupNetwork ensures that lumen is operating on the correct network. Networks
+// can be named with "lumen network add", or in the configuration file.
 func (cli *CLI) setupNetwork() {
+	network, source := "test", "default"
 	if cli.rootCmd.Flag("network").Changed {
-		network, _ := cli.rootCmd.Flags().GetString("network")
-		logrus.WithFields(logrus.Fields{"type": "setup"}).Debugf("using horizon network: %s", network)
-		cli.ms = microstellar.NewFromSpec(network)
-	} else {
-		network, err := cli.GetVar("vars:config:network")
-		if err != nil {
-			cli.ms = microstellar.NewFromSpec("test")
-		} else {
-			cli.ms = microstellar.NewFromSpec(network)
+		network, _ = cli.rootCmd.Flags().GetString("network")
+		source = "flag"
+	} else if value, err := cli.GetVar("vars:config:network"); err == nil {
+		network, source = value, "store"
+	} else if value, configSource, ok := cli.config.lookup(cli.ns, "network"); ok {
+		network, source = cast.ToString(value), configSource
+	}
+
+	cli.setSetting("network", network, source)
+	for _, name := range cli.config.networks() {
+		cli.setSetting("networks."+name, cli.config.network(name).Spec(), cli.config.source(""))
+	}
+
+	// Network profiles in the store take precedence over the configuration file.
+	var profile *client.Network
+	if !client.BuiltinNetwork(network) {
+		if profile, _ = client.LoadNetwork(cli.store, network); profile == nil {
+			profile = cli.config.network(network)
+		}
+
+		if profile == nil && !strings.Contains(network, ";") {
+			cli.logger.WithFields(logrus.Fields{"type": "setup"}).Warnf("unknown network: %s, see: lumen network list", network)
 		}
 	}
+
+	cli.network, cli.friendbot = network, ""
+	if profile != nil {
+		cli.network, cli.friendbot = profile.Spec(), profile.Friendbot
+	}
+
+	cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("using horizon network: %s", cli.network)
+	cli.ms = microstellar.NewFromSpec(cli.network)
+	if cli.offline {
+		cli.logger.WithFields(logrus.Fields{"type": "setup"}).Debugf("offline, refusing network access")
+		cli.ms = microstellar.NewFromSpec(client.OfflineNetwork(cli.network))
+	}
+}
+
+// setupTxDefaults sets the fee and timeout for transactions in the current
+// namespace from the configuration file. Values are validated by readConfig.
+func (cli *CLI) setupTxDefaults() {
+	cli.fee, cli.timeout = 0, 0
+
+	if value, source, ok := cli.config.lookup(cli.ns, "fee"); ok {
+		cli.fee = uint32(cast.ToInt(value))
+		cli.setSetting("fee", fmt.Sprintf("%d", cli.fee), source)
+	} else {
+		cli.setSetting("fee", "100", "default")
+	}
+
+	if value, source, ok := cli.config.lookup(cli.ns, "timeout"); ok {
+		cli.timeout, _ = parseTimeout(value)
+		cli.setSetting("timeout", cli.timeout.String(), source)
+	} else {
+		cli.setSetting("timeout", "0s", "default")
+	}
+}
+
+// setupClient creates the client for the current namespace and network.
+func (cli *CLI) setupClient() {
+	cli.client = client.New(cli.store, client.Options{
+		Namespace: cli.ns,
+		Network:   cli.network,
+		Friendbot: cli.friendbot,
+		Fee:       cli.fee,
+		Timeout:   cli.timeout,
+		Agent:     cli.agent,
+		Secrets:   cli.shared.secrets,
+		Stderr:    cli.stderr,
+		Logger:    cli.logger,
+		Offline:   cli.offline,
+	})
 }
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunContext(t *testing.T) {
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	var stdout bytes.Buffer
+	if _, err := cli.RunContext(ctx, []string{"set", "memo", "thanks for the fish"}, nil, nil); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	got, err := cli.RunContext(ctx, []string{"get", "memo"}, &stdout, nil)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	if got != "thanks for the fish\n" || stdout.String() != got {
+		t.Errorf("get: want %q, got %q (stdout %q)", "thanks for the fish\n", got, stdout.String())
+	}
+
+	// Quoted arguments
+	cli.TestCommand(`set greeting "hello world"`)
+	expectOutput(t, cli, "hello world", "get greeting")
+}
+
+func TestRunContextErrors(t *testing.T) {
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	var stderr bytes.Buffer
+	output, err := cli.RunContext(ctx, []string{"get", "nothing"}, nil, &stderr)
+	if err == nil {
+		t.Fatalf("get: want error")
+	}
+
+	if output != "" {
+		t.Errorf("get: want no output, got %q", output)
+	}
+
+	cliErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("get: want *Error, got %T", err)
+	}
+
+	if cliErr.Cmd != "get" || cliErr.Usage || !strings.Contains(stderr.String(), "no such variable") {
+		t.Errorf("get: unexpected error: %+v (stderr %q)", cliErr, stderr.String())
+	}
+
+	_, err = cli.RunContext(ctx, []string{"get", "--bad-flag"}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || !cliErr.Usage || cliErr.Cmd != "get" {
+		t.Errorf("get --bad-flag: want usage error, got %#v", err)
+	}
+
+	_, err = cli.RunContext(ctx, []string{}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || !cliErr.Usage {
+		t.Errorf("(no command): want usage error, got %#v", err)
+	}
+}
+
+func TestRunContextConcurrent(t *testing.T) {
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ns := fmt.Sprintf("ns%d", i)
+			value := fmt.Sprintf("value %d", i)
+
+			if _, err := cli.RunContext(ctx, []string{"--ns", ns, "set", "foo", value}, nil, nil); err != nil {
+				t.Errorf("set: %v", err)
+				return
+			}
+
+			got, err := cli.RunContext(ctx, []string{"--ns", ns, "get", "foo"}, nil, nil)
+			if err != nil || got != value+"\n" {
+				t.Errorf("get (%s): want %q, got %q, %v", ns, value, got, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Concurrent changes must not clobber each other's history.
+	entries, err := cli.listHistory(0)
+	if err != nil || len(entries) != 20 {
+		t.Errorf("history: want 20 entries, got %d, %v", len(entries), err)
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("set config:network fake")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := cli.RunContext(ctx, []string{"watch", "ledger"}, nil, nil)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Errorf("watch: not stopped by cancelled context")
+	}
+}
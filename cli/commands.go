@@ -14,10 +14,10 @@ func (cli *CLI) buildRootCmd() {
 	}
 
 	rootCmd := &cobra.Command{
-		Use:              "lumen",
-		Short:            "Lumen is a commandline client for the Stellar blockchain",
-		Run:              cli.help,
-		PersistentPreRun: cli.setup,
+		Use:               "lumen",
+		Short:             "Lumen is a commandline client for the Stellar blockchain",
+		Run:               cli.help,
+		PersistentPreRunE: cli.setup,
 	}
 	cli.rootCmd = rootCmd
 
@@ -26,23 +26,41 @@ func (cli *CLI) buildRootCmd() {
 	// Global flags
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output (false)")
 	rootCmd.PersistentFlags().Bool("nosubmit", false, "display transaction without submitting")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "describe transactions without signing or submitting them")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "submit transactions without confirmation")
+	rootCmd.PersistentFlags().Bool("offline", false, "build transactions without accessing the network (needs --sequence)")
 	rootCmd.PersistentFlags().String("network", "test", "network to use (test)")
 	rootCmd.PersistentFlags().String("ns", "default", "namespace to use (default)")
 	rootCmd.PersistentFlags().String("store", fmt.Sprintf("file:%s/.lumen-data.yml", home), "namespace to use (default)")
+	rootCmd.PersistentFlags().String("error-format", "text", "error output on stderr (text, json)")
+	rootCmd.PersistentFlags().StringP("output", "o", "", "output format (json, yaml, table, template=...)")
+	rootCmd.PersistentFlags().String("config", "", "configuration file (.lumen-config.yml)")
 
 	// Basic commands
-	rootCmd.AddCommand(cli.buildVersionCmd()) // version
-	rootCmd.AddCommand(cli.buildNSCmd())      // ns
-	rootCmd.AddCommand(cli.buildSetCmd())     // set
-	rootCmd.AddCommand(cli.buildGetCmd())     // get
-	rootCmd.AddCommand(cli.buildDelCmd())     // del
+	rootCmd.AddCommand(cli.buildVersionCmd())    // version
+	rootCmd.AddCommand(cli.buildNSCmd())         // ns
+	rootCmd.AddCommand(cli.buildSetCmd())        // set
+	rootCmd.AddCommand(cli.buildGetCmd())        // get
+	rootCmd.AddCommand(cli.buildDelCmd())        // del
+	rootCmd.AddCommand(cli.buildVarsCmd())       // vars
+	rootCmd.AddCommand(cli.buildStoreCmd())      // store
+	rootCmd.AddCommand(cli.buildHistoryCmd())    // history
+	rootCmd.AddCommand(cli.buildUndoCmd())       // undo
+	rootCmd.AddCommand(cli.buildConfigCmd())     // config
+	rootCmd.AddCommand(cli.buildShellCmd())      // shell
+	rootCmd.AddCommand(cli.buildRunCmd())        // run
+	rootCmd.AddCommand(cli.buildCompletionCmd()) // completion
+	rootCmd.AddCommand(cli.buildCompleteCmd())   // __complete
 
 	// Core commands
-	rootCmd.AddCommand(cli.buildPayCmd())    // pay
-	rootCmd.AddCommand(cli.buildTrustCmd())  // trust
-	rootCmd.AddCommand(cli.buildSignerCmd()) // signer
-	rootCmd.AddCommand(cli.buildDexCmd())    // dex
-	rootCmd.AddCommand(cli.buildTxCmd())     // tx
+	rootCmd.AddCommand(cli.buildPayCmd())     // pay
+	rootCmd.AddCommand(cli.buildTrustCmd())   // trust
+	rootCmd.AddCommand(cli.buildSignerCmd())  // signer
+	rootCmd.AddCommand(cli.buildDexCmd())     // dex
+	rootCmd.AddCommand(cli.buildTxCmd())      // tx
+	rootCmd.AddCommand(cli.buildAgentCmd())   // agent
+	rootCmd.AddCommand(cli.buildNetworkCmd()) // network
+	rootCmd.AddCommand(cli.buildPolicyCmd())  // policy
 
 	// Aux commands
 	rootCmd.AddCommand(cli.buildFriendbotCmd()) // friendbot
@@ -55,4 +73,8 @@ func (cli *CLI) buildRootCmd() {
 	// Alias commands
 	rootCmd.AddCommand(cli.buildAccountCmd()) // account
 	rootCmd.AddCommand(cli.buildAssetCmd())   // asset
+	rootCmd.AddCommand(cli.buildResolveCmd()) // resolve
+
+	// Plugins (lumen-<name> executables on PATH)
+	cli.addPluginCmds(rootCmd)
 }
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Completion scripts for each shell. They call "lumen __complete" with the
+// words on the command line, so values are completed from the store.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for lumen
+# Add to ~/.bashrc: source <(lumen completion bash)
+_lumen() {
+    local IFS=$'\n'
+    COMPREPLY=($(lumen __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _lumen lumen
+`,
+	"zsh": `#compdef lumen
+# zsh completion for lumen
+# Add to ~/.zshrc: source <(lumen completion zsh)
+_lumen() {
+    local -a candidates
+    candidates=(${(f)"$(lumen __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    compadd -- $candidates
+}
+compdef _lumen lumen
+`,
+	"fish": `# fish completion for lumen
+# Add to ~/.config/fish/completions/lumen.fish: lumen completion fish > ~/.config/fish/completions/lumen.fish
+function __lumen_complete
+    set -l words (commandline -opc)
+    set -e words[1]
+    lumen __complete $words (commandline -ct) 2>/dev/null
+end
+complete -c lumen -f -a '(__lumen_complete)'
+`,
+}
+
+// argCompletions are the kinds of values completed for the arguments of
+// commands, by position. A kind is "account", "asset", "namespace",
+// "network", or a list of choices separated by "|". If the last kind ends
+// with "...", it's used for the rest of the arguments.
+var argCompletions = map[string][]string{
+	"account address":     {"account"},
+	"account seed":        {"account"},
+	"account set":         {"account"},
+	"account del":         {"account"},
+	"agent add":           {"account..."},
+	"agent lock":          {"account..."},
+	"asset set":           {"asset", "account"},
+	"asset code":          {"asset"},
+	"asset issuer":        {"asset"},
+	"asset type":          {"asset"},
+	"asset del":           {"asset"},
+	"balance":             {"account", "asset"},
+	"data":                {"account"},
+	"dex trade":           {"account"},
+	"dex list":            {"account"},
+	"dex orderbook":       {"asset", "asset"},
+	"flags":               {"account", "none|auth_required|auth_revocable|auth_immutable..."},
+	"friendbot":           {"account"},
+	"info":                {"account"},
+	"network use":         {"network"},
+	"network rm":          {"network"},
+	"ns":                  {"namespace"},
+	"ns protect":          {"namespace"},
+	"ns unprotect":        {"namespace"},
+	"pay":                 {"", "asset"},
+	"policy set":          {"max-payment|daily-limit|destinations|forbidden-assets|require-signers"},
+	"policy del":          {"max-payment|daily-limit|destinations|forbidden-assets|require-signers", "asset"},
+	"resolve account":     {"account"},
+	"resolve asset":       {"asset"},
+	"signer add":          {"account"},
+	"signer remove":       {"account"},
+	"signer thresholds":   {"account"},
+	"signer masterweight": {"account"},
+	"signer list":         {"account"},
+	"trust create":        {"account", "asset"},
+	"trust remove":        {"account", "asset"},
+	"tx seq":              {"account"},
+	"watch":               {"payments|transactions|ledger", "account"},
+}
+
+// flagCompletions are the kinds of values completed for flags, by name, or
+// by command and name for flags that mean something else in a command.
+var flagCompletions = map[string]string{
+	"--buy":                "asset",
+	"--error-format":       "text|json",
+	"--from":               "account",
+	"--namespace":          "namespace",
+	"--network":            "network",
+	"--ns":                 "namespace",
+	"--output":             "json|yaml|table|template=",
+	"--path":               "asset",
+	"--sell":               "asset",
+	"--signers":            "account",
+	"--to":                 "account",
+	"--with":               "asset",
+	"store migrate --from": "",
+	"store migrate --to":   "",
+}
+
+func (cli *CLI) buildCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion [bash|zsh|fish]",
+		Short: "print the completion script for your shell",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			script, ok := completionScripts[args[0]]
+			if !ok {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "completion"}, "unrecognized shell: %s, expecting: bash|zsh|fish", args[0])
+				return
+			}
+
+			cli.showSuccess("%s", strings.TrimSuffix(script, "\n"))
+		},
+	}
+}
+
+// buildCompleteCmd returns the command used by the completion scripts. It
+// prints the completions of its last argument, one per line.
+func (cli *CLI) buildCompleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                "__complete [word]...",
+		Short:              "print completions for the command line",
+		Hidden:             true,
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			words, word := args, ""
+			if len(args) > 0 {
+				words, word = args[:len(args)-1], args[len(args)-1]
+			}
+
+			// Complete aliases in the namespace of the command line.
+			for i, w := range words {
+				if w == "--ns" && i+1 < len(words) {
+					cli.ns = words[i+1]
+				}
+			}
+
+			for _, candidate := range cli.completions(words, word) {
+				if strings.HasPrefix(candidate, word) {
+					cli.showSuccess("%s", candidate)
+				}
+			}
+		},
+	}
+}
+
+// completions returns the words that can follow words: subcommands, flags,
+// or values for flags and arguments, such as the names of accounts, assets,
+// namespaces, and networks. If word is in a comma-separated list, the values
+// are prefixed with the rest of the list.
+func (cli *CLI) completions(words []string, word string) []string {
+	if len(words) > 0 && words[0] == "lumen" {
+		words = words[1:]
+	}
+
+	// Find the command, and the number of arguments before word.
+	cmd, pos, flag := cli.rootCmd, 0, (*pflag.Flag)(nil)
+	for _, w := range words {
+		if flag != nil {
+			flag = nil
+			continue
+		}
+
+		if strings.HasPrefix(w, "-") {
+			if f := lookupFlag(cmd, w); f != nil && f.Value.Type() != "bool" && !strings.Contains(w, "=") {
+				flag = f
+			}
+			continue
+		}
+
+		if sub := findSubcommand(cmd, w); sub != nil && pos == 0 {
+			cmd = sub
+			continue
+		}
+
+		pos++
+	}
+
+	path := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+
+	candidates := []string{}
+	addFlag := func(flag *pflag.Flag) {
+		candidates = append(candidates, "--"+flag.Name)
+	}
+
+	switch {
+	case flag != nil:
+		kind, ok := flagCompletions[path+" --"+flag.Name]
+		if !ok {
+			kind = flagCompletions["--"+flag.Name]
+		}
+
+		candidates = cli.completionValues(kind)
+		if strings.HasPrefix(flag.Value.Type(), "string") && strings.HasSuffix(flag.Value.Type(), "Slice") {
+			if i := strings.LastIndex(word, ","); i >= 0 {
+				for j := range candidates {
+					candidates[j] = word[:i+1] + candidates[j]
+				}
+			}
+		}
+	case strings.HasPrefix(word, "-"):
+		cmd.NonInheritedFlags().VisitAll(addFlag)
+		cmd.InheritedFlags().VisitAll(addFlag)
+	case cmd.HasSubCommands() && pos == 0:
+		for _, sub := range cmd.Commands() {
+			if sub.IsAvailableCommand() {
+				candidates = append(candidates, sub.Name())
+			}
+		}
+
+		// Commands like "ns" take arguments as well as subcommands.
+		if kinds := argCompletions[path]; len(kinds) > 0 {
+			candidates = append(candidates, cli.completionValues(strings.TrimSuffix(kinds[0], "..."))...)
+		}
+	default:
+		kinds := argCompletions[path]
+		if len(kinds) > 0 && pos >= len(kinds) && strings.HasSuffix(kinds[len(kinds)-1], "...") {
+			pos = len(kinds) - 1
+		}
+
+		if pos < len(kinds) {
+			candidates = cli.completionValues(strings.TrimSuffix(kinds[pos], "..."))
+		}
+	}
+
+	sort.Strings(candidates)
+	unique := []string{}
+	for i, candidate := range candidates {
+		if i == 0 || candidate != candidates[i-1] {
+			unique = append(unique, candidate)
+		}
+	}
+
+	return unique
+}
+
+// completionValues returns the values of kind (see argCompletions.)
+func (cli *CLI) completionValues(kind string) []string {
+	values := []string{}
+	switch kind {
+	case "":
+	case "account", "asset":
+		values, _ = cli.listAliases(kind)
+	case "namespace":
+		values, _ = cli.listNamespaces()
+	case "network":
+		values = append(values, "test", "public")
+		if names, err := client.ListNetworks(cli.store); err == nil {
+			values = append(values, names...)
+		}
+		values = append(values, cli.config.networks()...)
+	default:
+		values = strings.Split(kind, "|")
+	}
+
+	return values
+}
+
+// findSubcommand returns the subcommand of cmd named name, if any.
+func findSubcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, sub := range cmd.Commands() {
+		if sub.Name() == name {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+// lookupFlag returns the flag of cmd in arg (e.g., --from or -o), if any.
+func lookupFlag(cmd *cobra.Command, arg string) *pflag.Flag {
+	name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+	if !strings.HasPrefix(arg, "--") {
+		if len(name) != 1 {
+			return nil
+		}
+
+		if flag := cmd.Flags().ShorthandLookup(name); flag != nil {
+			return flag
+		}
+		return cmd.InheritedFlags().ShorthandLookup(name)
+	}
+
+	if flag := cmd.Flags().Lookup(name); flag != nil {
+		return flag
+	}
+
+	return cmd.InheritedFlags().Lookup(name)
+}
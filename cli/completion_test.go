@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	cli, _ := newTestCLI()
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		output := cli.TestCommand("completion " + shell)
+		if !strings.Contains(output, "lumen __complete") {
+			t.Errorf("completion %s: want script, got %q", shell, output)
+		}
+	}
+
+	expectOutput(t, cli, "error", "completion tcsh")
+}
+
+func TestCompleteCmd(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4")
+	cli.TestCommand("account set mary GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("asset set USD GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("asset set EUR GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.RunContext(context.Background(), []string{"account", "set", "bob", "GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U", "--ns", "other"}, nil, nil)
+	cli.TestCommand("network add local --horizon http://localhost:8000 --passphrase local")
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"ba"}, []string{"balance"}},
+		{[]string{"account", ""}, []string{"address", "del", "list", "new", "seed", "set"}},
+		{[]string{"pay", "10", "--fr"}, []string{"--from"}},
+		{[]string{"pay", "10", "--from", ""}, []string{"mary", "mo"}},
+		{[]string{"pay", "10", "--from", "mo", "--to", "ma"}, []string{"mary"}},
+		{[]string{"pay", "10", ""}, []string{"EUR", "USD"}},
+		{[]string{"pay", "10", "--with", "U"}, []string{"USD"}},
+		{[]string{"pay", "10", "--path", "USD,"}, []string{"USD,EUR", "USD,USD"}},
+		{[]string{"balance", "m"}, []string{"mary", "mo"}},
+		{[]string{"balance", "mo", ""}, []string{"EUR", "USD"}},
+		{[]string{"balance", "mo", "USD", ""}, nil},
+		{[]string{"balance", "--ns", "other", ""}, []string{"bob"}},
+		{[]string{"-o", "json", "info", "m"}, []string{"mary", "mo"}},
+		{[]string{"ns", ""}, []string{"other", "protect", "test", "unprotect"}},
+		{[]string{"ns", "protect", ""}, []string{"other", "test"}},
+		{[]string{"--ns", "t"}, []string{"test"}},
+		{[]string{"network", "use", ""}, []string{"local", "public", "test"}},
+		{[]string{"--network", "l"}, []string{"local"}},
+		{[]string{"-o", "t"}, []string{"table", "template="}},
+		{[]string{"agent", "add", "mo", "m"}, []string{"mary", "mo"}},
+		{[]string{"store", "migrate", "--from", ""}, nil},
+		{[]string{"set", ""}, nil},
+		{[]string{"policy", "set", "d"}, []string{"daily-limit", "destinations"}},
+	}
+
+	for _, test := range tests {
+		output, err := cli.RunContext(context.Background(), append([]string{"__complete"}, test.args...), nil, nil)
+		if err != nil {
+			t.Errorf("(%v) completion failed: %v", test.args, err)
+			continue
+		}
+
+		got := strings.Fields(output)
+		if strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("(%v) want %v, got %v", test.args, test.want, got)
+		}
+	}
+}
@@ -3,50 +3,429 @@ package cli
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/0xfe/lumen/client"
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+// configKeys are the keys supported in the configuration file. A "*"
+// matches the name of a network or namespace.
+var configKeys = []string{
+	"storage.driver",
+	"storage.params",
+	"storage.passphrase_file",
+	"store.driver", // deprecated, use storage
+	"store.params", // deprecated, use storage
+	"verbose",
+	"log_format",
+	"network",
+	"namespace",
+	"fee",
+	"timeout",
+	"networks.*.horizon",
+	"networks.*.passphrase",
+	"networks.*.friendbot",
+	"namespaces.*.network",
+	"namespaces.*.fee",
+	"namespaces.*.timeout",
+}
+
 type config struct {
-	storageDriver string
-	storageParams string
-	verbose       bool
+	file string       // the configuration file, or "" if there isn't one
+	v    *viper.Viper // the contents of file
+
+	storageDriver  string
+	storageParams  string
+	passphraseFile string
+	verbose        bool
+	logFormat      string
+}
+
+// setting is the effective value of a configuration key, and where it came
+// from: "flag", "env", "store", "default", or the configuration file.
+type setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// setSetting records the effective value of key, for "config show".
+func (cli *CLI) setSetting(key, value, source string) {
+	for i := range cli.settings {
+		if cli.settings[i].Key == key {
+			cli.settings[i] = setting{key, value, source}
+			return
+		}
+	}
+
+	cli.settings = append(cli.settings, setting{key, value, source})
+}
+
+// source returns the source of the settings in the configuration file, or
+// in the overrides for namespace ns.
+func (c *config) source(ns string) string {
+	if ns != "" {
+		return fmt.Sprintf("file %s (namespaces.%s)", c.file, ns)
+	}
+
+	return fmt.Sprintf("file %s", c.file)
+}
+
+// lookup returns the value of key for namespace ns: the namespace's override,
+// if there is one, or else the top-level key. ok is false if neither is set.
+func (c *config) lookup(ns, key string) (value interface{}, source string, ok bool) {
+	if c == nil || c.v == nil {
+		return nil, "", false
+	}
+
+	if nsKey := fmt.Sprintf("namespaces.%s.%s", ns, key); ns != "" && c.v.IsSet(nsKey) {
+		return c.v.Get(nsKey), c.source(ns), true
+	}
+
+	if c.v.IsSet(key) {
+		return c.v.Get(key), c.source(""), true
+	}
+
+	return nil, "", false
+}
+
+// networks returns the names of the networks defined in the configuration
+// file, in sorted order.
+func (c *config) networks() []string {
+	names := []string{}
+	if c == nil || c.v == nil {
+		return names
+	}
+
+	for name := range c.v.GetStringMap("networks") {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
 }
 
-func readConfig(env string) config {
+// network returns the network profile name defined in the configuration
+// file, or nil if there isn't one.
+func (c *config) network(name string) *client.Network {
+	if c == nil || c.v == nil || !c.v.IsSet(fmt.Sprintf("networks.%s", name)) {
+		return nil
+	}
+
+	key := func(field string) string { return fmt.Sprintf("networks.%s.%s", name, field) }
+	return &client.Network{
+		Name:       name,
+		Horizon:    c.v.GetString(key("horizon")),
+		Passphrase: c.v.GetString(key("passphrase")),
+		Friendbot:  c.v.GetString(key("friendbot")),
+	}
+}
+
+// configFile returns the configuration file selected with --config or
+// $LUMEN_CONFIG, or "" to search for one.
+func (cli *CLI) configFile() string {
+	if cli.rootCmd.Flag("config").Changed {
+		file, _ := cli.rootCmd.Flags().GetString("config")
+		return file
+	}
+
+	return os.Getenv("LUMEN_CONFIG")
+}
+
+// readConfig reads and validates the configuration file. Without --config
+// (or $LUMEN_CONFIG), it's fine if there's no configuration file.
+func (cli *CLI) readConfig(env string) (*config, error) {
 	homeDir, _ := homedir.Dir()
 	filePath := fmt.Sprintf("%s%s%s", homeDir, string(os.PathSeparator), ".lumen-data.json")
 
-	config := config{
+	config := &config{
 		storageDriver: "file",
 		storageParams: filePath,
 		verbose:       false,
+		logFormat:     "text",
+	}
+
+	// Use a private viper instance, so concurrent commands don't share state.
+	v := viper.New()
+
+	if file := cli.configFile(); file != "" {
+		v.SetConfigFile(file)
+	} else {
+		switch env {
+		case "dev":
+			v.SetConfigName(".lumen-config-dev")
+		case "test":
+			v.SetConfigName(".lumen-config-test")
+		default: // also "prod"
+			v.SetConfigName(".lumen-config")
+		}
+
+		v.AddConfigPath(".")
+		v.AddConfigPath("..")
+		v.AddConfigPath(fmt.Sprintf("%s%s%s", homeDir, string(os.PathSeparator), ".lumen"))
+		v.AddConfigPath("/etc/lumen/")
 	}
 
-	switch env {
-	case "dev":
-		viper.SetConfigName(".lumen-config-dev")
-	case "test":
-		viper.SetConfigName(".lumen-config-test")
-	default: // also "prod"
-		viper.SetConfigName(".lumen-config")
+	err := v.ReadInConfig() // Find and read the config file
+
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		cli.logger.WithFields(logrus.Fields{"type": "config"}).Debugf("no config file found")
+		return config, nil
 	}
 
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("..")
-	viper.AddConfigPath(fmt.Sprintf("%s%s%s", homeDir, string(os.PathSeparator), ".lumen"))
-	viper.AddConfigPath("/etc/lumen/")
+	config.file = v.ConfigFileUsed()
+	if err != nil {
+		return config, errors.Wrapf(err, "can't read config file %s", config.file)
+	}
 
-	err := viper.ReadInConfig() // Find and read the config file
+	cli.logger.WithFields(logrus.Fields{"type": "config"}).Debugf("loaded config from file %s", config.file)
+	if err := checkConfig(v); err != nil {
+		return config, errors.Wrapf(err, "bad config file %s", config.file)
+	}
 
-	if err == nil {
-		logrus.WithFields(logrus.Fields{"type": "config"}).Debugf("loaded config from file %s", viper.ConfigFileUsed())
-		config.storageDriver = viper.GetString("storage.driver")
-		config.storageParams = viper.GetString("storage.params")
-		config.verbose = viper.GetBool("verbose")
+	// Older versions of the README documented "store" instead of "storage".
+	for _, field := range []string{"driver", "params"} {
+		if old, key := "store."+field, "storage."+field; v.IsSet(old) {
+			cli.logger.WithFields(logrus.Fields{"type": "config"}).Warnf("%s in %s is deprecated, use %s", old, config.file, key)
+			if !v.IsSet(key) {
+				v.Set(key, v.Get(old))
+			}
+		}
+	}
+
+	config.v = v
+	if v.IsSet("storage.driver") {
+		config.storageDriver = v.GetString("storage.driver")
+	}
+	if v.IsSet("storage.params") {
+		config.storageParams = v.GetString("storage.params")
+	}
+	if v.IsSet("log_format") {
+		config.logFormat = v.GetString("log_format")
 	}
+	config.passphraseFile = v.GetString("storage.passphrase_file")
+	config.verbose = v.GetBool("verbose")
 
-	return config
+	return config, nil
+}
+
+// checkConfig returns an error listing the unknown keys and bad values in
+// the configuration file read by v.
+func checkConfig(v *viper.Viper) error {
+	problems := []string{}
+
+	keys := v.AllKeys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pattern := matchConfigKey(key)
+		if pattern == "" {
+			problems = append(problems, fmt.Sprintf("unknown key: %s", key))
+			continue
+		}
+
+		if err := checkConfigValue(v, pattern, v.Get(key)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	for name := range v.GetStringMap("networks") {
+		for _, field := range []string{"horizon", "passphrase"} {
+			if key := fmt.Sprintf("networks.%s.%s", name, field); v.GetString(key) == "" {
+				problems = append(problems, fmt.Sprintf("missing key: %s", key))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// matchConfigKey returns the entry in configKeys that matches key, or "".
+func matchConfigKey(key string) string {
+	parts := strings.Split(key, ".")
+
+	for _, pattern := range configKeys {
+		patternParts := strings.Split(pattern, ".")
+		if len(patternParts) != len(parts) {
+			continue
+		}
+
+		match := true
+		for i := range parts {
+			if patternParts[i] != "*" && patternParts[i] != parts[i] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return pattern
+		}
+	}
+
+	return ""
+}
+
+// checkConfigValue returns an error if value isn't valid for the key matching
+// pattern.
+func checkConfigValue(v *viper.Viper, pattern string, value interface{}) error {
+	var err error
+
+	switch pattern[strings.LastIndex(pattern, ".")+1:] {
+	case "verbose":
+		_, err = cast.ToBoolE(value)
+	case "log_format":
+		if format := cast.ToString(value); format != "text" && format != "json" {
+			err = errors.Errorf("bad log format: %v, expecting: text|json", value)
+		}
+	case "network":
+		// Names of network profiles in the store can't be checked here.
+		if network := cast.ToString(value); network == "" || (strings.HasPrefix(network, "custom") && len(strings.SplitN(network, ";", 3)) != 3) {
+			err = errors.Errorf("bad network: %v, expecting: test|public|custom;url;passphrase, or a network name", value)
+		}
+	case "fee":
+		if fee, e := cast.ToIntE(value); e != nil || fee <= 0 {
+			err = errors.Errorf("bad fee: %v, expecting stroops per operation", value)
+		}
+	case "timeout":
+		_, err = parseTimeout(value)
+	default:
+		_, err = cast.ToStringE(value)
+	}
+
+	return err
+}
+
+// parseTimeout parses a timeout in the configuration file, e.g., "30s".
+func parseTimeout(value interface{}) (time.Duration, error) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, errors.Errorf("bad timeout: %v, expecting a duration, e.g., 30s", value)
+	}
+
+	timeout, err := time.ParseDuration(s)
+	if err != nil || timeout < 0 {
+		return 0, errors.Errorf("bad timeout: %v, expecting a duration, e.g., 30s", value)
+	}
+
+	return timeout, nil
+}
+
+// getSetting returns the effective value of the configuration key.
+func (cli *CLI) getSetting(key string) (string, bool) {
+	for _, s := range cli.settings {
+		if s.Key == key {
+			return s.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// setupSettings records the settings that are only in the configuration
+// file, for "config show".
+func (cli *CLI) setupSettings(cmd *cobra.Command) {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	if cmd.Flags().Changed("verbose") {
+		cli.setSetting("verbose", fmt.Sprintf("%t", verbose), "flag")
+	} else if _, source, ok := cli.config.lookup("", "verbose"); ok {
+		cli.setSetting("verbose", fmt.Sprintf("%t", cli.config.verbose), source)
+	} else {
+		cli.setSetting("verbose", "false", "default")
+	}
+
+	if _, source, ok := cli.config.lookup("", "log_format"); ok {
+		cli.setSetting("log_format", cli.config.logFormat, source)
+	} else {
+		cli.setSetting("log_format", cli.config.logFormat, "default")
+	}
+}
+
+// isConfigValidateCmd returns true for "lumen config validate", which runs
+// with a bad configuration file.
+func isConfigValidateCmd(cmd *cobra.Command) bool {
+	return cmd.Name() == "validate" && cmd.HasParent() && cmd.Parent().Name() == "config"
+}
+
+type configValidateResult struct {
+	File  string `json:"file"`
+	Valid bool   `json:"valid"`
+}
+
+func (cli *CLI) buildConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config [show|validate]",
+		Short: "show or check the configuration",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "config"}, "unrecognized config command: %s, expecting: show|validate", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(cli.buildConfigShowCmd())
+	cmd.AddCommand(cli.buildConfigValidateCmd())
+
+	return cmd
+}
+
+func (cli *CLI) buildConfigShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "show the effective configuration, and where each value comes from",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "config", "subcmd": "show"}
+
+			cli.showResult(logFields, cli.settings, func() {
+				rows := [][]string{}
+				for _, s := range cli.settings {
+					rows = append(rows, []string{s.Key, s.Value, s.Source})
+				}
+
+				cli.showTable([]string{"KEY", "VALUE", "SOURCE"}, rows)
+			})
+		},
+	}
+}
+
+func (cli *CLI) buildConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "check the configuration file for unknown keys and bad values",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "config", "subcmd": "validate"}
+
+			config, err := cli.readConfig(os.Getenv("LUMEN_ENV"))
+			if err != nil {
+				cli.errorKind(ErrConfig, logFields, "%v", err)
+				return
+			}
+
+			cli.showResult(logFields, configValidateResult{config.file, true}, func() {
+				if config.file == "" {
+					cli.showSuccess("no config file found")
+					return
+				}
+
+				cli.showSuccess("ok: %s", config.file)
+			})
+		},
+	}
 }
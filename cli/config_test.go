@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "lumen-config")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+
+	file := filepath.Join(dir, ".lumen-config.yml")
+	if err := ioutil.WriteFile(file, []byte(contents), 0600); err != nil {
+		t.Fatalf("can't write config: %v", err)
+	}
+
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestConfigShow(t *testing.T) {
+	file, cleanup := writeTestConfig(t, `
+namespace: team
+network: local
+fee: 200
+timeout: 10s
+networks:
+  local:
+    horizon: http://localhost:8000
+    passphrase: Standalone Network ; February 2017
+namespaces:
+  team:
+    fee: 300
+`)
+	defer cleanup()
+
+	cli, _ := newTestCLI()
+	output, err := cli.RunContext(context.Background(), []string{"--config", file, "config", "show", "-o", "json"}, nil, nil)
+	if err != nil {
+		t.Fatalf("config show: %v", err)
+	}
+
+	settings := []setting{}
+	if err := json.Unmarshal([]byte(output), &settings); err != nil {
+		t.Fatalf("config show: want JSON, got %q", output)
+	}
+
+	got := map[string]setting{}
+	for _, s := range settings {
+		got[s.Key] = s
+	}
+
+	want := []setting{
+		{"namespace", "team", "file " + file},
+		{"network", "local", "file " + file},
+		{"networks.local", "custom;http://localhost:8000;Standalone Network ; February 2017", "file " + file},
+		{"fee", "300", "file " + file + " (namespaces.team)"},
+		{"timeout", "10s", "file " + file},
+		{"log_format", "text", "default"},
+	}
+
+	for _, s := range want {
+		if got[s.Key] != s {
+			t.Errorf("config show: want %+v, got %+v", s, got[s.Key])
+		}
+	}
+
+	// Flags and the store take precedence over the configuration file.
+	cli.TestCommand("--config " + file + " set config:network fake --ns team")
+	expectOutput(t, cli, "fake store", "--config "+file+" config show -o 'template={{range .}}{{if eq .key \"network\"}}{{.value}} {{.source}}{{end}}{{end}}'")
+	expectOutput(t, cli, "public flag", "--config "+file+" --network public config show -o 'template={{range .}}{{if eq .key \"network\"}}{{.value}} {{.source}}{{end}}{{end}}'")
+}
+
+func TestConfigValidate(t *testing.T) {
+	file, cleanup := writeTestConfig(t, `
+store: /tmp/lumen.json
+fee: lots
+networks:
+  local:
+    horizon: http://localhost:8000
+namespaces:
+  team:
+    network: custom;http://localhost:8000
+`)
+	defer cleanup()
+
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	_, err := cli.RunContext(ctx, []string{"--config", file, "config", "validate"}, nil, nil)
+	cliErr, ok := err.(*Error)
+	if !ok || cliErr.Kind != ErrConfig || cliErr.ExitCode() != 8 {
+		t.Fatalf("config validate: want config error, got %v", err)
+	}
+
+	for _, problem := range []string{
+		"unknown key: store",
+		"fee: bad fee: lots",
+		"missing key: networks.local.passphrase",
+		"namespaces.team.network: bad network: custom;http://localhost:8000",
+	} {
+		if !strings.Contains(cliErr.Message, problem) {
+			t.Errorf("config validate: want %q in %q", problem, cliErr.Message)
+		}
+	}
+
+	// Other commands don't run with a bad configuration file.
+	if _, err := cli.RunContext(ctx, []string{"--config", file, "version"}, nil, nil); err == nil || err.(*Error).Kind != ErrConfig {
+		t.Errorf("version: want config error, got %v", err)
+	}
+
+	file, cleanup = writeTestConfig(t, "network: test\nverbose: false\n")
+	defer cleanup()
+
+	expectOutput(t, cli, "ok: "+file, "--config "+file+" config validate")
+	expectOutput(t, cli, "error", "--config /nonexistent/.lumen-config.yml config validate")
+
+	// The file is checked before the store is opened.
+	file, cleanup = writeTestConfig(t, "storage:\n  driver: nosuchdriver\n")
+	defer cleanup()
+
+	other := NewCLI()
+	expectOutput(t, other, "ok: "+file, "--config "+file+" config validate")
+	expectOutput(t, other, "error", "--config "+file+" version")
+}
+
+func TestConfigStoreAlias(t *testing.T) {
+	file, cleanup := writeTestConfig(t, `
+store:
+  driver: internal
+  params: ignored
+`)
+	defer cleanup()
+
+	cli := NewCLI()
+	expectOutput(t, cli, "internal file "+file, "--config "+file+" config show -o 'template={{range .}}{{if eq .key \"storage.driver\"}}{{.value}} {{.source}}{{end}}{{end}}'")
+}
@@ -1,11 +1,19 @@
 package cli
 
 import (
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// dataResult is the output of "data [account] [key]"
+type dataResult struct {
+	Account string `json:"account"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+}
+
 func (cli *CLI) buildDataCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "data [account] [key] [value] [--clear]",
@@ -17,53 +25,52 @@ func (cli *CLI) buildDataCmd() *cobra.Command {
 			key := args[1]
 			val := ""
 
-			seed, err := cli.ResolveAccount(logFields, account, "seed")
-
-			if err != nil {
-				cli.error(logFields, "invalid account: %s", account)
-				return
-			}
-
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate transaction: %v", err)
-				return
-			}
-
 			if len(args) > 2 {
 				val = args[2]
 			}
 
 			clear, _ := cmd.Flags().GetBool("clear")
 
+			var err error
 			if clear {
-				err = cli.ms.ClearData(seed, key, opts)
+				err = cli.submitTx(logFields, cmd, account, func(b client.Builder, source string, opts *microstellar.Options) error {
+					return b.ClearData(source, key, opts)
+				})
 			} else if val != "" {
-				err = cli.ms.SetData(seed, key, []byte(val), opts)
+				err = cli.submitTx(logFields, cmd, account, func(b client.Builder, source string, opts *microstellar.Options) error {
+					return b.SetData(source, key, []byte(val), opts)
+				})
 			} else {
 				address, err := cli.ResolveAccount(logFields, account, "address")
 				if err != nil {
-					cli.error(logFields, "invalid account: %s", account)
+					cli.errorKind(ErrResolution, logFields, "invalid account: %s", account)
+					return
+				}
+
+				if cli.offline {
+					cli.error(logFields, "could not load account %s: %v", account, client.ErrOffline)
 					return
 				}
 
 				a, err := cli.ms.LoadAccount(address)
 				if err != nil {
-					cli.error(logFields, "could not load account %s: %v", account, microstellar.ErrorString(err))
+					cli.error(logFields, "could not load account %s: %v", account, err)
 					return
 				}
 
 				val, ok := a.GetData(key)
 				if !ok {
-					cli.error(logFields, "key not found: %s", key)
+					cli.errorKind(ErrResolution, logFields, "key not found: %s", key)
 					return
 				} else {
-					showSuccess(string(val))
+					cli.showResult(logFields, dataResult{account, key, string(val)}, func() {
+						cli.showSuccess("%s", string(val))
+					})
 				}
 			}
 
 			if err != nil {
-				cli.error(logFields, "failed to update data for %s (%s): %v", account, key, microstellar.ErrorString(err))
+				cli.error(logFields, "failed to update data for %s (%s): %v", account, key, err)
 				return
 			}
 		},
@@ -1,8 +1,7 @@
 package cli
 
 import (
-	"encoding/json"
-
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -15,7 +14,7 @@ func (cli *CLI) buildDexCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				cli.error(logrus.Fields{"cmd": "signer"}, "unrecognized trade command: %s, expecting: trade|list", args[0])
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "dex"}, "unrecognized dex command: %s, expecting: trade|list|orderbook", args[0])
 				return
 			}
 		},
@@ -45,56 +44,24 @@ func (cli *CLI) buildDexTradeCmd() *cobra.Command {
 			delete, _ := cmd.Flags().GetString("delete")
 			isPassive, _ := cmd.Flags().GetBool("passive")
 
-			source, err := cli.ResolveAccount(logFields, account, "seed")
-			if err != nil {
-				cli.error(logFields, "invalid account: %s", account)
-				return
-			}
+			result, err := cli.client.ManageOffer(cli.ctx, client.OfferRequest{
+				Account:   account,
+				Buy:       buy,
+				Sell:      sell,
+				Amount:    amount,
+				Price:     price,
+				Passive:   isPassive,
+				Update:    update,
+				Delete:    delete,
+				TxOptions: cli.txOptions(cmd),
+			})
 
-			buyAsset, err := cli.ResolveAsset(buy)
 			if err != nil {
-				cli.error(logFields, "invalid buy asset: %s", buy)
+				cli.error(logFields, "failed to submit offer: %v", err)
 				return
 			}
 
-			sellAsset, err := cli.ResolveAsset(sell)
-			if err != nil {
-				cli.error(logFields, "invalid sell asset: %s", sell)
-				return
-			}
-
-			offerType := microstellar.OfferCreate
-			offerID := ""
-
-			if update != "" {
-				offerType = microstellar.OfferUpdate
-				offerID = update
-			} else if delete != "" {
-				offerType = microstellar.OfferDelete
-				offerID = delete
-			} else if isPassive {
-				offerType = microstellar.OfferCreatePassive
-			}
-
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate offer: %v", err)
-				return
-			}
-
-			err = cli.ms.ManageOffer(source, &microstellar.OfferParams{
-				OfferType:  offerType,
-				SellAsset:  sellAsset,
-				SellAmount: amount,
-				BuyAsset:   buyAsset,
-				Price:      price,
-				OfferID:    offerID,
-			}, opts)
-
-			if err != nil {
-				cli.error(logFields, "failed to submit offer: %v", microstellar.ErrorString(err))
-				return
-			}
+			cli.showTxResult(logFields, result)
 		},
 	}
 
@@ -127,7 +94,7 @@ func (cli *CLI) buildDexListCmd() *cobra.Command {
 			address, err := cli.ResolveAccount(logFields, name, "address")
 
 			if err != nil {
-				cli.error(logFields, "invalid account: %s", name)
+				cli.errorKind(ErrResolution, logFields, "invalid account: %s", name)
 				return
 			}
 
@@ -140,28 +107,21 @@ func (cli *CLI) buildDexListCmd() *cobra.Command {
 				sortOrder = microstellar.SortDescending
 			}
 
+			if cli.offline {
+				cli.error(logFields, "can't load offers: %v", client.ErrOffline)
+				return
+			}
+
 			opts := microstellar.Opts().WithLimit(limit).WithSortOrder(sortOrder).WithCursor(cursor)
 			offers, err := cli.ms.LoadOffers(address, opts)
 
 			if err != nil {
-				cli.error(logFields, "can't load offers: %v", microstellar.ErrorString(err))
+				cli.error(logFields, "can't load offers: %v", err)
 				return
 			}
 
-			format, err := cmd.Flags().GetString("format")
-
-			for _, offer := range offers {
-				if format == "json" {
-					data, err := json.MarshalIndent(offer, "", "  ")
-
-					if err != nil {
-						logrus.WithFields(logFields).Errorf("skipping bad data: %v", err)
-					} else {
-						showSuccess("%v", string(data))
-					}
-				} else if format == "struct" {
-					showSuccess("%+v", offer)
-				} else {
+			cli.showResult(logFields, offers, func() {
+				for _, offer := range offers {
 					buyingCode := offer.Buying.Code
 					sellingCode := offer.Selling.Code
 
@@ -173,14 +133,14 @@ func (cli *CLI) buildDexListCmd() *cobra.Command {
 						sellingCode = "xlm"
 					}
 
-					showSuccess("(%v) selling %s %s for %s at %s %s/%s",
+					cli.showSuccess("(%v) selling %s %s for %s at %s %s/%s",
 						offer.ID, offer.Amount, sellingCode, buyingCode, offer.Price, buyingCode, sellingCode)
 				}
-			}
+			})
 		},
 	}
 
-	cmd.Flags().String("format", "line", "output format (json, struct, line)")
+	addFormatAlias(cmd)
 	cmd.Flags().String("cursor", "", "start listing from paging token")
 	cmd.Flags().Uint("limit", 10, "return at most this many results")
 	cmd.Flags().Bool("desc", false, "descending order")
@@ -204,47 +164,40 @@ func (cli *CLI) buildDexOrderBookCmd() *cobra.Command {
 
 			sellAsset, err := cli.ResolveAsset(sellAssetName)
 			if err != nil {
-				cli.error(logFields, "invalid sell asset: %s", sellAssetName)
+				cli.errorKind(ErrResolution, logFields, "invalid sell asset: %s", sellAssetName)
 				return
 			}
 
 			buyAsset, err := cli.ResolveAsset(buyAssetName)
 			if err != nil {
-				cli.error(logFields, "invalid buy asset: %s", buyAssetName)
+				cli.errorKind(ErrResolution, logFields, "invalid buy asset: %s", buyAssetName)
+				return
+			}
+
+			if cli.offline {
+				cli.error(logFields, "can't load offers: %v", client.ErrOffline)
 				return
 			}
 
 			orderbook, err := cli.ms.LoadOrderBook(sellAsset, buyAsset, opts)
 
 			if err != nil {
-				cli.error(logFields, "can't load offers: %v", microstellar.ErrorString(err))
+				cli.error(logFields, "can't load offers: %v", err)
 				return
 			}
 
-			format, err := cmd.Flags().GetString("format")
-
-			if format == "json" {
-				data, err := json.MarshalIndent(*orderbook, "", "  ")
-
-				if err != nil {
-					cli.error(logFields, "got bad data: %v", err)
-					return
-				} else {
-					showSuccess("%v", string(data))
-				}
-			} else {
+			cli.showResult(logFields, orderbook, func() {
 				for _, ask := range orderbook.Asks {
-
-					showSuccess("ask: %s %s for %s %s/%s", ask.Amount, orderbook.Base.Code, ask.Price, orderbook.Counter.Code, orderbook.Base.Code)
+					cli.showSuccess("ask: %s %s for %s %s/%s", ask.Amount, orderbook.Base.Code, ask.Price, orderbook.Counter.Code, orderbook.Base.Code)
 				}
 				for _, bid := range orderbook.Bids {
-					showSuccess("bid: %s %s for %s %s/%s", bid.Amount, orderbook.Counter.Code, bid.Price, orderbook.Counter.Code, orderbook.Base.Code)
+					cli.showSuccess("bid: %s %s for %s %s/%s", bid.Amount, orderbook.Counter.Code, bid.Price, orderbook.Counter.Code, orderbook.Base.Code)
 				}
-			}
+			})
 		},
 	}
 
-	cmd.Flags().String("format", "line", "output format (json, struct, line)")
+	addFormatAlias(cmd)
 	cmd.Flags().Uint("limit", 10, "return at most this many results")
 
 	return cmd
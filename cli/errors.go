@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/stellar/go/clients/horizon"
+)
+
+// ErrorKind classifies the failure of a command. Each kind has its own exit
+// status, so scripts can tell, e.g., a bad alias from a network outage.
+type ErrorKind string
+
+// Error kinds, with their exit statuses.
+const (
+	ErrGeneral      ErrorKind = "error"         // 1: anything not listed below
+	ErrUsage        ErrorKind = "usage"         // 2: bad command, flag, or argument
+	ErrResolution   ErrorKind = "resolution"    // 3: unknown account, asset, or variable
+	ErrStore        ErrorKind = "store"         // 4: can't read or write the data store
+	ErrNetwork      ErrorKind = "network"       // 5: can't reach horizon, or horizon failed the request
+	ErrTxRejected   ErrorKind = "tx_rejected"   // 6: the network rejected the transaction
+	ErrTimeout      ErrorKind = "timeout"       // 7: the request timed out
+	ErrConfig       ErrorKind = "config"        // 8: bad configuration file
+	ErrAssertion    ErrorKind = "assertion"     // 9: an assertion in a script failed
+	ErrPolicy       ErrorKind = "policy"        // 10: the transaction violates the namespace's spending policy
+	ErrNotConfirmed ErrorKind = "not_confirmed" // 11: the transaction wasn't confirmed (or there was no terminal to ask on)
+)
+
+var exitCodes = map[ErrorKind]int{
+	ErrGeneral:      1,
+	ErrUsage:        2,
+	ErrResolution:   3,
+	ErrStore:        4,
+	ErrNetwork:      5,
+	ErrTxRejected:   6,
+	ErrTimeout:      7,
+	ErrConfig:       8,
+	ErrAssertion:    9,
+	ErrPolicy:       10,
+	ErrNotConfirmed: 11,
+}
+
+// ExitCode returns the exit status of the lumen command for errors of kind k.
+func (k ErrorKind) ExitCode() int {
+	if code, ok := exitCodes[k]; ok {
+		return code
+	}
+
+	return exitCodes[ErrGeneral]
+}
+
+// kindOfExitCode returns the kind of error with exit status code, or
+// ErrGeneral if there's none.
+func kindOfExitCode(code int) ErrorKind {
+	for kind, kindCode := range exitCodes {
+		if kindCode == code {
+			return kind
+		}
+	}
+
+	return ErrGeneral
+}
+
+// Error is returned by RunContext when a command fails.
+type Error struct {
+	Kind    ErrorKind `json:"kind"`
+	Cmd     string    `json:"cmd,omitempty"`    // the command that failed, e.g., "pay"
+	Subcmd  string    `json:"subcmd,omitempty"` // the subcommand, if any
+	Message string    `json:"message"`
+	Usage   bool      `json:"-"` // true if the command line was invalid (Kind is ErrUsage)
+
+	// Set if horizon returned an error. ResultCodes has the transaction and
+	// operation result codes (e.g., tx_bad_seq, op_underfunded) if the
+	// transaction was rejected.
+	Problem     *horizon.Problem                `json:"problem,omitempty"`
+	ResultCodes *horizon.TransactionResultCodes `json:"result_codes,omitempty"`
+
+	status int // exit status of a failed plugin, if any
+}
+
+func (e *Error) Error() string {
+	cmd := strings.TrimSpace(e.Cmd + " " + e.Subcmd)
+	if cmd == "" {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s: %s", cmd, e.Message)
+}
+
+// ExitCode returns the exit status of the lumen command for e.
+func (e *Error) ExitCode() int {
+	if e.status != 0 {
+		return e.status
+	}
+
+	return e.Kind.ExitCode()
+}
+
+// newError returns an Error of kind for a command, using the "cmd" and
+// "subcmd" log fields. Errors in args are formatted with
+// microstellar.ErrorString, and the first one sets the horizon problem, if any.
+func newError(kind ErrorKind, logFields logrus.Fields, msg string, args ...interface{}) *Error {
+	cmd, _ := logFields["cmd"].(string)
+	subcmd, _ := logFields["subcmd"].(string)
+
+	e := &Error{
+		Kind:   kind,
+		Cmd:    cmd,
+		Subcmd: subcmd,
+		Usage:  kind == ErrUsage,
+	}
+
+	var cause error
+	fmtArgs := make([]interface{}, len(args))
+	for i, arg := range args {
+		fmtArgs[i] = arg
+		if err, ok := arg.(error); ok {
+			fmtArgs[i] = microstellar.ErrorString(err)
+			if cause == nil {
+				cause = err
+			}
+		}
+	}
+
+	e.Message = fmt.Sprintf(msg, fmtArgs...)
+
+	if cause != nil {
+		errKind, herr := classifyError(cause)
+		if kind == ErrGeneral {
+			e.Kind = errKind
+		}
+
+		if herr != nil {
+			e.Problem = &herr.Problem
+			if codes, err := herr.ResultCodes(); err == nil {
+				e.ResultCodes = codes
+			}
+		}
+	}
+
+	return e
+}
+
+// newUsageError returns an Error for an invalid invocation of cmd.
+func newUsageError(cmd *cobra.Command, msg string) *Error {
+	name := ""
+	if cmd != nil && cmd.HasParent() {
+		name = strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	}
+
+	return &Error{
+		Kind:    ErrUsage,
+		Cmd:     name,
+		Message: msg,
+		Usage:   true,
+	}
+}
+
+// classifyError returns the kind of err, and the horizon error that caused
+// it, if any.
+func classifyError(err error) (ErrorKind, *horizon.Error) {
+	if client.IsResolveError(err) {
+		return ErrResolution, nil
+	}
+
+	if client.IsPolicyError(err) {
+		return ErrPolicy, nil
+	}
+
+	if client.IsOffline(err) {
+		return ErrNetwork, nil
+	}
+
+	cause := errors.Cause(err)
+	if _, ok := cause.(*errNotConfirmed); ok {
+		return ErrNotConfirmed, nil
+	}
+
+	if herr, ok := cause.(*horizon.Error); ok {
+		if _, err := herr.ResultCodes(); err == nil {
+			return ErrTxRejected, herr
+		}
+
+		switch herr.Problem.Status {
+		case http.StatusNotFound:
+			// The account (or other entity) doesn't exist on the network.
+			return ErrResolution, herr
+		case http.StatusGatewayTimeout:
+			return ErrTimeout, herr
+		}
+
+		return ErrNetwork, herr
+	}
+
+	if cause == context.DeadlineExceeded {
+		return ErrTimeout, nil
+	}
+
+	if nerr, ok := cause.(net.Error); ok {
+		if nerr.Timeout() {
+			return ErrTimeout, nil
+		}
+
+		return ErrNetwork, nil
+	}
+
+	return ErrGeneral, nil
+}
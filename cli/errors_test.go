@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizon"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorKinds(t *testing.T) {
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	cli.TestCommand("set config:network fake")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+
+	tests := []struct {
+		args     []string
+		kind     ErrorKind
+		exitCode int
+	}{
+		{[]string{"get", "--bad-flag"}, ErrUsage, 2},
+		{[]string{"signer", "bad"}, ErrUsage, 2},
+		{[]string{"--error-format", "xml", "version"}, ErrUsage, 2},
+		{[]string{"get", "nothing"}, ErrResolution, 3},
+		{[]string{"pay", "10", "--from", "mo", "--to", "nobody"}, ErrResolution, 3},
+		{[]string{"pay", "10", "USD", "--from", "mo", "--to", "mo"}, ErrResolution, 3},
+		{[]string{"account", "address", "nobody"}, ErrResolution, 3},
+	}
+
+	for _, test := range tests {
+		_, err := cli.RunContext(ctx, test.args, nil, nil)
+		cliErr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%v: want *Error, got %#v", test.args, err)
+			continue
+		}
+
+		if cliErr.Kind != test.kind || cliErr.ExitCode() != test.exitCode {
+			t.Errorf("%v: want %s (%d), got %s (%d): %v", test.args, test.kind, test.exitCode, cliErr.Kind, cliErr.ExitCode(), cliErr)
+		}
+	}
+
+	if _, err := cli.RunContext(ctx, []string{"pay", "10", "--from", "mo", "--to", "mo"}, nil, nil); err != nil {
+		t.Errorf("pay: want no error, got %v", err)
+	}
+}
+
+func TestErrorFormatJSON(t *testing.T) {
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	var stderr bytes.Buffer
+	_, err := cli.RunContext(ctx, []string{"--error-format", "json", "get", "nothing"}, nil, &stderr)
+	if err == nil {
+		t.Fatalf("get: want error")
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(stderr.Bytes(), &got); err != nil {
+		t.Fatalf("get: want JSON on stderr, got %q: %v", stderr.String(), err)
+	}
+
+	if got["kind"] != "resolution" || got["exit_code"] != float64(3) || got["cmd"] != "get" || got["message"] != "no such variable: nothing\n" {
+		t.Errorf("get: unexpected error: %v", got)
+	}
+
+	// Usage errors are JSON too, without the usage message.
+	stderr.Reset()
+	cli.RunContext(ctx, []string{"--error-format", "json", "get", "--bad-flag"}, nil, &stderr)
+	if err := json.Unmarshal(stderr.Bytes(), &got); err != nil || got["kind"] != "usage" {
+		t.Errorf("get --bad-flag: want JSON usage error, got %q", stderr.String())
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	rejected := &horizon.Error{Problem: horizon.Problem{
+		Status: 400,
+		Title:  "Transaction Failed",
+		Extras: map[string]json.RawMessage{
+			"result_codes": json.RawMessage(`{"transaction": "tx_failed", "operations": ["op_underfunded"]}`),
+		},
+	}}
+
+	tests := []struct {
+		err     error
+		kind    ErrorKind
+		horizon bool
+	}{
+		{errors.New("boom"), ErrGeneral, false},
+		{errors.Wrap(rejected, "could not submit transaction"), ErrTxRejected, true},
+		{&horizon.Error{Problem: horizon.Problem{Status: 404}}, ErrResolution, true},
+		{&horizon.Error{Problem: horizon.Problem{Status: 500}}, ErrNetwork, true},
+		{&horizon.Error{Problem: horizon.Problem{Status: 504}}, ErrTimeout, true},
+		{context.DeadlineExceeded, ErrTimeout, false},
+		{errors.Wrap(timeoutError{}, "can't load account"), ErrTimeout, false},
+	}
+
+	for _, test := range tests {
+		kind, herr := classifyError(test.err)
+		if kind != test.kind || (herr != nil) != test.horizon {
+			t.Errorf("%v: want %s, got %s (%v)", test.err, test.kind, kind, herr)
+		}
+	}
+
+	e := newError(ErrGeneral, nil, "payment failed: %v", errors.Wrap(rejected, "could not submit transaction"))
+	if e.Kind != ErrTxRejected || e.ResultCodes == nil || e.ResultCodes.OperationCodes[0] != "op_underfunded" {
+		t.Errorf("want tx_rejected with op_underfunded, got %+v", e)
+	}
+
+	if e.Message != "payment failed: 400: Transaction Failed (&{tx_failed [op_underfunded]})" {
+		t.Errorf("unexpected message: %s", e.Message)
+	}
+}
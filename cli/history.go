@@ -0,0 +1,339 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	historyPrefix = "global:history:"
+	historySeqKey = historyPrefix + "seq"
+	historyLimit  = 1000 // older entries are pruned
+)
+
+// historyEntry records a single mutation of the store. The previous value is
+// stored separately under historyValueKey(seq, key), except for seeds, which
+// aren't kept once they're changed or deleted.
+type historyEntry struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	NS      string    `json:"ns"`
+	Op      string    `json:"op"` // "set" or "del"
+	Key     string    `json:"key"`
+	Existed bool      `json:"existed"` // false if the key had no previous value
+	Command string    `json:"command"`
+}
+
+func historyEntryKey(seq int) string {
+	return fmt.Sprintf("%s%d", historyPrefix, seq)
+}
+
+func historyValueKey(seq int, key string) string {
+	return fmt.Sprintf("%s%d:%s", historyPrefix, seq, key)
+}
+
+// seedRE matches Stellar seeds, so they can be masked in command lines.
+var seedRE = regexp.MustCompile(`S[A-Z2-7]{55}`)
+
+func maskSeeds(s string) string {
+	return seedRE.ReplaceAllString(s, "S****")
+}
+
+// commandLine reconstructs the command line for cmd, with the flags that
+// were set.
+func commandLine(cmd *cobra.Command, args []string) string {
+	parts := append([]string{cmd.CommandPath()}, args...)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		parts = append(parts, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+
+	return strings.Join(parts, " ")
+}
+
+// rawStore returns the store underneath any encryption. History only holds
+// values that aren't encrypted.
+func (cli *CLI) rawStore() store.API {
+	if enc, ok := cli.store.(*store.Encrypted); ok {
+		return enc.Backend()
+	}
+
+	return cli.store
+}
+
+// recordHistory saves the current value of key before it's changed by op.
+func (cli *CLI) recordHistory(op string, key string) error {
+	raw := cli.rawStore()
+
+	prev, err := raw.Get(key)
+	if err != nil && op == "del" {
+		// Nothing to delete, nothing to undo.
+		return nil
+	}
+	existed := err == nil
+
+	// Other lumen processes can share the store, so the sequence number is
+	// allocated atomically by the store.
+	n, err := raw.Incr(historySeqKey)
+	if err != nil {
+		return errors.Wrap(err, "can't allocate history sequence")
+	}
+	seq := int(n)
+
+	entry := historyEntry{
+		Seq:     seq,
+		Time:    time.Now().UTC(),
+		NS:      strings.SplitN(key, ":", 2)[0],
+		Op:      op,
+		Key:     key,
+		Existed: existed,
+		Command: maskSeeds(cli.cmdLine),
+	}
+
+	if existed && !store.IsSecretKey(key) {
+		if err := raw.Set(historyValueKey(seq, key), prev, 0); err != nil {
+			return errors.Wrap(err, "can't save previous value")
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal history entry")
+	}
+
+	if err := raw.Set(historyEntryKey(seq), string(data), 0); err != nil {
+		return errors.Wrap(err, "can't save history entry")
+	}
+
+	if old, err := cli.getHistoryEntry(seq - historyLimit); err == nil {
+		raw.Delete(historyValueKey(old.Seq, old.Key))
+		raw.Delete(historyEntryKey(old.Seq))
+	}
+
+	return nil
+}
+
+// dropSecretHistory deletes any seeds kept in the history by older versions
+// of lumen, and returns keys without them.
+func (cli *CLI) dropSecretHistory(keys []string) ([]string, error) {
+	raw := cli.rawStore()
+	kept := []string{}
+	for _, k := range keys {
+		if strings.HasPrefix(k, historyPrefix) && store.IsSecretKey(k) {
+			if err := raw.Delete(k); err != nil {
+				return nil, errors.Wrapf(err, "can't delete %s", k)
+			}
+			continue
+		}
+
+		kept = append(kept, k)
+	}
+
+	return kept, nil
+}
+
+// setKey writes a store key, recording the change in the history.
+func (cli *CLI) setKey(key string, value string) error {
+	cli.shared.historyMu.Lock()
+	defer cli.shared.historyMu.Unlock()
+
+	if err := cli.recordHistory("set", key); err != nil {
+		cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "setKey"}).Warnf("could not record history: %v", err)
+	}
+
+	return cli.store.Set(key, value, 0)
+}
+
+// deleteKey deletes a store key, recording the change in the history.
+func (cli *CLI) deleteKey(key string) error {
+	cli.shared.historyMu.Lock()
+	defer cli.shared.historyMu.Unlock()
+
+	if err := cli.recordHistory("del", key); err != nil {
+		cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "deleteKey"}).Warnf("could not record history: %v", err)
+	}
+
+	return cli.store.Delete(key)
+}
+
+func (cli *CLI) getHistoryEntry(seq int) (*historyEntry, error) {
+	data, err := cli.rawStore().Get(historyEntryKey(seq))
+	if err != nil {
+		return nil, errors.Errorf("no history entry: %d", seq)
+	}
+
+	entry := &historyEntry{}
+	if err := json.Unmarshal([]byte(data), entry); err != nil {
+		return nil, errors.Wrapf(err, "bad history entry: %d", seq)
+	}
+
+	return entry, nil
+}
+
+// listHistory returns the most recent history entries, newest first.
+func (cli *CLI) listHistory(limit int) ([]*historyEntry, error) {
+	keys, err := cli.rawStore().Keys(historyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := []int{}
+	for _, k := range keys {
+		if seq, err := strconv.Atoi(strings.TrimPrefix(k, historyPrefix)); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(seqs)))
+
+	entries := []*historyEntry{}
+	for _, seq := range seqs {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+
+		entry, err := cli.getHistoryEntry(seq)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// previousValue returns the displayable previous value of entry, with seeds masked.
+func (cli *CLI) previousValue(entry *historyEntry) string {
+	if !entry.Existed {
+		return "-"
+	}
+
+	if store.IsSecretKey(entry.Key) {
+		return "********"
+	}
+
+	v, err := cli.rawStore().Get(historyValueKey(entry.Seq, entry.Key))
+	if err != nil {
+		return "?"
+	}
+
+	return v
+}
+
+type historyOutput struct {
+	*historyEntry
+	Previous string `json:"previous"`
+}
+
+func (cli *CLI) buildHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history [--limit n]",
+		Short: "show recent changes to the data store",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "history"}
+
+			limit, _ := cmd.Flags().GetInt("limit")
+			entries, err := cli.listHistory(limit)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not read history: %v", err)
+				return
+			}
+
+			output := []historyOutput{}
+			for _, entry := range entries {
+				output = append(output, historyOutput{entry, cli.previousValue(entry)})
+			}
+
+			cli.showResult(logFields, output, func() {
+				rows := [][]string{}
+				for _, entry := range output {
+					rows = append(rows, []string{
+						strconv.Itoa(entry.Seq),
+						entry.Time.Local().Format("2006-01-02 15:04:05"),
+						entry.NS,
+						entry.Op,
+						strings.TrimPrefix(entry.Key, entry.NS+":"),
+						entry.Previous,
+						entry.Command,
+					})
+				}
+
+				cli.showTable([]string{"SEQ", "TIME", "NS", "OP", "KEY", "PREVIOUS", "COMMAND"}, rows)
+			})
+		},
+	}
+
+	cmd.Flags().Int("limit", 20, "number of entries to show (0 for all)")
+	addFormatAlias(cmd)
+	return cmd
+}
+
+func (cli *CLI) buildUndoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "undo [seq]",
+		Short: "restore the value a key had before change [seq] (default: the last change)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "undo"}
+
+			var entry *historyEntry
+			if len(args) > 0 {
+				seq, err := strconv.Atoi(args[0])
+				if err != nil {
+					cli.errorKind(ErrUsage, logFields, "bad sequence number: %s", args[0])
+					return
+				}
+
+				if entry, err = cli.getHistoryEntry(seq); err != nil {
+					cli.error(logFields, "%v", err)
+					return
+				}
+			} else {
+				entries, err := cli.listHistory(1)
+				if err != nil || len(entries) == 0 {
+					cli.error(logFields, "nothing to undo")
+					return
+				}
+				entry = entries[0]
+			}
+
+			// Restoring a seed would need the old value, and deleting one
+			// would lose it for good.
+			if store.IsSecretKey(entry.Key) {
+				cli.error(logFields, "can't undo change %d: changes to seeds can't be undone", entry.Seq)
+				return
+			}
+
+			var err error
+			if entry.Existed {
+				var prev string
+				if prev, err = cli.rawStore().Get(historyValueKey(entry.Seq, entry.Key)); err != nil {
+					cli.error(logFields, "previous value for change %d is gone", entry.Seq)
+					return
+				}
+				err = cli.setKey(entry.Key, prev)
+			} else {
+				err = cli.deleteKey(entry.Key)
+			}
+
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not undo change %d: %v", entry.Seq, err)
+				return
+			}
+
+			cli.showResult(logFields, entry, func() {
+				cli.showSuccess("undid change %d (%s %s)", entry.Seq, entry.Op, entry.Key)
+			})
+		},
+	}
+}
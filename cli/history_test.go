@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/0xfe/lumen/store"
+)
+
+func TestHistoryUndo(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("account set mo GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U")
+	cli.TestCommand("account set kelly SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	cli.TestCommand("account del kelly")
+
+	got := cli.TestCommand("history")
+	if strings.Contains(got, "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU") {
+		t.Errorf("seed not masked in history: %v", got)
+	}
+
+	for _, want := range []string{
+		"account:mo:address",
+		"GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM",
+		"********",
+		"lumen account set kelly S****",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("history: want %v, got %v", want, got)
+		}
+	}
+
+	// Seeds aren't kept, so they can't be restored.
+	keys, _ := cli.rawStore().Keys("global:history:")
+	for _, k := range keys {
+		if store.IsSecretKey(k) {
+			t.Errorf("seed kept in history: %s", k)
+		}
+	}
+
+	expectOutput(t, cli, "error", "account seed kelly")
+	expectOutput(t, cli, "error", "undo")
+	expectOutput(t, cli, "error", "account seed kelly")
+
+	expectOutput(t, cli, "undid change 3 (set test:account:mo:address)", "undo 3")
+	expectOutput(t, cli, "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM", "account address mo")
+
+	// Undo the undo
+	expectOutput(t, cli, "undid change 6 (set test:account:mo:address)", "undo")
+	expectOutput(t, cli, "GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U", "account address mo")
+
+	expectOutput(t, cli, "error", "undo 100")
+}
+
+// Separate CLIs with their own file stores stand in for lumen processes
+// sharing a data file.
+func TestHistoryConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		cli := NewCLI()
+		s, err := store.NewFileStore(filepath.Join(dir, "data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli.SetStore(s)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cli.TestCommand(fmt.Sprintf("set var%d %d", i, i))
+		}(i)
+	}
+	wg.Wait()
+
+	cli := NewCLI()
+	s, _ := store.NewFileStore(filepath.Join(dir, "data"))
+	cli.SetStore(s)
+	expectOutput(t, cli, strconv.Itoa(n), "history --limit 0 -o 'template={{len .}}'")
+}
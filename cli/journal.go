@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// journalEntry records a transaction submitted in a namespace, with the
+// command that submitted it. Entries are stored as JSON under
+// journalEntryKey, in the namespace.
+type journalEntry struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	NS      string    `json:"ns"`
+	Network string    `json:"network"`
+	Command string    `json:"command"`
+	*client.Receipt
+}
+
+func journalPrefix(ns string) string {
+	return ns + ":journal:"
+}
+
+func journalSeqKey(ns string) string {
+	return journalPrefix(ns) + "seq"
+}
+
+func journalEntryKey(ns string, seq int) string {
+	return fmt.Sprintf("%s%d", journalPrefix(ns), seq)
+}
+
+// recordTx adds the receipt of a submitted transaction to the journal of the
+// current namespace. Failures are logged, since the transaction is already
+// submitted.
+func (cli *CLI) recordTx(receipt *client.Receipt) {
+	err := func() error {
+		// Other lumen processes can share the store, so the sequence number
+		// is allocated atomically by the store.
+		n, err := cli.store.Incr(journalSeqKey(cli.ns))
+		if err != nil {
+			return errors.Wrap(err, "can't allocate journal sequence")
+		}
+		seq := int(n)
+
+		network, _ := cli.getSetting("network")
+		entry := journalEntry{
+			Seq:     seq,
+			Time:    time.Now().UTC(),
+			NS:      cli.ns,
+			Network: network,
+			Command: maskSeeds(cli.cmdLine),
+			Receipt: receipt,
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return errors.Wrap(err, "can't marshal journal entry")
+		}
+
+		return cli.store.Set(journalEntryKey(cli.ns, seq), string(data), 0)
+	}()
+
+	if err != nil {
+		cli.logger.WithFields(logrus.Fields{"type": "cli", "method": "recordTx"}).Warnf("could not record transaction %s in journal: %v", receipt.Hash, err)
+	}
+}
+
+func (cli *CLI) getJournalEntry(seq int) (*journalEntry, error) {
+	data, err := cli.store.Get(journalEntryKey(cli.ns, seq))
+	if err != nil {
+		return nil, errors.Errorf("no transaction %d in namespace %s", seq, cli.ns)
+	}
+
+	entry := &journalEntry{}
+	if err := json.Unmarshal([]byte(data), entry); err != nil {
+		return nil, errors.Wrapf(err, "bad journal entry: %d", seq)
+	}
+
+	return entry, nil
+}
+
+// listJournal returns the journal entries of the current namespace, newest
+// first.
+func (cli *CLI) listJournal() ([]*journalEntry, error) {
+	prefix := journalPrefix(cli.ns)
+	keys, err := cli.store.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs := []int{}
+	for _, k := range keys {
+		if seq, err := strconv.Atoi(strings.TrimPrefix(k, prefix)); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(seqs)))
+
+	entries := []*journalEntry{}
+	for _, seq := range seqs {
+		entry, err := cli.getJournalEntry(seq)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// findJournalEntry returns the journal entry for hashOrSeq, a transaction
+// hash (or a prefix of one), or a sequence number.
+func (cli *CLI) findJournalEntry(hashOrSeq string) (*journalEntry, error) {
+	if seq, err := strconv.Atoi(hashOrSeq); err == nil {
+		return cli.getJournalEntry(seq)
+	}
+
+	entries, err := cli.listJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *journalEntry
+	for _, entry := range entries {
+		if entry.Hash != "" && strings.HasPrefix(entry.Hash, strings.ToLower(hashOrSeq)) {
+			if found != nil && found.Hash != entry.Hash {
+				return nil, errors.Errorf("ambiguous transaction hash: %s", hashOrSeq)
+			}
+
+			if found == nil {
+				found = entry
+			}
+		}
+	}
+
+	if found == nil {
+		return nil, errors.Errorf("no transaction %s in namespace %s", hashOrSeq, cli.ns)
+	}
+
+	return found, nil
+}
+
+// parseSince returns the time for since, which is a date (2006-01-02), a
+// time (RFC 3339), or a duration before now (e.g., 36h or 7d).
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+
+	if strings.HasSuffix(since, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(since, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(since); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, errors.Errorf("bad time: %s, expecting a date (2006-01-02), an RFC 3339 time, or a duration (e.g., 36h or 7d)", since)
+}
+
+func (cli *CLI) buildTxLogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "log [--limit n]",
+		Short: "list the transactions submitted in the namespace, newest first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "tx", "subcmd": "log"}
+
+			entries, err := cli.listJournal()
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not read journal: %v", err)
+				return
+			}
+
+			if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 && len(entries) > limit {
+				entries = entries[:limit]
+			}
+
+			cli.showResult(logFields, entries, func() {
+				rows := [][]string{}
+				for _, entry := range entries {
+					rows = append(rows, []string{
+						strconv.Itoa(entry.Seq),
+						entry.Time.Local().Format("2006-01-02 15:04:05"),
+						entry.Status,
+						entry.Hash,
+						strconv.Itoa(int(entry.Ledger)),
+						strconv.FormatInt(entry.Fee, 10),
+						entry.Command,
+					})
+				}
+
+				cli.showTable([]string{"SEQ", "TIME", "STATUS", "HASH", "LEDGER", "FEE", "COMMAND"}, rows)
+			})
+		},
+	}
+
+	cmd.Flags().Int("limit", 20, "number of transactions to show (0 for all)")
+	return cmd
+}
+
+func (cli *CLI) buildTxShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [hash|n]",
+		Short: "show a transaction from the journal of the namespace, by hash or number",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "tx", "subcmd": "show"}
+
+			entry, err := cli.findJournalEntry(args[0])
+			if err != nil {
+				cli.errorKind(ErrResolution, logFields, "%v", err)
+				return
+			}
+
+			cli.showResult(logFields, entry, func() {
+				fields := [][2]string{
+					{"seq", strconv.Itoa(entry.Seq)},
+					{"time", entry.Time.Local().Format(time.RFC3339)},
+					{"network", entry.Network},
+					{"command", entry.Command},
+					{"status", entry.Status},
+					{"hash", entry.Hash},
+					{"ledger", strconv.Itoa(int(entry.Ledger))},
+					{"fee", fmt.Sprintf("%d stroops", entry.Fee)},
+					{"error", entry.Error},
+					{"envelope", entry.Envelope},
+					{"result", entry.ResultXDR},
+				}
+
+				for _, field := range fields {
+					if field[1] != "" {
+						cli.showSuccess("%-9s %s", field[0]+":", field[1])
+					}
+				}
+			})
+		},
+	}
+}
+
+func (cli *CLI) buildTxExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [--since time]",
+		Short: "print the journal of the namespace as JSON lines, oldest first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "tx", "subcmd": "export"}
+
+			var since time.Time
+			if value, _ := cmd.Flags().GetString("since"); value != "" {
+				var err error
+				if since, err = parseSince(value, time.Now()); err != nil {
+					cli.errorKind(ErrUsage, logFields, "%v", err)
+					return
+				}
+			}
+
+			entries, err := cli.listJournal()
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not read journal: %v", err)
+				return
+			}
+
+			exported := []*journalEntry{}
+			for i := len(entries) - 1; i >= 0; i-- {
+				if !entries[i].Time.Before(since) {
+					exported = append(exported, entries[i])
+				}
+			}
+
+			cli.showResult(logFields, exported, func() {
+				for _, entry := range exported {
+					data, err := json.Marshal(entry)
+					if err != nil {
+						cli.error(logFields, "can't marshal output: %v", err)
+						return
+					}
+					cli.showSuccess("%s", data)
+				}
+			})
+		},
+	}
+
+	cmd.Flags().String("since", "", "only transactions since a date (2006-01-02), time (RFC 3339), or duration ago (e.g., 36h or 7d)")
+	return cmd
+}
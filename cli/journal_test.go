@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/0xfe/lumen/store"
+	"github.com/stellar/go/xdr"
+)
+
+func TestJournal(t *testing.T) {
+	resultXDR := func(code xdr.TransactionResultCode) string {
+		result := xdr.TransactionResult{FeeCharged: 100, Result: xdr.TransactionResultResult{Code: code}}
+		if code == xdr.TransactionResultCodeTxSuccess {
+			result.Result.Results = &[]xdr.OperationResult{}
+		}
+
+		data, _ := xdr.MarshalBase64(result)
+		return data
+	}
+
+	fail := false
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/transactions" && fail:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type": "transaction_failed", "title": "Transaction Failed", "status": 400,
+				"extras": {"result_codes": {"transaction": "tx_bad_seq"}, "result_xdr": "` + resultXDR(xdr.TransactionResultCodeTxBadSeq) + `"}}`))
+		case r.URL.Path == "/transactions":
+			w.Write([]byte(`{"hash": "c0ffee", "ledger": 42, "result_xdr": "` + resultXDR(xdr.TransactionResultCodeTxSuccess) + `"}`))
+		default:
+			address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+			w.Write([]byte(`{"id": "` + address + `", "account_id": "` + address + `", "sequence": "41",
+				"thresholds": {"low_threshold": 0, "med_threshold": 0, "high_threshold": 0},
+				"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+				"signers": [{"public_key": "` + address + `", "weight": 1, "key": "` + address + `"}]}`))
+		}
+	}))
+	defer horizon.Close()
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("network add local --horizon " + horizon.URL + " --passphrase local")
+	cli.TestCommand("network use local")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	cli.TestCommand("account set kelly GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+
+	expectOutput(t, cli, "[]", "tx log -o json")
+	expectOutput(t, cli, "c0ffee", "pay 10 --from mo --to kelly --memotext rent")
+	expectOutput(t, cli, "42 100", "pay 10 --from mo --to kelly -o 'template={{.ledger}} {{.fee}}'")
+
+	fail = true
+	expectOutput(t, cli, "error", "pay 20 --from mo --to kelly")
+
+	output := cli.TestCommand("tx log")
+	for _, want := range []string{"SEQ", "c0ffee", "failed", "lumen pay 10 --from=mo --memotext=rent --to=kelly"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("tx log: want %q in output, got %q", want, output)
+		}
+	}
+
+	// Transactions are found by number or hash (the newest, if it was
+	// submitted more than once.)
+	expectOutput(t, cli, "success c0ffee 42 100", "tx show 1 -o 'template={{.status}} {{.hash}} {{.ledger}} {{.fee}}'")
+	expectOutput(t, cli, "2", "tx show c0f -o template={{.seq}}")
+	expectOutput(t, cli, "failed 100 local", "tx show 3 -o 'template={{.status}} {{.fee}} {{.network}}'")
+	if output := cli.TestCommand("tx show 3"); !strings.Contains(output, "status:   failed\n") || !strings.Contains(output, "envelope: AAAA") {
+		t.Errorf("tx show: got %q", output)
+	}
+	expectOutput(t, cli, "error", "tx show 4")
+	expectOutput(t, cli, "error", "tx show beef")
+
+	// Failed transactions are hashed locally.
+	hash := strings.TrimSpace(cli.TestCommand("tx show 3 -o template={{.hash}}"))
+	if len(hash) != 64 {
+		t.Errorf("tx show: want hash of failed transaction, got %q", hash)
+	}
+
+	lines := strings.Split(strings.TrimSpace(cli.TestCommand("tx export")), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("tx export: want 3 lines, got %q", lines)
+	}
+
+	entry := journalEntry{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil || entry.Seq != 1 || entry.Hash != "c0ffee" || entry.Envelope == "" || entry.ResultXDR == "" {
+		t.Errorf("tx export: got %+v, %v", entry, err)
+	}
+
+	expectOutput(t, cli, "3", "tx export --since 1h -o 'template={{len .}}'")
+	expectOutput(t, cli, "0", "tx export --since "+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+" -o 'template={{len .}}'")
+	expectOutput(t, cli, "error", "tx export --since yesterday")
+
+	// Journals are per namespace.
+	cli.TestCommand("ns other")
+	expectOutput(t, cli, "[]", "tx log -o json")
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2018, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		since string
+		want  time.Time
+	}{
+		{"2018-03-01T10:00:00Z", time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{"36h", now.Add(-36 * time.Hour)},
+		{"7d", now.AddDate(0, 0, -7)},
+	}
+
+	for _, test := range tests {
+		if got, err := parseSince(test.since, now); err != nil || !got.Equal(test.want) {
+			t.Errorf("parseSince(%s): want %v, got %v, %v", test.since, test.want, got, err)
+		}
+	}
+
+	if got, err := parseSince("2018-03-01", now); err != nil || got.Format("2006-01-02 15:04") != "2018-03-01 00:00" {
+		t.Errorf("parseSince(2018-03-01): got %v, %v", got, err)
+	}
+
+	for _, since := range []string{"", "-1h", "soon", "2018-13-01"} {
+		if _, err := parseSince(since, now); err == nil {
+			t.Errorf("parseSince(%s): want error", since)
+		}
+	}
+}
+
+// Separate CLIs with their own file stores stand in for lumen processes
+// sharing a data file.
+func TestJournalConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		cli := NewCLI()
+		s, err := store.NewFileStore(filepath.Join(dir, "data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli.SetStore(s)
+		cli.ns = "test"
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cli.recordTx(&client.Receipt{Hash: fmt.Sprintf("%064x", i), Status: client.ReceiptSuccess})
+		}(i)
+	}
+	wg.Wait()
+
+	cli := NewCLI()
+	s, _ := store.NewFileStore(filepath.Join(dir, "data"))
+	cli.SetStore(s)
+	cli.TestCommand("ns test")
+	expectOutput(t, cli, strconv.Itoa(n), "tx log --limit 0 -o 'template={{len .}}'")
+}
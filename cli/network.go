@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// networkUseResult is the output of "network use"
+type networkUseResult struct {
+	Namespace string `json:"namespace"`
+	Network   string `json:"network"`
+}
+
+func (cli *CLI) buildNetworkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "network [add|list|use|rm]",
+		Short: "manage network profiles",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "network"}, "unrecognized network command: %s, expecting: add|list|use|rm", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(cli.buildNetworkAddCmd())
+	cmd.AddCommand(cli.buildNetworkListCmd())
+	cmd.AddCommand(cli.buildNetworkUseCmd())
+	cmd.AddCommand(cli.buildNetworkRmCmd())
+
+	return cmd
+}
+
+// validURL returns true if s is an http or https URL.
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (cli *CLI) buildNetworkAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add [name] --horizon url --passphrase passphrase [--friendbot url]",
+		Short: "add (or replace) network profile [name]",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			logFields := logrus.Fields{"cmd": "network", "subcmd": "add"}
+
+			if client.BuiltinNetwork(name) || strings.ContainsAny(name, ":;") {
+				cli.errorKind(ErrUsage, logFields, "bad network name: %s", name)
+				return
+			}
+
+			horizon, _ := cmd.Flags().GetString("horizon")
+			passphrase, _ := cmd.Flags().GetString("passphrase")
+			friendbot, _ := cmd.Flags().GetString("friendbot")
+
+			if !validURL(horizon) || passphrase == "" {
+				cli.errorKind(ErrUsage, logFields, "need --horizon url and --passphrase for network: %s", name)
+				return
+			}
+
+			if friendbot != "" && !validURL(friendbot) {
+				cli.errorKind(ErrUsage, logFields, "bad friendbot url: %s", friendbot)
+				return
+			}
+
+			network := client.Network{Name: name, Horizon: horizon, Passphrase: passphrase, Friendbot: friendbot}
+			fields := map[string]string{"horizon": horizon, "passphrase": passphrase, "friendbot": friendbot}
+			for _, field := range []string{"horizon", "passphrase", "friendbot"} {
+				key := client.NetworkKey(name, field)
+
+				var err error
+				if fields[field] != "" {
+					err = cli.setKey(key, fields[field])
+				} else if _, getErr := cli.store.Get(key); getErr == nil {
+					err = cli.deleteKey(key)
+				}
+
+				if err != nil {
+					cli.errorKind(ErrStore, logFields, "could not save network %s: %v", name, err)
+					return
+				}
+			}
+
+			cli.showResult(logFields, network, nil)
+		},
+	}
+
+	cmd.Flags().String("horizon", "", "URL of the horizon server")
+	cmd.Flags().String("passphrase", "", "network passphrase")
+	cmd.Flags().String("friendbot", "", "URL of the friendbot, for lumen friendbot")
+	return cmd
+}
+
+func (cli *CLI) buildNetworkListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "list network profiles",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "network", "subcmd": "list"}
+
+			names, err := client.ListNetworks(cli.store)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not list networks: %v", err)
+				return
+			}
+
+			networks := []client.Network{}
+			for _, name := range names {
+				network, err := client.LoadNetwork(cli.store, name)
+				if err != nil {
+					cli.logger.WithFields(logFields).Debugf("skipping network %s: %v", name, err)
+					continue
+				}
+				networks = append(networks, *network)
+			}
+
+			cli.showResult(logFields, networks, func() {
+				rows := [][]string{}
+				for _, network := range networks {
+					rows = append(rows, []string{network.Name, network.Horizon, network.Passphrase, network.Friendbot})
+				}
+
+				cli.showTable([]string{"NAME", "HORIZON", "PASSPHRASE", "FRIENDBOT"}, rows)
+			})
+		},
+	}
+}
+
+func (cli *CLI) buildNetworkUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use [name]",
+		Short: "use network [name] in the current namespace (test, public, or a profile)",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			logFields := logrus.Fields{"cmd": "network", "subcmd": "use"}
+
+			if !client.BuiltinNetwork(name) && cli.config.network(name) == nil {
+				if _, err := client.LoadNetwork(cli.store, name); err != nil {
+					cli.errorKind(ErrResolution, logFields, "%v", err)
+					return
+				}
+			}
+
+			if err := cli.SetVar("vars:config:network", name); err != nil {
+				cli.errorKind(ErrStore, logFields, "could not set network: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, networkUseResult{cli.ns, name}, nil)
+		},
+	}
+}
+
+func (cli *CLI) buildNetworkRmCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm [name]",
+		Short: "remove network profile [name]",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			logFields := logrus.Fields{"cmd": "network", "subcmd": "rm"}
+
+			network, err := client.LoadNetwork(cli.store, name)
+			if err != nil {
+				cli.errorKind(ErrResolution, logFields, "%v", err)
+				return
+			}
+
+			for _, field := range []string{"horizon", "passphrase", "friendbot"} {
+				key := client.NetworkKey(name, field)
+				if _, err := cli.store.Get(key); err != nil {
+					continue
+				}
+
+				if err := cli.deleteKey(key); err != nil {
+					cli.errorKind(ErrStore, logFields, "could not remove network %s: %v", name, err)
+					return
+				}
+			}
+
+			cli.showResult(logFields, network, nil)
+		},
+	}
+}
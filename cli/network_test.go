@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNetworkCmd(t *testing.T) {
+	friendbot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("funded " + r.URL.Query().Get("addr")))
+	}))
+	defer friendbot.Close()
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+
+	expectOutput(t, cli, "", "network add local --horizon http://localhost:8000 --passphrase 'Standalone Network ; February 2017' --friendbot "+friendbot.URL)
+	expectOutput(t, cli, "", "network add staging --horizon https://horizon.example.com --passphrase Staging")
+	expectOutput(t, cli, "local staging", "network list -o 'template={{range .}}{{.name}} {{end}}'")
+
+	expectOutput(t, cli, "error", "network add public --horizon https://horizon.example.com --passphrase Public")
+	expectOutput(t, cli, "error", "network add broken --horizon localhost --passphrase Broken")
+	expectOutput(t, cli, "error", "network use nowhere")
+
+	// Profiles are used by name, with --network or "network use".
+	expectOutput(t, cli, "", "network use local")
+	expectOutput(t, cli, "local", "get config:network")
+	expectOutput(t, cli, "funded GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4",
+		"friendbot GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4 -o template={{.response}}")
+	if cli.network != "custom;http://localhost:8000;Standalone Network ; February 2017" {
+		t.Errorf("network use local: got network %s", cli.network)
+	}
+
+	expectOutput(t, cli, "error", "friendbot GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4 --network staging")
+	if cli.network != "custom;https://horizon.example.com;Staging" {
+		t.Errorf("--network staging: got network %s", cli.network)
+	}
+
+	expectOutput(t, cli, "", "network rm staging")
+	expectOutput(t, cli, "local", "network list -o 'template={{range .}}{{.name}}{{end}}'")
+	expectOutput(t, cli, "error", "network rm staging")
+}
@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// outputFormat returns the value of --output: "" (the command's usual
+// output), "json", "yaml", "table", or "template=...".
+func (cli *CLI) outputFormat() string {
+	format, _ := cli.rootCmd.PersistentFlags().GetString("output")
+	return format
+}
+
+// formatAliases maps the values of the deprecated --format flag to --output.
+// The command-specific formats ("line", "struct") are the usual output.
+var formatAliases = map[string]string{"json": "json", "yaml": "yaml", "table": "", "line": "", "struct": ""}
+
+// addFormatAlias adds the deprecated --format flag to cmd. Some commands had
+// their own output formats before --output, and --format is now an alias for
+// it, so that old scripts keep working.
+func addFormatAlias(cmd *cobra.Command) {
+	cmd.Flags().String("format", "", "output format (deprecated, use --output)")
+	cmd.Flags().MarkDeprecated("format", "use --output instead")
+}
+
+// setupFormatAlias sets --output from the deprecated --format flag of cmd,
+// unless --output is also set.
+func (cli *CLI) setupFormatAlias(cmd *cobra.Command) error {
+	flag := cmd.Flags().Lookup("format")
+	if flag == nil || !flag.Changed || cli.rootCmd.PersistentFlags().Changed("output") {
+		return nil
+	}
+
+	output, ok := formatAliases[flag.Value.String()]
+	if !ok {
+		return errors.Errorf("bad --format: %s, expecting: json|yaml|table (or use --output)", flag.Value.String())
+	}
+
+	return cli.rootCmd.PersistentFlags().Set("output", output)
+}
+
+// checkOutputFormat returns an error if format is not a valid --output.
+func checkOutputFormat(format string) error {
+	switch {
+	case format == "", format == "json", format == "yaml", format == "table":
+		return nil
+	case strings.HasPrefix(format, "template="):
+		_, err := parseOutputTemplate(format)
+		return err
+	}
+
+	return errors.Errorf("bad --output: %s, expecting: json|yaml|table|template=...", format)
+}
+
+func parseOutputTemplate(format string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}
+
+	tmpl, err := template.New("output").Funcs(funcs).Parse(strings.TrimPrefix(format, "template="))
+	if err != nil {
+		return nil, errors.Wrap(err, "bad --output template")
+	}
+
+	return tmpl, nil
+}
+
+// showResult displays the result of a command in the format selected with
+// --output. Without --output, show displays the command's usual output (or
+// nothing, if show is nil.) All formats use the JSON field names of result.
+func (cli *CLI) showResult(logFields logrus.Fields, result interface{}, show func()) {
+	format := cli.outputFormat()
+	if format == "" {
+		if show != nil {
+			show()
+		}
+		return
+	}
+
+	var out bytes.Buffer
+	if err := writeResult(&out, result, format); err != nil {
+		cli.error(logFields, "can't format output: %v", err)
+		return
+	}
+
+	fmt.Fprint(cli.stdout, out.String())
+}
+
+// writeResult writes result to w in format (json, yaml, table, or
+// template=...), ending with a newline.
+func writeResult(w io.Writer, result interface{}, format string) error {
+	switch {
+	case format == "json":
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case format == "yaml":
+		generic, err := toGeneric(result)
+		if err != nil {
+			return err
+		}
+
+		data, err := yaml.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case format == "table":
+		header, rows := resultTable(result)
+		writeTable(w, header, rows)
+		return nil
+	case strings.HasPrefix(format, "template="):
+		tmpl, err := parseOutputTemplate(format)
+		if err != nil {
+			return err
+		}
+
+		generic, err := toGeneric(result)
+		if err != nil {
+			return err
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, generic); err != nil {
+			return err
+		}
+
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteString("\n")
+		}
+		_, err = w.Write(out.Bytes())
+		return err
+	}
+
+	return checkOutputFormat(format)
+}
+
+// writeTable writes rows as aligned columns under header.
+func writeTable(w io.Writer, header []string, rows [][]string) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// toGeneric converts v to the maps, slices, and values of its JSON
+// representation, so that YAML and templates use the JSON field names.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return fixNumbers(generic), nil
+}
+
+// fixNumbers replaces the json.Numbers in v with int64s or float64s.
+func fixNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fixNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = fixNumbers(e)
+		}
+	}
+
+	return v
+}
+
+// resultTable returns the table for result: a row for each element of a
+// slice, or a single row otherwise. The columns are the JSON fields of
+// structs, or the keys of maps.
+func resultTable(result interface{}) ([]string, [][]string) {
+	v := indirect(reflect.ValueOf(result))
+
+	items := []reflect.Value{v}
+	elemType := v.Type()
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		items = []reflect.Value{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, indirect(v.Index(i)))
+		}
+
+		elemType = v.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+	}
+
+	var header []string
+	if elemType.Kind() == reflect.Struct {
+		for _, field := range jsonFields(elemType) {
+			header = append(header, strings.ToUpper(field.name))
+		}
+	}
+
+	rows := [][]string{}
+	for _, item := range items {
+		switch item.Kind() {
+		case reflect.Struct:
+			row := []string{}
+			for _, field := range jsonFields(item.Type()) {
+				f, err := item.FieldByIndexErr(field.index)
+				if err != nil {
+					// Nil embedded struct
+					row = append(row, "")
+					continue
+				}
+				row = append(row, tableCell(f))
+			}
+			rows = append(rows, row)
+		case reflect.Map:
+			keys := []string{}
+			values := map[string]reflect.Value{}
+			for _, k := range item.MapKeys() {
+				key := fmt.Sprintf("%v", k.Interface())
+				keys = append(keys, key)
+				values[key] = item.MapIndex(k)
+			}
+			sort.Strings(keys)
+
+			header = []string{"KEY", "VALUE"}
+			for _, key := range keys {
+				rows = append(rows, []string{key, tableCell(values[key])})
+			}
+		default:
+			header = []string{"VALUE"}
+			rows = append(rows, []string{tableCell(item)})
+		}
+	}
+
+	return header, rows
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// tableCell returns the JSON representation of v, without quotes for strings.
+func tableCell(v reflect.Value) string {
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		return ""
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprintf("%v", v.Interface())
+	}
+
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return s
+	}
+
+	return string(data)
+}
+
+type jsonField struct {
+	name  string
+	index []int
+}
+
+// jsonFields returns the fields of struct type t that encoding/json
+// marshals, in order, including fields of embedded structs.
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				for _, embedded := range jsonFields(ft) {
+					embedded.index = append([]int{i}, embedded.index...)
+					fields = append(fields, embedded)
+				}
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, jsonField{name: name, index: []int{i}})
+	}
+
+	return fields
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestOutputFormats(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("set greeting hello")
+	cli.TestCommand("account set mo GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4")
+	cli.TestCommand("account set kelly SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+
+	expectOutput(t, cli, `{
+  "version": "v0.0"
+}`, "version --output json")
+	expectOutput(t, cli, `{
+  "namespace": "test"
+}`, "ns -o json")
+	expectOutput(t, cli, "name: greeting\nvalue: hello", "get greeting -o yaml")
+	expectOutput(t, cli, "hello!", "get greeting -o 'template={{.value}}!'")
+	expectOutput(t, cli, "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4", "account address mo -o template={{.address}}")
+	expectOutput(t, cli, "kelly mo", "account list -o 'template={{range .}}{{.name}} {{end}}'")
+
+	// Table columns are the JSON fields, in order.
+	expectOutput(t, cli, `NAME   ADDRESS                                                   HAS_SEED
+kelly                                                            true
+mo     GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4  false`, "account list -o table")
+
+	// Commands without output by default have results too.
+	expectOutput(t, cli, `{
+  "name": "bob",
+  "value": "1"
+}`, "set bob 1 -o json")
+
+	// Values aren't format strings.
+	cli.TestCommand("set memo '100%done'")
+	expectOutput(t, cli, "100%done", "get memo")
+	expectOutput(t, cli, `[
+  {
+    "name": "memo",
+    "value": "100%done"
+  }
+]`, "vars list memo --format json")
+
+	expectOutput(t, cli, "error", "version -o xml")
+	expectOutput(t, cli, "error", "version -o 'template={{.version'")
+
+	// --format is a deprecated alias for --output, on the commands that had it.
+	expectOutput(t, cli, "- name: memo\n  value: 100%done", "vars list memo --format yaml")
+	expectOutput(t, cli, "NAME  VALUE\nmemo  100%done", "vars list memo --format table")
+	expectOutput(t, cli, "1", "vars list memo --format json -o 'template={{len .}}'")
+	expectOutput(t, cli, "error", "vars list memo --format struct2")
+	expectOutput(t, cli, "error", "get memo --format json")
+}
+
+func TestOutputTxResult(t *testing.T) {
+	cli, _ := newTestCLI()
+	ctx := context.Background()
+
+	cli.TestCommand("set config:network fake")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	cli.TestCommand("account set kelly GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+
+	output, err := cli.RunContext(ctx, []string{"pay", "10", "--from", "mo", "--to", "kelly", "--nosubmit", "-o", "json"}, nil, nil)
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil || result["envelope"] == "" {
+		t.Errorf("pay: want envelope in JSON, got %q", output)
+	}
+
+	output, err = cli.RunContext(ctx, []string{"pay", "10", "--from", "mo", "--to", "kelly", "-o", "json"}, nil, nil)
+	if err != nil || output != "{}\n" {
+		t.Errorf("pay on fake network: want empty result, got %q, %v", output, err)
+	}
+}
+
+type testEmbedded struct {
+	A string `json:"a"`
+}
+
+type testResult struct {
+	*testEmbedded
+	B      int               `json:"b"`
+	C      []string          `json:"c,omitempty"`
+	Hidden string            `json:"-"`
+	M      map[string]string `json:"m"`
+}
+
+func TestWriteResult(t *testing.T) {
+	results := []testResult{
+		{&testEmbedded{"x"}, 1, []string{"p", "q"}, "hidden", nil},
+		{nil, 2, nil, "", map[string]string{"k": "v"}},
+	}
+
+	tests := []struct {
+		result interface{}
+		format string
+		want   string
+	}{
+		{results, "table", "A  B  C          M\nx  1  [\"p\",\"q\"]  \n   2             {\"k\":\"v\"}\n"},
+		{map[string]int{"z": 1, "a": 2}, "table", "KEY  VALUE\na    2\nz    1\n"},
+		{"hello", "table", "VALUE\nhello\n"},
+		{results[0], "yaml", "a: x\nb: 1\nc:\n- p\n- q\nm: null\n"},
+		{results, "template={{range .}}{{.b}}{{end}}", "12\n"},
+		{results[0], "template={{json .c}}", "[\"p\",\"q\"]\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := writeResult(&out, test.result, test.format); err != nil || out.String() != test.want {
+			t.Errorf("%s: want %q, got %q, %v", test.format, test.want, out.String(), err)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package cli
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
 
 // Note: add -v to any of these commands to enable verbose logging
 
@@ -55,3 +60,47 @@ func TestPathPayments(t *testing.T) {
 	expectOutput(t, cli, "error", "pay 4 USD --from mary --to kelly --with XLM --path EUR,INR")
 	expectOutput(t, cli, "error", "pay 4 USD --from mary --to kelly --with XLM --path BAD")
 }
+
+func TestPayDryRun(t *testing.T) {
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{"id": "` + address + `", "account_id": "` + address + `", "sequence": "41",
+			"thresholds": {"low_threshold": 1, "med_threshold": 1, "high_threshold": 2},
+			"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+			"signers": [{"public_key": "` + address + `", "weight": 1, "key": "` + address + `"}]}`))
+	}))
+	defer horizon.Close()
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("network add local --horizon " + horizon.URL + " --passphrase local")
+	cli.TestCommand("network use local")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	cli.TestCommand("account set kelly GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("asset set USD kelly")
+
+	output := cli.TestCommand("pay 10 USD --from mo --to kelly --memotext hi --dry-run")
+	for _, want := range []string{
+		"source:      mo (GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4)",
+		"sequence:    42",
+		"  1. pay 10 USD to kelly",
+		"fee:         100 stroops",
+		`memo:        text "hi"`,
+		"signers:     medium threshold, weight 1 required, 1 available",
+		"reserve:     0 XLM (0 subentries)",
+	} {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("pay --dry-run: want %q in output, got %q", want, output)
+		}
+	}
+
+	// Accounts without seeds can be previewed.
+	output = cli.TestCommand("--dry-run trust create kelly USD")
+	if !strings.Contains(output, "kelly (GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM), weight 1, no seed\n") ||
+		!strings.Contains(output, "reserve:     +0.5 XLM (+1 subentries)\n") {
+		t.Errorf("trust --dry-run: got %q", output)
+	}
+
+	expectOutput(t, cli, "manage_data", "data mo key value --dry-run -o 'template={{(index .preview.operations 0).type}}'")
+	expectOutput(t, cli, "error", "pay 10 --from mo --to nobody --dry-run")
+}
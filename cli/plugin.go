@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	pluginPrefix     = "lumen-" // plugins are executables named lumen-<name>
+	pluginAnnotation = "plugin" // annotates plugin commands with the plugin's path
+)
+
+// findPlugins returns the paths of the lumen-<name> executables on PATH, by
+// name. If there's more than one plugin with a name, the first one on PATH wins.
+func findPlugins() map[string]string {
+	plugins := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			if !strings.HasPrefix(file.Name(), pluginPrefix) {
+				continue
+			}
+
+			path := filepath.Join(dir, file.Name())
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+
+			name := strings.TrimPrefix(file.Name(), pluginPrefix)
+			if runtime.GOOS == "windows" {
+				if !strings.EqualFold(filepath.Ext(name), ".exe") {
+					continue
+				}
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else if info.Mode()&0111 == 0 {
+				continue
+			}
+
+			if _, ok := plugins[name]; !ok && name != "" {
+				plugins[name] = path
+			}
+		}
+	}
+
+	return plugins
+}
+
+// addPluginCmds adds a command for each plugin on PATH to rootCmd. Plugins
+// can't replace the built-in commands.
+func (cli *CLI) addPluginCmds(rootCmd *cobra.Command) {
+	cli.shared.pluginsOnce.Do(func() {
+		cli.shared.plugins = findPlugins()
+	})
+
+	names := []string{}
+	for name := range cli.shared.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if findSubcommand(rootCmd, name) != nil {
+			cli.logger.WithFields(logrus.Fields{"type": "plugin"}).Debugf("skipping plugin %s: it's a lumen command", cli.shared.plugins[name])
+			continue
+		}
+
+		rootCmd.AddCommand(cli.buildPluginCmd(name, cli.shared.plugins[name]))
+	}
+}
+
+func (cli *CLI) buildPluginCmd(name, path string) *cobra.Command {
+	return &cobra.Command{
+		Use:                name + " [args]...",
+		Short:              "run plugin " + path,
+		Annotations:        map[string]string{pluginAnnotation: path},
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": name}
+
+			plugin := exec.CommandContext(cli.ctx, path, cli.pluginArgs...)
+			plugin.Env = append(os.Environ(), cli.pluginEnv()...)
+			plugin.Stdin, plugin.Stdout, plugin.Stderr = os.Stdin, cli.stdout, cli.stderr
+
+			err := plugin.Run()
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				status := exitErr.ExitCode()
+				e := newError(kindOfExitCode(status), logFields, "plugin failed: %s", exitErr)
+				e.status = status
+				cli.showError(logFields, "%s", e.Message)
+				cli.fail(e)
+				return
+			}
+
+			if err != nil {
+				cli.error(logFields, "can't run plugin %s: %v", path, err)
+			}
+		},
+	}
+}
+
+// parseGlobalFlags sets lumen's global flags (e.g., --ns) in args, and returns
+// the rest of the arguments, for plugin commands. Arguments after "--" are
+// returned as is.
+func (cli *CLI) parseGlobalFlags(args []string) []string {
+	flags := cli.rootCmd.PersistentFlags()
+	rest := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			rest = append(rest, arg)
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			flag = flags.Lookup(parts[0])
+		} else if len(parts[0]) == 1 {
+			flag = flags.ShorthandLookup(parts[0])
+		}
+
+		if flag == nil {
+			rest = append(rest, arg)
+			continue
+		}
+
+		value := "true"
+		if len(parts) == 2 {
+			value = parts[1]
+		} else if flag.Value.Type() != "bool" && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+
+		if err := flags.Set(flag.Name, value); err != nil {
+			cli.logger.WithFields(logrus.Fields{"type": "plugin"}).Warnf("bad flag %s: %v", arg, err)
+		}
+	}
+
+	return rest
+}
+
+// pluginEnv returns the environment variables that pass the resolved context
+// of the command to plugins.
+func (cli *CLI) pluginEnv() []string {
+	network, _ := cli.getSetting("network")
+	env := []string{
+		"LUMEN_NS=" + cli.ns,
+		"LUMEN_NETWORK=" + cli.network,
+		"LUMEN_NETWORK_NAME=" + network,
+		"LUMEN_VERBOSE=" + strconv.FormatBool(cli.logger.Level >= logrus.DebugLevel),
+		"LUMEN_DRY_RUN=" + strconv.FormatBool(cli.dryRun),
+		"LUMEN_OFFLINE=" + strconv.FormatBool(cli.offline),
+	}
+
+	if driver, ok := cli.getSetting("storage.driver"); ok {
+		params, _ := cli.getSetting("storage.params")
+		env = append(env, "LUMEN_STORE="+driver+","+params)
+	}
+
+	if cli.config != nil && cli.config.file != "" {
+		env = append(env, "LUMEN_CONFIG="+cli.config.file)
+	}
+
+	if bin, err := os.Executable(); err == nil {
+		env = append(env, "LUMEN_BIN="+bin)
+	}
+
+	return env
+}
+
+// resolveAccountResult is the output of "resolve account"
+type resolveAccountResult struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+func (cli *CLI) buildResolveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resolve [account|asset] [name]",
+		Short: "resolve the name of an account or asset, e.g., for plugins",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "resolve"}, "unrecognized resolve command: %s, expecting: account|asset", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "account [name]",
+		Short: "print the address of account [name]",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			logFields := logrus.Fields{"cmd": "resolve", "subcmd": "account"}
+
+			address, err := cli.ResolveAccount(logFields, name, "address")
+			if err != nil {
+				cli.errorKind(ErrResolution, logFields, "could not resolve account %s: %v", name, err)
+				return
+			}
+
+			cli.showResult(logFields, resolveAccountResult{name, address}, func() {
+				cli.showSuccess("%s", address)
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "asset [name]",
+		Short: "print the code, issuer, and type of asset [name]",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			logFields := logrus.Fields{"cmd": "resolve", "subcmd": "asset"}
+
+			asset, err := cli.ResolveAsset(name)
+			if err != nil {
+				cli.errorKind(ErrResolution, logFields, "could not resolve asset %s: %v", name, err)
+				return
+			}
+
+			entry := newAssetEntry(name, asset)
+			cli.showResult(logFields, entry, func() {
+				fields := []string{}
+				for _, field := range []string{entry.Code, entry.Issuer, entry.Type} {
+					if field != "" {
+						fields = append(fields, field)
+					}
+				}
+
+				cli.showSuccess("%s", strings.Join(fields, " "))
+			})
+		},
+	})
+
+	return cmd
+}
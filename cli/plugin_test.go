@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin test uses a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "lumen-plugins")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	plugins := map[string]string{
+		"lumen-hello":   "#!/bin/sh\necho \"$LUMEN_NS $LUMEN_NETWORK_NAME $LUMEN_NETWORK $LUMEN_VERBOSE: $*\"\n",
+		"lumen-fail":    "#!/bin/sh\nexit 3\n",
+		"lumen-version": "#!/bin/sh\necho plugin\n",
+		"lumen-noexec":  "#!/bin/sh\necho noexec\n",
+	}
+
+	for name, script := range plugins {
+		mode := os.FileMode(0755)
+		if name == "lumen-noexec" {
+			mode = 0644
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), mode); err != nil {
+			t.Fatalf("can't write plugin: %v", err)
+		}
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns team")
+
+	// Global flags are parsed by lumen, and the rest go to the plugin.
+	expectOutput(t, cli, "team test test false: run --amount 10 --ns", "hello run --amount 10 -- --ns")
+	expectOutput(t, cli, "team public public false: --memo=hi", "hello --network public --memo=hi")
+	expectOutput(t, cli, "team custom;http://localhost:8000;Local custom;http://localhost:8000;Local false: x", "--network 'custom;http://localhost:8000;Local' hello x")
+
+	_, err = cli.RunContext(context.Background(), []string{"fail"}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || cliErr.Kind != ErrResolution || cliErr.ExitCode() != 3 {
+		t.Errorf("fail: want resolution error, got %v", err)
+	}
+
+	// Plugins don't replace lumen commands.
+	expectOutput(t, cli, cli.version, "version")
+	expectOutput(t, cli, "error", "noexec")
+}
+
+func TestResolveCmd(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4")
+	cli.TestCommand("asset set USD mo")
+
+	expectOutput(t, cli, "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4", "resolve account mo")
+	expectOutput(t, cli, "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM", "resolve account GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	expectOutput(t, cli, "USD GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4 credit_alphanum4", "resolve asset USD")
+	expectOutput(t, cli, "XLM native", "resolve asset native")
+	expectOutput(t, cli, "mo", "resolve account mo -o template={{.name}}")
+
+	expectOutput(t, cli, "error", "resolve account nobody")
+	expectOutput(t, cli, "error", "resolve asset EUR")
+	expectOutput(t, cli, "error", "resolve ledger")
+}
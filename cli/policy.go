@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/stellar/go/amount"
+)
+
+// policyRules are the rules of "policy set" and "policy del", and whether
+// they're set per asset.
+var policyRules = map[string]bool{
+	"max-payment":      true,
+	"daily-limit":      true,
+	"destinations":     false,
+	"forbidden-assets": false,
+	"require-signers":  false,
+}
+
+// policyRuleResult is the output of "policy set" and "policy del"
+type policyRuleResult struct {
+	Namespace string `json:"namespace"`
+	Rule      string `json:"rule"`
+	Asset     string `json:"asset,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// policyTestResult is the output of "policy test"
+type policyTestResult struct {
+	Allowed    bool     `json:"allowed"`
+	Violations []string `json:"violations"`
+}
+
+// policyKey returns the store key for rule (e.g., "max-payment") in the
+// current namespace.
+func (cli *CLI) policyKey(rule, asset string) string {
+	return client.PolicyKey(cli.ns, strings.Replace(rule, "-", "_", -1), asset)
+}
+
+// assetNames returns the aliases of assets in the current namespace, by
+// client.AssetKey.
+func (cli *CLI) assetNames() map[string]string {
+	names := map[string]string{"native": "XLM"}
+	aliases, _ := cli.listAliases("asset")
+	for _, alias := range aliases {
+		if asset, err := cli.ResolveAsset(alias); err == nil {
+			names[client.AssetKey(asset)] = alias
+		}
+	}
+
+	return names
+}
+
+func (cli *CLI) buildPolicyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy [set|del|show|test]",
+		Short: "manage the spending policy of the namespace",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "policy"}, "unrecognized policy command: %s, expecting: set|del|show|test", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(cli.buildPolicySetCmd())
+	cmd.AddCommand(cli.buildPolicyDelCmd())
+	cmd.AddCommand(cli.buildPolicyShowCmd())
+	cmd.AddCommand(cli.buildPolicyTestCmd())
+
+	return cmd
+}
+
+func (cli *CLI) buildPolicySetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use: "set [rule] [args]...",
+		Short: "set a rule of the spending policy: max-payment [asset] [amount], daily-limit [asset] [amount], " +
+			"destinations [account]..., forbidden-assets [asset]..., or require-signers [n]",
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			rule := args[0]
+			logFields := logrus.Fields{"cmd": "policy", "subcmd": "set"}
+
+			result := policyRuleResult{Namespace: cli.ns, Rule: rule}
+			switch rule {
+			case "max-payment", "daily-limit":
+				if len(args) != 3 {
+					cli.errorKind(ErrUsage, logFields, "usage: policy set %s [asset] [amount]", rule)
+					return
+				}
+
+				asset, err := cli.ResolveAsset(args[1])
+				if err != nil {
+					cli.errorKind(ErrResolution, logFields, "bad asset: %s", args[1])
+					return
+				}
+
+				if v, err := amount.Parse(args[2]); err != nil || v <= 0 {
+					cli.errorKind(ErrUsage, logFields, "bad amount: %s", args[2])
+					return
+				}
+
+				result.Asset, result.Value = client.AssetKey(asset), args[2]
+			case "destinations":
+				for _, name := range args[1:] {
+					if _, err := cli.ResolveAccount(logFields, name, "address"); err != nil {
+						cli.errorKind(ErrResolution, logFields, "bad destination: %s", name)
+						return
+					}
+				}
+
+				result.Value = strings.Join(args[1:], ",")
+			case "forbidden-assets":
+				keys := []string{}
+				for _, name := range args[1:] {
+					asset, err := cli.ResolveAsset(name)
+					if err != nil {
+						cli.errorKind(ErrResolution, logFields, "bad asset: %s", name)
+						return
+					}
+					keys = append(keys, client.AssetKey(asset))
+				}
+
+				result.Value = strings.Join(keys, ",")
+			case "require-signers":
+				if n, err := strconv.Atoi(args[1]); err != nil || n < 1 || len(args) != 2 {
+					cli.errorKind(ErrUsage, logFields, "usage: policy set require-signers [n], with n > 0")
+					return
+				}
+
+				result.Value = args[1]
+			default:
+				cli.errorKind(ErrUsage, logFields, "unrecognized rule: %s, expecting: max-payment|daily-limit|destinations|forbidden-assets|require-signers", rule)
+				return
+			}
+
+			if err := cli.setKey(cli.policyKey(rule, result.Asset), result.Value); err != nil {
+				cli.errorKind(ErrStore, logFields, "could not set policy: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, result, nil)
+		},
+	}
+}
+
+func (cli *CLI) buildPolicyDelCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "del [rule] [asset]",
+		Short: "remove a rule from the spending policy (max-payment and daily-limit take an asset)",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			rule := args[0]
+			logFields := logrus.Fields{"cmd": "policy", "subcmd": "del"}
+
+			perAsset, ok := policyRules[rule]
+			if !ok || perAsset != (len(args) == 2) {
+				cli.errorKind(ErrUsage, logFields, "usage: policy del [rule] [asset], with an asset only for max-payment and daily-limit")
+				return
+			}
+
+			result := policyRuleResult{Namespace: cli.ns, Rule: rule}
+			if perAsset {
+				asset, err := cli.ResolveAsset(args[1])
+				if err != nil {
+					cli.errorKind(ErrResolution, logFields, "bad asset: %s", args[1])
+					return
+				}
+				result.Asset = client.AssetKey(asset)
+			}
+
+			key := cli.policyKey(rule, result.Asset)
+			if _, err := cli.store.Get(key); err != nil {
+				cli.errorKind(ErrResolution, logFields, "no such rule: %s", strings.Join(args, " "))
+				return
+			}
+
+			if err := cli.deleteKey(key); err != nil {
+				cli.errorKind(ErrStore, logFields, "could not remove rule: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, result, nil)
+		},
+	}
+}
+
+func (cli *CLI) buildPolicyShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "show the spending policy of the namespace",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "policy", "subcmd": "show"}
+
+			policy, err := cli.client.Policy()
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "could not load policy: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, policy, func() {
+				if policy.Empty() {
+					cli.showSuccess("no policy in namespace %s", cli.ns)
+					return
+				}
+
+				names := cli.assetNames()
+				assetName := func(key string) string {
+					if name, ok := names[key]; ok {
+						return name
+					}
+					return key
+				}
+
+				rows := [][]string{}
+				for _, rule := range []struct {
+					name   string
+					limits map[string]string
+				}{{"max-payment", policy.MaxPayment}, {"daily-limit", policy.DailyLimit}} {
+					keys := []string{}
+					for key := range rule.limits {
+						keys = append(keys, key)
+					}
+					sort.Strings(keys)
+
+					for _, key := range keys {
+						rows = append(rows, []string{rule.name, rule.limits[key] + " " + assetName(key)})
+					}
+				}
+
+				if len(policy.Destinations) > 0 {
+					rows = append(rows, []string{"destinations", strings.Join(policy.Destinations, ", ")})
+				}
+
+				if len(policy.ForbiddenAssets) > 0 {
+					assets := []string{}
+					for _, key := range policy.ForbiddenAssets {
+						assets = append(assets, assetName(key))
+					}
+					rows = append(rows, []string{"forbidden-assets", strings.Join(assets, ", ")})
+				}
+
+				if policy.RequireSigners > 0 {
+					rows = append(rows, []string{"require-signers", strconv.Itoa(policy.RequireSigners)})
+				}
+
+				cli.showTable([]string{"RULE", "VALUE"}, rows)
+			})
+		},
+	}
+}
+
+func (cli *CLI) buildPolicyTestCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "test [base64-encoded transaction]",
+		Short: "check a transaction against the spending policy, without submitting it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "policy", "subcmd": "test"}
+
+			violations, err := cli.client.CheckPolicy(args[0])
+			if err != nil {
+				cli.errorKind(ErrUsage, logFields, "can't check transaction: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, policyTestResult{len(violations) == 0, violations}, func() {
+				if len(violations) == 0 {
+					cli.showSuccess("ok")
+				}
+			})
+
+			if len(violations) > 0 {
+				cli.errorKind(ErrPolicy, logFields, "%v", &client.PolicyError{Violations: violations})
+			}
+		},
+	}
+}
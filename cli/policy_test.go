@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			w.Write([]byte(`{"hash": "abcd", "ledger": 42}`))
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{"id": "` + address + `", "account_id": "` + address + `", "sequence": "41",
+			"thresholds": {"low_threshold": 0, "med_threshold": 0, "high_threshold": 0},
+			"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+			"signers": [{"public_key": "` + address + `", "weight": 1, "key": "` + address + `"}]}`))
+	}))
+	defer horizon.Close()
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("network add local --horizon " + horizon.URL + " --passphrase local")
+	cli.TestCommand("network use local")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	cli.TestCommand("account set kelly GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("account set bob GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U")
+	cli.TestCommand("asset set USD kelly")
+	cli.TestCommand("asset set EUR kelly")
+
+	expectOutput(t, cli, "no policy in namespace test", "policy show")
+
+	expectOutput(t, cli, "", "policy set max-payment USD 100")
+	expectOutput(t, cli, "", "policy set daily-limit native 15")
+	expectOutput(t, cli, "", "policy set destinations kelly mo")
+	expectOutput(t, cli, "", "policy set forbidden-assets EUR")
+	expectOutput(t, cli, "error", "policy set max-payment USD -1")
+	expectOutput(t, cli, "error", "policy set max-payment GBP 10")
+	expectOutput(t, cli, "error", "policy set destinations nobody")
+	expectOutput(t, cli, "error", "policy set require-signers zero")
+	expectOutput(t, cli, "error", "policy set speed 10")
+
+	output := cli.TestCommand("policy show")
+	for _, want := range []string{"max-payment       100 USD", "daily-limit       15 XLM", "destinations      kelly, mo", "forbidden-assets  EUR"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("policy show: want %q in output, got %q", want, output)
+		}
+	}
+	expectOutput(t, cli, "15", "policy show -o template={{.daily_limit.native}}")
+
+	// Violations return a policy error, and aren't submitted.
+	expectOutput(t, cli, "abcd", "pay 100 USD --from mo --to kelly")
+	_, err := cli.RunContext(context.Background(), []string{"pay", "101", "USD", "--from", "mo", "--to", "kelly"}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || cliErr.Kind != ErrPolicy || cliErr.ExitCode() != 10 ||
+		!strings.Contains(cliErr.Message, "payment of 101 USD to kelly is over the maximum of 100") {
+		t.Errorf("pay over maximum: want policy error, got %v", err)
+	}
+
+	expectOutput(t, cli, "error", "pay 1 --from mo --to bob")
+	expectOutput(t, cli, "error", "pay 1 EUR --from mo --to kelly")
+
+	// Daily limits count submitted payments.
+	expectOutput(t, cli, "abcd", "pay 10 --from mo --to kelly")
+	expectOutput(t, cli, "error", "pay 10 --from mo --to kelly")
+	if output := cli.TestCommand("pay 10 --from mo --to kelly --dry-run"); !strings.Contains(output, "policy:      violated\n  paying 10 XLM is over the daily limit of 15 (10 paid in the last 24h0m0s)\n") {
+		t.Errorf("pay --dry-run: want violation, got %q", output)
+	}
+
+	// policy test checks transactions without submitting them.
+	envelope := cli.TestCommand("pay 5 --from mo --to kelly --nosubmit")
+	expectOutput(t, cli, "ok", "policy test "+envelope)
+	expectOutput(t, cli, "", "policy set require-signers 2")
+	expectOutput(t, cli, "error", "policy test "+envelope)
+	expectOutput(t, cli, "error", "tx submit "+envelope)
+	if output := cli.TestCommand("policy test " + envelope + " -o json"); !strings.Contains(output, `"violations": [
+    "needs 2 signers, has 1"
+  ]`) {
+		t.Errorf("policy test -o json: want violations, got %q", output)
+	}
+	expectOutput(t, cli, "error", "policy test AAAA")
+
+	expectOutput(t, cli, "", "policy del require-signers")
+	expectOutput(t, cli, "", "policy del max-payment USD")
+	expectOutput(t, cli, "error", "policy del max-payment USD")
+	expectOutput(t, cli, "error", "policy del destinations kelly")
+	expectOutput(t, cli, "abcd", "pay 101 USD --from mo --to kelly")
+
+	// Policies are per namespace.
+	cli.TestCommand("ns other")
+	expectOutput(t, cli, "no policy in namespace other", "policy show")
+}
@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// scriptVarName matches valid script variable names.
+	scriptVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// scriptVarRef matches ${name} in script lines.
+	scriptVarRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+	// assertOps are the comparisons supported by assert.
+	assertOps = map[string]func(cmp int) bool{
+		"==": func(cmp int) bool { return cmp == 0 },
+		"!=": func(cmp int) bool { return cmp != 0 },
+		">=": func(cmp int) bool { return cmp >= 0 },
+		"<=": func(cmp int) bool { return cmp <= 0 },
+		">":  func(cmp int) bool { return cmp > 0 },
+		"<":  func(cmp int) bool { return cmp < 0 },
+	}
+)
+
+// runResult is the output of "run"
+type runResult struct {
+	Script   string `json:"script"`
+	Commands int    `json:"commands"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+func (cli *CLI) buildRunCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run [script] [--var name=value]...",
+		Short: "run the commands in [script] (- for stdin), stopping at the first error",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file := args[0]
+			logFields := logrus.Fields{"cmd": "run"}
+
+			if cli.inScript {
+				cli.errorKind(ErrUsage, logFields, "scripts can't run other scripts")
+				return
+			}
+
+			vars := map[string]string{}
+			varFlags, _ := cmd.Flags().GetStringArray("var")
+			for _, v := range varFlags {
+				parts := strings.SplitN(v, "=", 2)
+				if len(parts) != 2 || !scriptVarName.MatchString(parts[0]) {
+					cli.errorKind(ErrUsage, logFields, "bad --var: %s, expecting: name=value", v)
+					return
+				}
+
+				vars[parts[0]] = parts[1]
+			}
+
+			lines, err := readScript(file)
+			if err != nil {
+				cli.error(logFields, "can't read script: %v", err)
+				return
+			}
+
+			session := cli.newScriptSession(cli.dryRun)
+
+			count, scriptErr := session.runScript(file, lines, vars)
+			if scriptErr != nil {
+				scriptErr.Cmd, scriptErr.Subcmd = "run", ""
+				cli.showError(logFields, "%s", scriptErr.Message)
+				cli.fail(scriptErr)
+				return
+			}
+
+			cli.showResult(logFields, runResult{file, count, cli.dryRun}, nil)
+		},
+	}
+
+	cmd.Flags().StringArray("var", []string{}, "set script variable (name=value)")
+	return cmd
+}
+
+// readScript returns the lines of file, or of stdin if file is "-".
+func readScript(file string) ([]string, error) {
+	in := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines, scanner.Err()
+}
+
+// newScriptSession returns a session for the commands of a script. In a dry
+// run, changes to the store are kept in memory, and transactions are built but
+// not submitted.
+func (cli *CLI) newScriptSession(dryRun bool) *CLI {
+	session := cli.newShellSession()
+	session.inScript = true
+	session.testing = false // errors are reported by run
+	session.dryRunScript = dryRun
+
+	if dryRun {
+		session.store = store.NewOverlayStore(cli.rawStore())
+	}
+
+	return session
+}
+
+// runScript runs the lines of the script name, with the variables in vars, and
+// returns the number of commands run. Lines can be:
+//
+//	lumen commands, e.g., pay 10 --from ${src} --to bob
+//	let name = value
+//	let name = $(command), to capture the output of command
+//	assert command op value, where op is one of == != >= <= > <
+//
+// It stops at the first failed command or assertion.
+func (cli *CLI) runScript(name string, lines []string, vars map[string]string) (int, *Error) {
+	count := 0
+	for i, line := range lines {
+		fail := func(kind ErrorKind, msg string, args ...interface{}) (int, *Error) {
+			return count, newError(kind, nil, "%s:%d: %s", name, i+1, fmt.Sprintf(msg, args...))
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line, err := expandVars(line, vars)
+		if err != nil {
+			return fail(ErrResolution, "%v", err)
+		}
+
+		args, err := SplitCommand(line)
+		if err != nil {
+			return fail(ErrUsage, "%v", err)
+		}
+
+		if len(args) > 0 && args[0] == "lumen" {
+			args = args[1:]
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		count++
+		cli.logger.WithFields(logrus.Fields{"cmd": "run"}).Debugf("%s:%d: %s", name, i+1, line)
+
+		switch args[0] {
+		case "let":
+			if len(args) < 4 || args[2] != "=" || !scriptVarName.MatchString(args[1]) {
+				return fail(ErrUsage, "expecting: let name = value, or let name = $(command)")
+			}
+
+			value := strings.Join(args[3:], " ")
+			if cmdArgs, ok := subcommand(args[3:]); ok {
+				value, err = cli.capture(cmdArgs)
+				if err != nil {
+					return fail(err.(*Error).Kind, "%v", err)
+				}
+			}
+
+			vars[args[1]] = value
+		case "assert":
+			if len(args) < 4 || assertOps[args[len(args)-2]] == nil {
+				return fail(ErrUsage, "expecting: assert command op value, where op is one of: == != >= <= > <")
+			}
+
+			if cli.dryRun {
+				cli.logger.WithFields(logrus.Fields{"cmd": "run"}).Debugf("dry run: skipping assert")
+				continue
+			}
+
+			cmdArgs, op, want := args[1:len(args)-2], args[len(args)-2], args[len(args)-1]
+			got, err := cli.capture(cmdArgs)
+			if err != nil {
+				return fail(err.(*Error).Kind, "%v", err)
+			}
+
+			if !assertOps[op](compareValues(got, want)) {
+				return fail(ErrAssertion, "assertion failed: %s %s %s (got %s)", strings.Join(cmdArgs, " "), op, want, got)
+			}
+		default:
+			if err := cli.runArgs(args); err != nil {
+				return fail(err.(*Error).Kind, "%v", err)
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// expandVars replaces ${name} in line with the script variable name, or the
+// environment variable name.
+func expandVars(line string, vars map[string]string) (string, error) {
+	var err error
+	expanded := scriptVarRef.ReplaceAllStringFunc(line, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+
+		if err == nil {
+			err = errors.Errorf("undefined variable: %s", name)
+		}
+		return ref
+	})
+
+	return expanded, err
+}
+
+// subcommand returns the command in args, if args is of the form $(command).
+func subcommand(args []string) ([]string, bool) {
+	if !strings.HasPrefix(args[0], "$(") || !strings.HasSuffix(args[len(args)-1], ")") {
+		return nil, false
+	}
+
+	cmdArgs := append([]string{}, args...)
+	cmdArgs[0] = strings.TrimPrefix(cmdArgs[0], "$(")
+	cmdArgs[len(cmdArgs)-1] = strings.TrimSuffix(cmdArgs[len(cmdArgs)-1], ")")
+
+	words := []string{}
+	for _, arg := range cmdArgs {
+		if arg != "" {
+			words = append(words, arg)
+		}
+	}
+
+	return words, len(words) > 0
+}
+
+// capture runs args, and returns its trimmed output.
+func (cli *CLI) capture(args []string) (string, error) {
+	var output bytes.Buffer
+
+	stdout := cli.stdout
+	cli.stdout = &output
+	err := cli.runArgs(args)
+	cli.stdout = stdout
+
+	return strings.TrimSpace(output.String()), err
+}
+
+// compareValues compares a and b as numbers if they're both numbers, and as
+// strings otherwise. It returns -1, 0, or 1.
+func compareValues(a, b string) int {
+	x, okA := new(big.Rat).SetString(a)
+	y, okB := new(big.Rat).SetString(b)
+	if okA && okB {
+		return x.Cmp(y)
+	}
+
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestScript(t *testing.T, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "lumen-script")
+	if err != nil {
+		t.Fatalf("can't create temp dir: %v", err)
+	}
+
+	file := filepath.Join(dir, "test.lumen")
+	if err := ioutil.WriteFile(file, []byte(contents), 0600); err != nil {
+		t.Fatalf("can't write script: %v", err)
+	}
+
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestRun(t *testing.T) {
+	file, cleanup := writeTestScript(t, `
+# Set up a payment between two new accounts.
+ns scripts
+set config:network fake
+
+let bob = $(account new bob -o template={{.address}})
+account new mary
+let amount = 10
+pay ${amount} --from bob --to mary --memotext "${memo}"
+
+assert account address bob == ${bob}
+assert get vars:amount == 5
+lumen account address mary
+`)
+	defer cleanup()
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("set vars:amount 5 --ns scripts")
+
+	// memo isn't set.
+	if output := cli.TestCommand("run " + file); !strings.HasSuffix(output, "\nerror\n") {
+		t.Errorf("run: want error, got %q", output)
+	}
+	expectOutput(t, cli, "error", "run "+file+" --var memo=hello --var bad")
+
+	output := cli.TestCommand("run " + file + " --var memo=hello")
+	mary := cli.TestCommand("account address mary --ns scripts")
+	if mary == "error\n" || !strings.HasSuffix(output, "\n"+mary) {
+		t.Errorf("run: want output ending with %q, got %q", mary, output)
+	}
+
+	file, cleanup = writeTestScript(t, `
+ns scripts
+assert get vars:amount < 10
+set vars:amount 20
+assert get vars:amount > 10
+assert get vars:amount == 5
+set vars:amount 30
+`)
+	defer cleanup()
+
+	expectOutput(t, cli, "error", "run "+file)
+	expectOutput(t, cli, "20", "get vars:amount --ns scripts")
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		kind   ErrorKind
+	}{
+		{"version\nget ${nothing}", ErrResolution},
+		{"get nothing", ErrResolution},
+		{"let x 5", ErrUsage},
+		{"assert version 5", ErrUsage},
+		{"let v = $(version)\nassert version != ${v}", ErrAssertion},
+		{"run script.lumen", ErrUsage},
+		{"shell", ErrGeneral},
+	}
+
+	cli, _ := newTestCLI()
+	for _, test := range tests {
+		file, cleanup := writeTestScript(t, test.script)
+
+		_, err := cli.RunContext(context.Background(), []string{"run", file}, nil, nil)
+		if cliErr, ok := err.(*Error); !ok || cliErr.Kind != test.kind || cliErr.Cmd != "run" {
+			t.Errorf("(%q) want %s error, got %v", test.script, test.kind, err)
+		}
+
+		cleanup()
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	file, cleanup := writeTestScript(t, `
+ns dryrun
+set config:network fake
+account new mo
+let mo = $(account address mo)
+friendbot mo
+pay 10 --from mo --to GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U -o template={{.envelope}}
+assert balance mo >= 1000000
+account del mo
+assert get vars:nothing == ${mo}
+`)
+	defer cleanup()
+
+	cli, memStore := newTestCLI()
+	cli.TestCommand("ns default")
+
+	output := cli.TestCommand("run --dry-run " + file)
+	if output == "" || output == "error\n" {
+		t.Errorf("run --dry-run: want output, got %q", output)
+	}
+
+	// Nothing was saved.
+	keys, _ := memStore.Keys("dryrun:")
+	if len(keys) != 0 {
+		t.Errorf("run --dry-run: want no keys, got %v", keys)
+	}
+
+	expectOutput(t, cli, "default", "ns")
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSecretRefEnv(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo env:LUMEN_TEST_SEED")
+
+	expectOutput(t, cli, "error", "account seed mo")
+
+	os.Setenv("LUMEN_TEST_SEED", "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	defer os.Unsetenv("LUMEN_TEST_SEED")
+
+	expectOutput(t, cli, "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", "account seed mo")
+
+	seed, err := cli.ResolveAccount(logrus.Fields{}, "mo", "seed")
+	if err != nil || seed != "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU" {
+		t.Errorf("ResolveAccount: got %v, %v", seed, err)
+	}
+}
+
+func TestSecretRefExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("helper scripts need sh")
+	}
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+
+	// Bare output
+	cli.SetVar("account:mo:seed", "exec:echo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	expectOutput(t, cli, "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", "account seed mo")
+
+	// Full protocol: the helper only answers requests for "kelly" in "test"
+	cli.SetVar("account:kelly:seed", "exec:tr '\\n' ' ' | grep -q 'name=kelly namespace=test' && echo seed=SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	expectOutput(t, cli, "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", "account seed kelly")
+
+	cli.SetVar("account:bob:seed", "exec:grep -q name=kelly && echo seed=SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	expectOutput(t, cli, "error", "account seed bob")
+
+	cli.SetVar("account:bad:seed", "exec:echo notaseed")
+	expectOutput(t, cli, "error", "account seed bad")
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func (cli *CLI) buildShellCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell",
+		Short: "start an interactive session (exit with ctrl-d or exit)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "shell"}
+
+			if cli.inShell {
+				cli.error(logFields, "already in a shell")
+				return
+			}
+
+			if err := cli.runShell(os.Stdin); err != nil {
+				cli.error(logFields, "shell error: %v", err)
+			}
+		},
+	}
+}
+
+// newShellSession returns a copy of cli that runs the commands of a shell
+// session. The session keeps its store, configuration, and namespace between
+// commands.
+func (cli *CLI) newShellSession() *CLI {
+	session := cli.fork(cli.ctx, cli.stdout, cli.stderr)
+	session.inShell = true
+	session.logger = cli.logger
+	session.config = cli.config
+	session.ns, session.nsSource = cli.ns, cli.nsSource
+	session.settings = cli.settings
+	return session
+}
+
+// runShell runs the commands read from in. If in is a terminal, lines can be
+// edited, recalled with the arrow keys, and completed with tab.
+func (cli *CLI) runShell(in *os.File) error {
+	session := cli.newShellSession()
+
+	// Ctrl-C stops a running watch, instead of the shell.
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt)
+	defer func() {
+		signal.Stop(sigs)
+		close(done)
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				session.StopWatcher()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	fd := int(in.Fd())
+	if !terminal.IsTerminal(fd) {
+		scanner := bufio.NewScanner(in)
+		return session.shell(func() (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			return scanner.Text(), nil
+		})
+	}
+
+	term := terminal.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, cli.stdout}, "")
+
+	term.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+
+		newLine, newPos, candidates := session.completeLine(line, pos)
+		if len(candidates) > 1 && newLine == line {
+			fmt.Fprintln(term, strings.Join(candidates, "  "))
+		}
+		return newLine, newPos, true
+	}
+
+	return session.shell(func() (string, error) {
+		term.SetPrompt(session.shellPrompt())
+		if width, height, err := terminal.GetSize(fd); err == nil {
+			term.SetSize(width, height)
+		}
+
+		// Only read lines in raw mode, so commands write to a normal terminal.
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return "", err
+		}
+		defer terminal.Restore(fd, state)
+
+		return term.ReadLine()
+	})
+}
+
+// shell runs the lines returned by readLine as commands, until readLine
+// returns io.EOF, or the line is "exit" or "quit".
+func (cli *CLI) shell(readLine func() (string, error)) error {
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := SplitCommand(line)
+		if err != nil {
+			fmt.Fprintf(cli.stderr, "Error: %v\n", err)
+			continue
+		}
+
+		// Allow commands pasted with the program name.
+		if len(args) > 0 && args[0] == "lumen" {
+			args = args[1:]
+		}
+
+		cli.runArgs(args)
+	}
+}
+
+// runArgs runs a single command of a session, and returns its error, if any.
+func (cli *CLI) runArgs(args []string) error {
+	cli.rootCmd.SetArgs(args)
+	err := cli.execute()
+	cli.buildRootCmd()
+	return err
+}
+
+// shellPrompt returns the prompt, with the current namespace and network.
+func (cli *CLI) shellPrompt() string {
+	network, ok := cli.getSetting("network")
+	if !ok {
+		network = "test"
+	}
+
+	return fmt.Sprintf("lumen [%s@%s]> ", cli.ns, network)
+}
+
+// completeLine completes the word before pos in line with the name of a
+// command, flag, alias, or network. If there's more than one candidate, it
+// completes their common prefix, and returns them.
+func (cli *CLI) completeLine(line string, pos int) (string, int, []string) {
+	prefix := line[:pos]
+	words := strings.Fields(prefix)
+
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(prefix, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	matches := []string{}
+	for _, candidate := range cli.completions(words, word) {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	if len(matches) == 0 {
+		return line, pos, nil
+	}
+
+	completion := matches[0] + " "
+	if len(matches) > 1 {
+		completion = commonPrefix(matches)
+	}
+
+	newPrefix := prefix[:len(prefix)-len(word)] + completion
+	if len(matches) == 1 {
+		matches = nil
+	}
+
+	return newPrefix + line[pos:], len(newPrefix), matches
+}
+
+// commonPrefix returns the longest prefix of all of words.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestShell(t *testing.T) {
+	cli, _ := newTestCLI()
+
+	var output bytes.Buffer
+	cli.stdout, cli.stderr, cli.testing = &output, ioutil.Discard, true
+	cli.logger.Out = ioutil.Discard
+
+	lines := []string{
+		"ns shelltest",
+		"account set mo GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4",
+		"# comments and empty lines are skipped",
+		"",
+		"lumen account address mo",
+		"get 'unterminated",
+		"get nothing",
+		"shell",
+		"ns",
+		"exit",
+		"ns never",
+	}
+
+	session := cli.newShellSession()
+	err := session.shell(func() (string, error) {
+		if len(lines) == 0 {
+			return "", io.EOF
+		}
+
+		line := lines[0]
+		lines = lines[1:]
+		return line, nil
+	})
+
+	if err != nil || len(lines) != 1 {
+		t.Errorf("shell: want exit before last line, got %v, %v", lines, err)
+	}
+
+	want := "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4\nerror\nerror\nshelltest\n"
+	if output.String() != want {
+		t.Errorf("shell: want output %q, got %q", want, output.String())
+	}
+
+	if prompt := session.shellPrompt(); prompt != "lumen [shelltest@test]> " {
+		t.Errorf("shell: unexpected prompt %q", prompt)
+	}
+}
+
+func TestShellCompletion(t *testing.T) {
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4")
+	cli.TestCommand("account set mary GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("asset set USD GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("network add local --horizon http://localhost:8000 --passphrase local")
+
+	session := cli.newShellSession()
+
+	tests := []struct {
+		line       string
+		want       string
+		candidates []string
+	}{
+		{"acc", "account ", nil},
+		{"account a", "account address ", nil},
+		{"pay 10 U", "pay 10 USD ", nil},
+		{"pay 10 --fr", "pay 10 --from ", nil},
+		{"pay 10 --from m", "pay 10 --from m", []string{"mary", "mo"}},
+		{"pay 10 --from mo --network l", "pay 10 --from mo --network local ", nil},
+		{"network use ", "network use ", []string{"local", "public", "test"}},
+		{"xyz", "xyz", nil},
+	}
+
+	for _, test := range tests {
+		line, pos, candidates := session.completeLine(test.line, len(test.line))
+		if line != test.want || pos != len(test.want) || !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("(%s) want %q %v, got %q (%d) %v", test.line, test.want, test.candidates, line, pos, candidates)
+		}
+	}
+}
@@ -1,10 +1,9 @@
 package cli
 
 import (
-	"encoding/json"
-	"fmt"
 	"strconv"
 
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -17,7 +16,7 @@ func (cli *CLI) buildSignerCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				cli.error(logrus.Fields{"cmd": "signer"}, "unrecognized signer command: %s, expecting: list|add|remove|thresholds|masterweight", args[0])
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "signer"}, "unrecognized signer command: %s, expecting: list|add|remove|thresholds|masterweight", args[0])
 				return
 			}
 		},
@@ -45,34 +44,24 @@ func (cli *CLI) buildSignerAddCmd() *cobra.Command {
 			signer, err := cli.ResolveAccount(logFields, signerAddress, "address")
 
 			if err != nil {
-				cli.error(logFields, "invalid account: %s", signerAddress)
+				cli.errorKind(ErrResolution, logFields, "invalid account: %s", signerAddress)
 				return
 			}
 
 			to, _ := cmd.Flags().GetString("to")
 
-			signee, err := cli.ResolveAccount(logFields, to, "seed")
-
-			if err != nil {
-				cli.error(logFields, "invalid signee: %s", to)
-				return
-			}
-
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate transaction: %v", err)
-				return
-			}
-
 			intWeight, err := strconv.ParseUint(weight, 10, 32)
 			if err != nil {
-				cli.error(logFields, "invalid weight: %s", weight)
+				cli.errorKind(ErrUsage, logFields, "invalid weight: %s", weight)
 				return
 			}
 
-			err = cli.ms.AddSigner(signee, signer, uint32(intWeight), opts)
+			err = cli.submitTx(logFields, cmd, to, func(b client.Builder, signee string, opts *microstellar.Options) error {
+				return b.AddSigner(signee, signer, uint32(intWeight), opts)
+			})
+
 			if err != nil {
-				cli.error(logFields, "failed to add signer %s to %s: %v", signerAddress, to, microstellar.ErrorString(err))
+				cli.error(logFields, "failed to add signer %s to %s: %v", signerAddress, to, err)
 				return
 			}
 		},
@@ -97,28 +86,18 @@ func (cli *CLI) buildSignerRemoveCmd() *cobra.Command {
 			signer, err := cli.ResolveAccount(logFields, signerAddress, "address")
 
 			if err != nil {
-				cli.error(logFields, "invalid account: %s", signerAddress)
+				cli.errorKind(ErrResolution, logFields, "invalid account: %s", signerAddress)
 				return
 			}
 
 			from, _ := cmd.Flags().GetString("from")
 
-			signee, err := cli.ResolveAccount(logFields, from, "seed")
+			err = cli.submitTx(logFields, cmd, from, func(b client.Builder, signee string, opts *microstellar.Options) error {
+				return b.RemoveSigner(signee, signer, opts)
+			})
 
 			if err != nil {
-				cli.error(logFields, "invalid signee: %s", from)
-				return
-			}
-
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate transaction: %v", err)
-				return
-			}
-
-			err = cli.ms.RemoveSigner(signee, signer, opts)
-			if err != nil {
-				cli.error(logFields, "failed to remove signer %s from %s: %v", signerAddress, from, microstellar.ErrorString(err))
+				cli.error(logFields, "failed to remove signer %s from %s: %v", signerAddress, from, err)
 				return
 			}
 		},
@@ -143,43 +122,34 @@ func (cli *CLI) buildSignerThresholdsCmd() *cobra.Command {
 			highString := args[3]
 
 			logFields := logrus.Fields{"cmd": "signer", "subcmd": "thresholds"}
-			address, err := cli.ResolveAccount(logFields, account, "seed")
-
-			if err != nil {
-				cli.error(logFields, "invalid account: %s", account)
-				return
-			}
 
 			low, err := strconv.ParseUint(lowString, 10, 32)
 			if err != nil {
-				logrus.WithFields(logFields).Errorf("threshold parse error: %v", err)
-				cli.error(logFields, "bad threshold (low): %s", lowString)
+				cli.logger.WithFields(logFields).Errorf("threshold parse error: %v", err)
+				cli.errorKind(ErrUsage, logFields, "bad threshold (low): %s", lowString)
 				return
 			}
 
 			medium, err := strconv.ParseUint(mediumString, 10, 32)
 			if err != nil {
-				logrus.WithFields(logFields).Errorf("threshold parse error: %v", err)
-				cli.error(logFields, "bad threshold (medium): %s", mediumString)
+				cli.logger.WithFields(logFields).Errorf("threshold parse error: %v", err)
+				cli.errorKind(ErrUsage, logFields, "bad threshold (medium): %s", mediumString)
 				return
 			}
 
 			high, err := strconv.ParseUint(highString, 10, 32)
 			if err != nil {
-				logrus.WithFields(logFields).Errorf("threshold parse error: %v", err)
-				cli.error(logFields, "bad threshold (high): %s", highString)
+				cli.logger.WithFields(logFields).Errorf("threshold parse error: %v", err)
+				cli.errorKind(ErrUsage, logFields, "bad threshold (high): %s", highString)
 				return
 			}
 
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate transaction: %v", err)
-				return
-			}
+			err = cli.submitTx(logFields, cmd, account, func(b client.Builder, source string, opts *microstellar.Options) error {
+				return b.SetThresholds(source, uint32(low), uint32(medium), uint32(high), opts)
+			})
 
-			err = cli.ms.SetThresholds(address, uint32(low), uint32(medium), uint32(high), opts)
 			if err != nil {
-				cli.error(logFields, "failed to set thresholds for %s: %v", account, microstellar.ErrorString(err))
+				cli.error(logFields, "failed to set thresholds for %s: %v", account, err)
 				return
 			}
 		},
@@ -189,6 +159,12 @@ func (cli *CLI) buildSignerThresholdsCmd() *cobra.Command {
 	return cmd
 }
 
+// masterWeightResult is the output of "signer masterweight [account]"
+type masterWeightResult struct {
+	Address string `json:"address"`
+	Weight  int32  `json:"weight"`
+}
+
 func (cli *CLI) buildSignerMasterWeightCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "masterweight [account] [weight]",
@@ -199,30 +175,20 @@ func (cli *CLI) buildSignerMasterWeightCmd() *cobra.Command {
 			logFields := logrus.Fields{"cmd": "signer", "subcmd": "masterweight"}
 
 			if len(args) > 1 {
-				source, err := cli.ResolveAccount(logFields, account, "seed")
-
-				if err != nil {
-					cli.error(logFields, "invalid account: %s", account)
-					return
-				}
-
 				weightString := args[1]
 				weight, err := strconv.ParseUint(weightString, 10, 32)
 				if err != nil {
-					logrus.WithFields(logFields).Errorf("error parsing weight: %v", err)
-					cli.error(logFields, "bad weight: %s", weightString)
+					cli.logger.WithFields(logFields).Errorf("error parsing weight: %v", err)
+					cli.errorKind(ErrUsage, logFields, "bad weight: %s", weightString)
 					return
 				}
 
-				opts, err := cli.genTxOptions(cmd, logFields)
-				if err != nil {
-					cli.error(logFields, "can't generate transaction: %v", err)
-					return
-				}
+				err = cli.submitTx(logFields, cmd, account, func(b client.Builder, source string, opts *microstellar.Options) error {
+					return b.SetMasterWeight(source, uint32(weight), opts)
+				})
 
-				err = cli.ms.SetMasterWeight(source, uint32(weight), opts)
 				if err != nil {
-					cli.error(logFields, "failed to set master weight of %s to %s: %v", account, weightString, microstellar.ErrorString(err))
+					cli.error(logFields, "failed to set master weight of %s to %s: %v", account, weightString, err)
 					return
 				}
 			} else {
@@ -231,7 +197,10 @@ func (cli *CLI) buildSignerMasterWeightCmd() *cobra.Command {
 					return
 				}
 
-				showSuccess(fmt.Sprintf("%d", account.GetMasterWeight()))
+				weight := account.GetMasterWeight()
+				cli.showResult(logFields, masterWeightResult{account.Address, weight}, func() {
+					cli.showSuccess("%d", weight)
+				})
 			}
 		},
 	}
@@ -253,24 +222,14 @@ func (cli *CLI) buildSignerListCmd() *cobra.Command {
 				return
 			}
 
-			format, _ := cmd.Flags().GetString("format")
-
-			if format == "json" {
-				jsonSigners, err := json.MarshalIndent(account.Signers, "", "  ")
-				if err != nil {
-					cli.error(logFields, "can't marshall signers: %v", err)
-					return
-				}
-
-				showSuccess(string(jsonSigners))
-			} else {
+			cli.showResult(logFields, account.Signers, func() {
 				for _, signer := range account.Signers {
-					showSuccess("address:%s weight:%d", signer.PublicKey, signer.Weight)
+					cli.showSuccess("address:%s weight:%d", signer.PublicKey, signer.Weight)
 				}
-			}
+			})
 		},
 	}
 
-	cmd.Flags().String("format", "", "output format (json,line)")
+	addFormatAlias(cmd)
 	return cmd
 }
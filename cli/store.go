@@ -0,0 +1,469 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/0xfe/lumen/client"
+	"github.com/0xfe/lumen/store"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// passphraseFunc returns a function that reads a passphrase from the environment
+// variable envVar, the file named file, or the terminal, in that order. If confirm
+// is set, terminal users must type it twice.
+func (cli *CLI) passphraseFunc(envVar, file string, confirm bool) store.PassphraseFunc {
+	return func() (string, error) {
+		if pass := os.Getenv(envVar); pass != "" {
+			cli.debugf(logrus.Fields{"type": "passphrase"}, "using passphrase from env %s", envVar)
+			return pass, nil
+		}
+
+		if file != "" {
+			cli.debugf(logrus.Fields{"type": "passphrase"}, "reading passphrase from file %s", file)
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return "", errors.Wrapf(err, "can't read passphrase file")
+			}
+
+			return strings.TrimSpace(string(data)), nil
+		}
+
+		return cli.promptPassphrase("Passphrase: ", confirm)
+	}
+}
+
+// promptPassphrase reads a passphrase from the terminal without echoing it.
+func (cli *CLI) promptPassphrase(prompt string, confirm bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if cli.testing || !terminal.IsTerminal(fd) {
+		return "", errors.Errorf("no passphrase: set LUMEN_PASSPHRASE or LUMEN_PASSPHRASE_FILE")
+	}
+
+	fmt.Fprint(cli.stderr, prompt)
+	pass, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(cli.stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "can't read passphrase")
+	}
+
+	if len(pass) == 0 {
+		return "", errors.Errorf("empty passphrase")
+	}
+
+	if confirm {
+		fmt.Fprint(cli.stderr, "Confirm passphrase: ")
+		again, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(cli.stderr)
+		if err != nil {
+			return "", errors.Wrap(err, "can't read passphrase")
+		}
+
+		if string(again) != string(pass) {
+			return "", errors.Errorf("passphrases don't match")
+		}
+	}
+
+	return string(pass), nil
+}
+
+// encryptedStore returns the encrypted store wrapper and all the keys in its
+// backend, for in-place conversion.
+func (cli *CLI) encryptedStore() (*store.Encrypted, []string, error) {
+	enc, ok := cli.store.(*store.Encrypted)
+	if !ok {
+		return nil, nil, errors.Errorf("store does not support encryption")
+	}
+
+	keys, err := enc.Keys("")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't list keys")
+	}
+
+	// Seeds in the history would keep their old encryption.
+	if keys, err = cli.dropSecretHistory(keys); err != nil {
+		return nil, nil, errors.Wrap(err, "can't clear history")
+	}
+
+	return enc, keys, nil
+}
+
+func (cli *CLI) buildStoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "store [encrypt|rekey|export|import|migrate]",
+		Short: "manage the data store",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "store"}, "unrecognized store command: %s, expecting: encrypt|rekey|export|import|migrate", args[0])
+				return
+			}
+		},
+	}
+
+	cmd.AddCommand(cli.buildStoreEncryptCmd())
+	cmd.AddCommand(cli.buildStoreRekeyCmd())
+	cmd.AddCommand(cli.buildStoreExportCmd())
+	cmd.AddCommand(cli.buildStoreImportCmd())
+	cmd.AddCommand(cli.buildStoreMigrateCmd())
+
+	return cmd
+}
+
+func (cli *CLI) buildStoreEncryptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "encrypt all seeds in the data store with a passphrase",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "store", "subcmd": "encrypt"}
+
+			enc, keys, err := cli.encryptedStore()
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't encrypt store: %v", err)
+				return
+			}
+
+			if enc.Enabled() {
+				cli.error(logFields, "store is already encrypted, use: lumen store rekey")
+				return
+			}
+
+			// Ask for confirmation, since this is a new passphrase.
+			enc = store.NewEncryptedStore(enc.Backend(), cli.passphraseFunc("LUMEN_PASSPHRASE", cli.passphraseFile, true))
+			count, err := enc.Convert(keys, "")
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't encrypt store: %v", err)
+				return
+			}
+
+			cli.store = enc
+			cli.showResult(logFields, seedsResult{count}, func() {
+				cli.showSuccess("encrypted %d seeds", count)
+			})
+		},
+	}
+
+	return cmd
+}
+
+func (cli *CLI) buildStoreRekeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "re-encrypt all seeds in the data store with a new passphrase",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "store", "subcmd": "rekey"}
+
+			enc, keys, err := cli.encryptedStore()
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't rekey store: %v", err)
+				return
+			}
+
+			if !enc.Enabled() {
+				cli.error(logFields, "store is not encrypted, use: lumen store encrypt")
+				return
+			}
+
+			file, _ := cmd.Flags().GetString("new-passphrase-file")
+			pass, err := cli.passphraseFunc("LUMEN_NEW_PASSPHRASE", file, true)()
+			if err != nil {
+				cli.error(logFields, "can't get new passphrase: %v", err)
+				return
+			}
+
+			count, err := enc.Convert(keys, pass)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't rekey store: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, seedsResult{count}, func() {
+				cli.showSuccess("re-encrypted %d seeds", count)
+			})
+		},
+	}
+
+	cmd.Flags().String("new-passphrase-file", "", "read the new passphrase from this file")
+	return cmd
+}
+
+// buildFlagsForStoreCopy adds the key selection flags shared by export, import
+// and migrate.
+func buildFlagsForStoreCopy(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("namespace", []string{}, "only copy keys in these namespaces (comma separated)")
+	cmd.Flags().Bool("no-seeds", false, "don't copy seeds")
+}
+
+// getStoreCopyOptions returns the options for export, import and migrate. The
+// seeds that are checked for secret helpers are decrypted with enc, if set.
+func getStoreCopyOptions(cmd *cobra.Command, enc *store.Encrypted) store.ExportOptions {
+	namespaces, _ := cmd.Flags().GetStringSlice("namespace")
+	noSeeds, _ := cmd.Flags().GetBool("no-seeds")
+
+	opts := store.ExportOptions{
+		Namespaces: namespaces,
+		NoSecrets:  noSeeds,
+		Exclude:    []string{historyPrefix}, // history is local to a store
+	}
+
+	// Secret helpers run commands, so they're only copied into a store on
+	// request.
+	if allowExec, err := cmd.Flags().GetBool("allow-exec"); err == nil && !allowExec {
+		opts.Check = checkNoExecRefs(enc)
+	}
+
+	return opts
+}
+
+// checkNoExecRefs returns a check that fails for seeds that refer to secret
+// helpers. Encrypted seeds can hide a reference, so they're decrypted with enc
+// first, and refused if that's not possible.
+func checkNoExecRefs(enc *store.Encrypted) func(k, v string) error {
+	return func(k, v string) error {
+		if !store.IsSecretKey(k) {
+			return nil
+		}
+
+		if store.IsEncryptedValue(v) {
+			if enc == nil {
+				return errors.Errorf("can't check encrypted %s, use --allow-exec to copy it", k)
+			}
+
+			var err error
+			if v, err = enc.Decrypt(v); err != nil {
+				return errors.Wrapf(err, "can't decrypt %s to check it, use --allow-exec to copy it", k)
+			}
+		}
+
+		if client.IsExecRef(v) {
+			return errors.Errorf("%s runs a command (%s), use --allow-exec to copy it", k, v)
+		}
+
+		return nil
+	}
+}
+
+func (cli *CLI) showImportStats(logFields logrus.Fields, verb string, stats store.ImportStats) {
+	cli.showResult(logFields, stats, func() {
+		cli.showSuccess("%s %d keys (%d unchanged, %d skipped)", verb, stats.Written, stats.Unchanged, stats.Skipped)
+	})
+}
+
+// seedsResult is the output of "store encrypt" and "store rekey"
+type seedsResult struct {
+	Seeds int `json:"seeds"`
+}
+
+// exportResult is the output of "store export [file]"
+type exportResult struct {
+	Keys int    `json:"keys"`
+	File string `json:"file"`
+}
+
+func (cli *CLI) buildStoreExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "export the data store to file (or stdout)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "store", "subcmd": "export"}
+
+			export, err := store.NewExport(cli.store, getStoreCopyOptions(cmd, nil))
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't export store: %v", err)
+				return
+			}
+
+			count := len(export.Entries)
+			encrypt, _ := cmd.Flags().GetBool("encrypt")
+			plaintext, _ := cmd.Flags().GetBool("plaintext-seeds")
+			if seeds := countPlaintextSeeds(export); seeds > 0 && !encrypt && !plaintext {
+				cli.errorKind(ErrUsage, logFields, "export has %d seeds in the clear, use --encrypt, --no-seeds, or --plaintext-seeds", seeds)
+				return
+			}
+
+			if encrypt {
+				file, _ := cmd.Flags().GetString("passphrase-file")
+				pass, err := cli.passphraseFunc("LUMEN_EXPORT_PASSPHRASE", file, true)()
+				if err != nil {
+					cli.error(logFields, "can't get export passphrase: %v", err)
+					return
+				}
+
+				if err := export.Encrypt(pass); err != nil {
+					cli.error(logFields, "can't encrypt export: %v", err)
+					return
+				}
+			}
+
+			if len(args) == 0 {
+				cli.showResult(logFields, export, func() {
+					cli.showJSON(logFields, export)
+				})
+				return
+			}
+
+			data, err := json.MarshalIndent(export, "", "  ")
+			if err != nil {
+				cli.error(logFields, "can't marshal export: %v", err)
+				return
+			}
+
+			if err := ioutil.WriteFile(args[0], append(data, '\n'), 0600); err != nil {
+				cli.error(logFields, "can't write export: %v", err)
+				return
+			}
+
+			cli.showResult(logFields, exportResult{count, args[0]}, func() {
+				cli.showSuccess("exported %d keys to %s", count, args[0])
+			})
+		},
+	}
+
+	buildFlagsForStoreCopy(cmd)
+	cmd.Flags().Bool("encrypt", false, "encrypt the export with a passphrase")
+	cmd.Flags().Bool("plaintext-seeds", false, "allow seeds in the clear in an unencrypted export")
+	cmd.Flags().String("passphrase-file", "", "read the export passphrase from this file")
+	return cmd
+}
+
+// countPlaintextSeeds returns the number of seeds in export that are in the
+// clear. Secret references aren't seeds.
+func countPlaintextSeeds(export *store.Export) int {
+	count := 0
+	for _, e := range export.Entries {
+		if store.IsSecretKey(e.Key) && !client.IsSecretRef(e.Value) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (cli *CLI) buildStoreImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "import an export into the data store (use - for stdin)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "store", "subcmd": "import"}
+
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(args[0])
+			}
+
+			if err != nil {
+				cli.error(logFields, "can't read export: %v", err)
+				return
+			}
+
+			export, err := store.ParseExport(data)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't import: %v", err)
+				return
+			}
+
+			if export.Encrypted {
+				file, _ := cmd.Flags().GetString("passphrase-file")
+				pass, err := cli.passphraseFunc("LUMEN_EXPORT_PASSPHRASE", file, false)()
+				if err != nil {
+					cli.error(logFields, "can't get export passphrase: %v", err)
+					return
+				}
+
+				if err := export.Decrypt(pass); err != nil {
+					cli.error(logFields, "can't decrypt export: %v", err)
+					return
+				}
+			}
+
+			// Encrypted seeds in the export open with this store's passphrase.
+			enc, _ := cli.store.(*store.Encrypted)
+			policy, _ := cmd.Flags().GetString("on-conflict")
+			stats, err := export.Import(cli.store, getStoreCopyOptions(cmd, enc), policy)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't import: %v", err)
+				return
+			}
+
+			cli.showImportStats(logFields, "imported", stats)
+		},
+	}
+
+	buildFlagsForStoreCopy(cmd)
+	cmd.Flags().String("on-conflict", store.ConflictSkip, "what to do with existing keys: skip|overwrite|fail")
+	cmd.Flags().Bool("allow-exec", false, "allow seeds that run secret helpers (exec:)")
+	cmd.Flags().String("passphrase-file", "", "read the export passphrase from this file")
+	return cmd
+}
+
+func (cli *CLI) buildStoreMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate --from driver,params --to driver,params",
+		Short: "copy all keys from one data store to another",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logFields := logrus.Fields{"cmd": "store", "subcmd": "migrate"}
+
+			openStore := func(flag string) store.API {
+				spec, _ := cmd.Flags().GetString(flag)
+				if spec == "" {
+					cli.errorKind(ErrUsage, logFields, "missing --%s store", flag)
+					return nil
+				}
+
+				driver, params := parseStoreSpec(spec)
+				s, err := store.NewStore(driver, params)
+				if err != nil {
+					cli.errorKind(ErrStore, logFields, "can't open --%s store: %v", flag, err)
+					return nil
+				}
+
+				return s
+			}
+
+			from := openStore("from")
+			if from == nil {
+				return
+			}
+
+			to := openStore("to")
+			if to == nil {
+				return
+			}
+
+			// Encrypted seeds are copied as-is, but they're decrypted to check
+			// them for secret helpers.
+			file, _ := cmd.Flags().GetString("passphrase-file")
+			enc := store.NewEncryptedStore(from, cli.passphraseFunc("LUMEN_PASSPHRASE", file, false))
+			policy, _ := cmd.Flags().GetString("on-conflict")
+			stats, err := store.Migrate(from, to, getStoreCopyOptions(cmd, enc), policy)
+			if err != nil {
+				cli.errorKind(ErrStore, logFields, "can't migrate: %v", err)
+				return
+			}
+
+			cli.showImportStats(logFields, "migrated", stats)
+		},
+	}
+
+	buildFlagsForStoreCopy(cmd)
+	cmd.Flags().String("from", "", "source store (driver,params)")
+	cmd.Flags().String("to", "", "destination store (driver,params)")
+	cmd.Flags().String("on-conflict", store.ConflictSkip, "what to do with existing keys: skip|overwrite|fail")
+	cmd.Flags().Bool("allow-exec", false, "allow seeds that run secret helpers (exec:)")
+	cmd.Flags().String("passphrase-file", "", "read the --from store's passphrase from this file")
+	return cmd
+}
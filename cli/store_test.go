@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/0xfe/lumen/store"
+)
+
+func TestStoreEncrypt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileStore, err := store.NewFileStore(dir + string(os.PathSeparator) + "data.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("LUMEN_PASSPHRASE", "secret")
+	defer os.Unsetenv("LUMEN_PASSPHRASE")
+
+	cli := NewCLI()
+	cli.SetStore(fileStore)
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+
+	// Older versions kept seeds in the history.
+	fileStore.Set("global:history:99:test:account:mo:seed", "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", 0)
+
+	expectOutput(t, cli, "encrypted 1 seeds", "store encrypt")
+	expectOutput(t, cli, "error", "store encrypt")
+
+	if _, err := fileStore.Get("global:history:99:test:account:mo:seed"); err == nil {
+		t.Errorf("seed in history not deleted")
+	}
+
+	if v, _ := fileStore.Get("test:account:mo:seed"); !store.IsEncryptedValue(v) {
+		t.Errorf("seed not encrypted on disk: %v", v)
+	}
+
+	expectOutput(t, cli, "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", "account seed mo")
+
+	os.Setenv("LUMEN_NEW_PASSPHRASE", "new secret")
+	defer os.Unsetenv("LUMEN_NEW_PASSPHRASE")
+	expectOutput(t, cli, "re-encrypted 1 seeds", "store rekey")
+
+	// A fresh CLI with the old passphrase can't read seeds
+	other := NewCLI()
+	other.SetStore(fileStore)
+	if got := other.TestCommand("account seed mo --ns test"); !strings.HasPrefix(got, "error") {
+		t.Errorf("want error with old passphrase, got %v", got)
+	}
+}
+
+func TestStoreExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("account set mo GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+	cli.TestCommand("account set kelly SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+
+	exportFile := dir + string(os.PathSeparator) + "export.json"
+	expectOutput(t, cli, "exported 1 keys to "+exportFile, "store export --namespace test --no-seeds "+exportFile)
+
+	// Seeds are only exported in the clear on request
+	_, err = cli.RunContext(context.Background(), []string{"store", "export", exportFile + ".seeds"}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || cliErr.Kind != ErrUsage {
+		t.Errorf("export with plaintext seeds: want usage error, got %v", err)
+	}
+	expectOutput(t, cli, "exported 3 keys to "+exportFile+".seeds", "store export --plaintext-seeds "+exportFile+".seeds")
+
+	if out := cli.TestCommand("store export --namespace test --no-seeds"); !strings.Contains(out, `"format": "lumen-export"`) {
+		t.Errorf("export to stdout: got %s", out)
+	}
+
+	other, _ := newTestCLI()
+	other.TestCommand("ns test")
+	expectOutput(t, other, "imported 1 keys (0 unchanged, 0 skipped)", "store import "+exportFile)
+	expectOutput(t, other, "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM", "account address mo")
+	expectOutput(t, other, "error", "account seed kelly")
+	expectOutput(t, other, "imported 0 keys (1 unchanged, 0 skipped)", "store import "+exportFile)
+
+	other.TestCommand("account set mo GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U")
+	expectOutput(t, other, "error", "store import --on-conflict fail "+exportFile)
+	expectOutput(t, other, "imported 1 keys (0 unchanged, 0 skipped)", "store import --on-conflict overwrite "+exportFile)
+
+	// Encrypted exports
+	os.Setenv("LUMEN_EXPORT_PASSPHRASE", "secret")
+	defer os.Unsetenv("LUMEN_EXPORT_PASSPHRASE")
+	expectOutput(t, cli, "exported 3 keys to "+exportFile, "store export --encrypt "+exportFile)
+
+	data, _ := ioutil.ReadFile(exportFile)
+	if strings.Contains(string(data), "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU") {
+		t.Errorf("seed in clear in encrypted export")
+	}
+
+	expectOutput(t, other, "imported 1 keys (2 unchanged, 0 skipped)", "store import "+exportFile)
+	expectOutput(t, other, "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", "account seed kelly")
+
+	// Secret helpers are only imported on request
+	cli.TestCommand("account set bob 'exec:echo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU'")
+	expectOutput(t, cli, "exported 4 keys to "+exportFile, "store export --encrypt "+exportFile)
+	expectOutput(t, other, "error", "store import "+exportFile)
+	expectOutput(t, other, "error", "account seed bob")
+	expectOutput(t, other, "imported 1 keys (3 unchanged, 0 skipped)", "store import --allow-exec "+exportFile)
+}
+
+func TestStoreMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lumen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from := dir + string(os.PathSeparator) + "from.json"
+	to := dir + string(os.PathSeparator) + "to.json"
+
+	fromStore, err := store.NewFileStore(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromStore.Set("test:account:mo:address", "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM", 0)
+
+	cli, _ := newTestCLI()
+	expectOutput(t, cli, "migrated 1 keys (0 unchanged, 0 skipped)", "store migrate --from file,"+from+" --to file,"+to)
+	expectOutput(t, cli, "error", "store migrate --from file,"+from)
+
+	toStore, _ := store.NewFileStore(to)
+	if v, _ := toStore.Get("test:account:mo:address"); v != "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM" {
+		t.Errorf("key not migrated, got %v", v)
+	}
+
+	fromStore.Set("test:account:mo:seed", "exec:pass show mo", 0)
+	expectOutput(t, cli, "error", "store migrate --from file,"+from+" --to file,"+to)
+	if _, err := toStore.Get("test:account:mo:seed"); err == nil {
+		t.Errorf("secret helper migrated without --allow-exec")
+	}
+	expectOutput(t, cli, "migrated 1 keys (1 unchanged, 0 skipped)", "store migrate --allow-exec --from file,"+from+" --to file,"+to)
+
+	// Encrypted seeds are checked too
+	fromStore.Delete("test:account:mo:seed")
+	os.Setenv("LUMEN_PASSPHRASE", "secret")
+	defer os.Unsetenv("LUMEN_PASSPHRASE")
+	enc := store.NewEncryptedStore(fromStore, func() (string, error) { return "secret", nil })
+	enc.Enable()
+	enc.Set("test:account:sue:seed", "exec:pass show sue", 0)
+	if v, _ := fromStore.Get("test:account:sue:seed"); !store.IsEncryptedValue(v) {
+		t.Fatalf("seed not encrypted: %v", v)
+	}
+
+	expectOutput(t, cli, "error", "store migrate --from file,"+from+" --to file,"+to)
+	if _, err := toStore.Get("test:account:sue:seed"); err == nil {
+		t.Errorf("encrypted secret helper migrated without --allow-exec")
+	}
+
+	enc.Set("test:account:sue:seed", "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", 0)
+	expectOutput(t, cli, "migrated 1 keys (1 unchanged, 0 skipped)", "store migrate --from file,"+from+" --to file,"+to)
+}
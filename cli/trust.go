@@ -1,7 +1,7 @@
 package cli
 
 import (
-	"github.com/0xfe/microstellar"
+	"github.com/0xfe/lumen/client"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -13,7 +13,7 @@ func (cli *CLI) buildTrustCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				showError(logrus.Fields{"cmd": "trust"}, "unrecognized trust command: %s, expecting: create|remove", args[0])
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "trust"}, "unrecognized trust command: %s, expecting: create|remove", args[0])
 				return
 			}
 		},
@@ -40,30 +40,19 @@ func (cli *CLI) buildTrustCreateCmd() *cobra.Command {
 			}
 
 			logFields := logrus.Fields{"cmd": "trust", "subcmd": "create"}
-			source, err := cli.ResolveAccount(logFields, name, "seed")
+			result, err := cli.client.Trust(cli.ctx, client.TrustRequest{
+				Account:   name,
+				Asset:     assetName,
+				Limit:     limit,
+				TxOptions: cli.txOptions(cmd),
+			})
 
 			if err != nil {
-				cli.error(logFields, "invalid account: %s", name)
+				cli.error(logFields, "failed to create trustline from %s to %s: %v", name, assetName, err)
 				return
 			}
 
-			asset, err := cli.ResolveAsset(assetName)
-			if err != nil {
-				cli.error(logFields, "invalid asset: %s", assetName)
-				return
-			}
-
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate trustline transaction: %v", err)
-				return
-			}
-
-			err = cli.ms.CreateTrustLine(source, asset, limit, opts)
-			if err != nil {
-				cli.error(logFields, "failed to create trustline from %s to %s: %v", name, assetName, microstellar.ErrorString(err))
-				return
-			}
+			cli.showTxResult(logFields, result)
 		},
 	}
 
@@ -81,30 +70,19 @@ func (cli *CLI) buildTrustRemoveCmd() *cobra.Command {
 			assetName := args[1]
 
 			logFields := logrus.Fields{"cmd": "trust", "subcmd": "remove"}
-			source, err := cli.ResolveAccount(logFields, name, "seed")
+			result, err := cli.client.Trust(cli.ctx, client.TrustRequest{
+				Account:   name,
+				Asset:     assetName,
+				Remove:    true,
+				TxOptions: cli.txOptions(cmd),
+			})
 
 			if err != nil {
-				cli.error(logFields, "invalid account: %s", name)
+				cli.error(logFields, "failed to remove trustline from %s to %s: %v", name, assetName, err)
 				return
 			}
 
-			asset, err := cli.ResolveAsset(assetName)
-			if err != nil {
-				cli.error(logFields, "invalid asset: %s", assetName)
-				return
-			}
-
-			opts, err := cli.genTxOptions(cmd, logFields)
-			if err != nil {
-				cli.error(logFields, "can't generate trustline transaction: %v", err)
-				return
-			}
-
-			err = cli.ms.RemoveTrustLine(source, asset, opts)
-			if err != nil {
-				cli.error(logFields, "error: %v", name, assetName, microstellar.ErrorString(err))
-				return
-			}
+			cli.showTxResult(logFields, result)
 		},
 	}
 
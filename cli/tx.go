@@ -3,6 +3,7 @@ package cli
 import (
 	"encoding/json"
 
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -10,12 +11,12 @@ import (
 
 func (cli *CLI) buildTxCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "tx [sign|submit] [base64-encoded string] --signers seed1,seed2...",
-		Short: "manage trustlines between accounts and assets",
+		Use:   "tx [sign|submit|decode|seq|log|show|export] [args]...",
+		Short: "sign, submit, and decode transactions, and list the transactions submitted",
 		Args:  cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
-				showError(logrus.Fields{"cmd": "tx"}, "unrecognized tx command: %s, expecting: sign|submit", args[0])
+				cli.errorKind(ErrUsage, logrus.Fields{"cmd": "tx"}, "unrecognized tx command: %s, expecting: sign|submit|decode|seq|log|show|export", args[0])
 				return
 			}
 		},
@@ -24,6 +25,10 @@ func (cli *CLI) buildTxCmd() *cobra.Command {
 	cmd.AddCommand(cli.buildTxSignCmd())
 	cmd.AddCommand(cli.buildTxSubmitCmd())
 	cmd.AddCommand(cli.buildTxDecodeCmd())
+	cmd.AddCommand(cli.buildTxSeqCmd())
+	cmd.AddCommand(cli.buildTxLogCmd())
+	cmd.AddCommand(cli.buildTxShowCmd())
+	cmd.AddCommand(cli.buildTxExportCmd())
 
 	return cmd
 }
@@ -45,36 +50,20 @@ func (cli *CLI) buildTxSignCmd() *cobra.Command {
 			}
 
 			if len(signers) < 1 {
-				cli.error(logFields, "need at least one seed in --signers")
+				cli.errorKind(ErrUsage, logFields, "need at least one seed in --signers")
 				return
 			}
 
-			var seeds []string
-
-			for _, signer := range signers {
-				seed, err := cli.ResolveAccount(logFields, signer, "seed")
-
-				if err != nil {
-					cli.error(logFields, "bad signer account: %v", signer)
-					return
-				}
-
-				if microstellar.ValidSeed(seed) != nil {
-					cli.error(logFields, "no seed found in %v", signer)
-					return
-				}
-
-				seeds = append(seeds, seed)
-			}
-
-			signedTx, err := cli.ms.SignTransaction(b64tx, seeds...)
+			signedTx, err := cli.client.Sign(cli.ctx, b64tx, signers)
 
 			if err != nil {
-				cli.error(logFields, "signing error: %v", err)
+				cli.error(logFields, "%v", err)
 				return
 			}
 
-			showSuccess(signedTx)
+			cli.showResult(logFields, client.TxResult{Envelope: signedTx}, func() {
+				cli.showSuccess("%s", signedTx)
+			})
 		},
 	}
 
@@ -91,15 +80,54 @@ func (cli *CLI) buildTxSubmitCmd() *cobra.Command {
 			b64tx := args[0]
 
 			logFields := logrus.Fields{"cmd": "submit"}
+			if cli.dryRun {
+				if _, err := microstellar.DecodeTx(b64tx); err != nil {
+					cli.errorKind(ErrUsage, logFields, "decode error: %v", err)
+					return
+				}
+
+				cli.showTxResult(logFields, &client.TxResult{Envelope: b64tx})
+				return
+			}
+
+			if cli.offline {
+				cli.error(logFields, "submit error: %v", client.ErrOffline)
+				return
+			}
+
+			if err := cli.client.EnforcePolicy(b64tx); err != nil {
+				cli.error(logFields, "submit error: %v", err)
+				return
+			}
+
+			if reason := cli.confirmReason(); reason != "" {
+				preview, err := cli.client.Preview(b64tx)
+				if err == nil {
+					err = cli.confirmTx(reason, preview)
+				}
+
+				if err != nil {
+					cli.error(logFields, "submit error: %v", err)
+					return
+				}
+			}
+
 			resp, err := cli.ms.SubmitTransaction(b64tx)
+			cli.recordTx(cli.client.Receipt(b64tx, resp, err))
 
 			if err != nil {
-				cli.error(logFields, "submit error: %v", microstellar.ErrorString(err))
+				cli.error(logFields, "submit error: %v", err)
 				return
 			}
 
-			respJSON, _ := json.MarshalIndent(*resp, "", "  ")
-			showSuccess(string(respJSON))
+			if err := cli.client.RecordSpending(b64tx); err != nil {
+				cli.logger.WithFields(logFields).Warnf("could not record spending for policy: %v", err)
+			}
+
+			cli.showResult(logFields, resp, func() {
+				respJSON, _ := json.MarshalIndent(*resp, "", "  ")
+				cli.showSuccess("%s", string(respJSON))
+			})
 		},
 	}
 
@@ -119,14 +147,73 @@ func (cli *CLI) buildTxDecodeCmd() *cobra.Command {
 			txe, err := microstellar.DecodeTxToJSON(b64tx, pretty)
 
 			if err != nil {
-				cli.error(logFields, "decode error: %v", microstellar.ErrorString(err))
+				cli.error(logFields, "decode error: %v", err)
+				return
+			}
+
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(txe), &decoded); err != nil {
+				cli.error(logFields, "decode error: %v", err)
 				return
 			}
 
-			showSuccess(txe)
+			cli.showResult(logFields, decoded, func() {
+				cli.showSuccess("%s", txe)
+			})
 		},
 	}
 
 	cmd.Flags().Bool("pretty", false, "format JSON output")
 	return cmd
 }
+
+// txSeqResult is the output of "tx seq"
+type txSeqResult struct {
+	Account string  `json:"account"`
+	Address string  `json:"address"`
+	Next    []int64 `json:"next"`
+}
+
+func (cli *CLI) buildTxSeqCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "seq [account] [--count n]",
+		Short: "show the sequence numbers of the next transactions of [account], for building them offline",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			logFields := logrus.Fields{"cmd": "tx", "subcmd": "seq"}
+
+			count, _ := cmd.Flags().GetInt("count")
+			if count < 1 {
+				cli.errorKind(ErrUsage, logFields, "bad count: %d", count)
+				return
+			}
+
+			address, err := cli.ResolveAccount(logFields, name, "address")
+			if err != nil {
+				cli.errorKind(ErrResolution, logFields, "invalid account: %s", name)
+				return
+			}
+
+			seq, err := cli.client.NextSequence(address)
+			if err != nil {
+				cli.error(logFields, "can't get sequence number: %v", err)
+				return
+			}
+
+			result := txSeqResult{Account: name, Address: address}
+			for i := 0; i < count; i++ {
+				result.Next = append(result.Next, seq+int64(i))
+			}
+
+			cli.showResult(logFields, result, func() {
+				for _, next := range result.Next {
+					cli.showSuccess("%d", next)
+				}
+			})
+		},
+	}
+
+	cmd.Flags().Int("count", 1, "number of sequence numbers to show")
+	return cmd
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xfe/microstellar"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+)
+
+func TestOffline(t *testing.T) {
+	var requests int32
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/transactions" {
+			w.Write([]byte(`{"hash": "c0ffee", "ledger": 42}`))
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{"id": "` + address + `", "account_id": "` + address + `", "sequence": "41",
+			"thresholds": {"low_threshold": 0, "med_threshold": 0, "high_threshold": 0},
+			"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+			"signers": [{"public_key": "` + address + `", "weight": 1, "key": "` + address + `"}]}`))
+	}))
+	defer horizon.Close()
+
+	cli, _ := newTestCLI()
+	cli.TestCommand("ns test")
+	cli.TestCommand("network add local --horizon " + horizon.URL + " --passphrase local")
+	cli.TestCommand("network use local")
+	cli.TestCommand("account set mo SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU")
+	cli.TestCommand("account set kelly GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM")
+
+	expectOutput(t, cli, "42", "tx seq mo")
+	expectOutput(t, cli, "[42,43,44]", "tx seq mo --count 3 -o 'template={{json .next}}'")
+	expectOutput(t, cli, "error", "tx seq nobody")
+	expectOutput(t, cli, "error", "tx seq mo --count 0")
+
+	// Offline, nothing reaches the network, and transactions are signed for
+	// the passphrase of the named network.
+	atomic.StoreInt32(&requests, 0)
+	expectOutput(t, cli, "error", "--offline pay 10 --from mo --to kelly")
+	envelope := strings.TrimSpace(cli.TestCommand("--offline pay 10 --from mo --to kelly --sequence 42"))
+	_, err := cli.RunContext(context.Background(), []string{"--offline", "balance", "mo"}, nil, nil)
+	if cliErr, ok := err.(*Error); !ok || cliErr.Kind != ErrNetwork || !strings.Contains(cliErr.Message, "lumen is offline") {
+		t.Errorf("offline balance: want network error, got %v", err)
+	}
+	expectOutput(t, cli, "error", "--offline tx seq mo")
+	expectOutput(t, cli, "error", "--offline tx submit "+envelope)
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("offline: want no requests, got %d", n)
+	}
+
+	txe, err := microstellar.DecodeTx(envelope)
+	if err != nil {
+		t.Fatalf("offline pay: can't decode %q: %v", envelope, err)
+	}
+
+	hash, _ := network.HashTransaction(&txe.Tx, "local")
+	kp, _ := keypair.Parse("GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4")
+	if txe.Tx.SeqNum != 42 || len(txe.Signatures) != 1 || kp.Verify(hash[:], txe.Signatures[0].Signature) != nil {
+		t.Errorf("offline pay: want transaction 42 signed by mo, got %+v", txe)
+	}
+
+	// Offline transactions aren't in the journal until they're submitted.
+	expectOutput(t, cli, "[]", "tx log -o json")
+	expectOutput(t, cli, "c0ffee", "tx submit "+envelope+" -o template={{.hash}}")
+	expectOutput(t, cli, "1", "tx log -o 'template={{len .}}'")
+
+	// Unsigned transactions can be signed offline.
+	unsigned := strings.TrimSpace(cli.TestCommand("--offline pay 10 --from mo --to kelly --sequence 43 --nosign"))
+	signed := strings.TrimSpace(cli.TestCommand("--offline tx sign " + unsigned + " --signers mo"))
+	if txe, err := microstellar.DecodeTx(signed); err != nil || txe.Tx.SeqNum != 43 || len(txe.Signatures) != 1 {
+		t.Errorf("offline tx sign: got %q, %v", signed, err)
+	}
+
+	// Online, --sequence replaces the account's next sequence number.
+	expectOutput(t, cli, "50", "pay 10 --from mo --to kelly --sequence 50 --dry-run -o template={{.preview.sequence}}")
+}
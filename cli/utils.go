@@ -1,47 +1,88 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
 
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-func showSuccess(msg string, args ...interface{}) {
-	fmt.Printf(msg+"\n", args...)
+func (cli *CLI) showSuccess(msg string, args ...interface{}) {
+	fmt.Fprintf(cli.stdout, msg+"\n", args...)
 }
 
-func showError(fields logrus.Fields, msg string, args ...interface{}) {
-	logrus.WithFields(fields).Errorf(msg, args...)
+// showTable prints rows as aligned columns under header.
+func (cli *CLI) showTable(header []string, rows [][]string) {
+	writeTable(cli.stdout, header, rows)
 }
 
-func (cli *CLI) help(cmd *cobra.Command, args []string) {
-	fmt.Fprint(os.Stderr, cmd.UsageString())
+// showJSON prints v as indented JSON.
+func (cli *CLI) showJSON(logFields logrus.Fields, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		cli.error(logFields, "can't marshal output: %v", err)
+		return
+	}
 
-	if !cli.testing {
-		os.Exit(-1)
-	} else {
-		fmt.Println("error")
+	cli.showSuccess("%s", string(data))
+}
+
+func (cli *CLI) showError(fields logrus.Fields, msg string, args ...interface{}) {
+	if cli.errorFormat() == "json" {
+		// The error is reported in JSON when the command is done.
+		cli.logger.WithFields(fields).Debugf(msg, args...)
+		return
+	}
+
+	cli.logger.WithFields(fields).Errorf(msg, args...)
+}
+
+func (cli *CLI) help(cmd *cobra.Command, args []string) {
+	if cli.errorFormat() != "json" {
+		fmt.Fprint(cli.stderr, cmd.UsageString())
 	}
+	cli.fail(newUsageError(cmd, "missing command"))
 }
 
-func debugf(fields logrus.Fields, msg string, args ...interface{}) {
-	logrus.WithFields(fields).Debugf(msg, args...)
+func (cli *CLI) debugf(fields logrus.Fields, msg string, args ...interface{}) {
+	cli.logger.WithFields(fields).Debugf(msg, args...)
 }
 
+// error logs the failure of the current command, and records it so that it
+// can be returned by RunContext (or turned into an exit status by Execute.)
+// The kind of error is derived from the first error in args, if any. Pass
+// errors themselves, not their strings, so that horizon errors are reported.
 func (cli *CLI) error(logFields logrus.Fields, msg string, args ...interface{}) {
-	showError(logFields, msg, args...)
+	cli.errorKind(ErrGeneral, logFields, msg, args...)
+}
 
-	if !cli.testing {
-		os.Exit(-1)
-	} else {
-		fmt.Println("error")
+// errorKind is like error, for failures of a known kind.
+func (cli *CLI) errorKind(kind ErrorKind, logFields logrus.Fields, msg string, args ...interface{}) {
+	err := newError(kind, logFields, msg, args...)
+	cli.showError(logFields, "%s", err.Message)
+	cli.fail(err)
+}
+
+// fail records err as the result of the current command. Only the first
+// error is kept.
+func (cli *CLI) fail(err *Error) {
+	if cli.err == nil {
+		cli.err = err
+	}
+
+	if cli.testing {
+		fmt.Fprintln(cli.stdout, "error")
 	}
 }
 
@@ -50,204 +91,251 @@ func buildFlagsForTxOptions(cmd *cobra.Command) {
 	cmd.Flags().String("memotext", "", "memo text")
 	cmd.Flags().String("memoid", "", "memo ID")
 	cmd.Flags().StringSlice("signers", []string{}, "alternate signers (comma separated)")
+	cmd.Flags().Int64("sequence", 0, "sequence number of the transaction (see: lumen tx seq)")
 }
 
-func (cli *CLI) genTxOptions(cmd *cobra.Command, logFields logrus.Fields) (*microstellar.Options, error) {
-	opts := microstellar.Opts()
-
-	if memotext, err := cmd.Flags().GetString("memotext"); err == nil && memotext != "" {
-		opts = opts.WithMemoText(memotext)
-	}
-
-	if memoid, err := cmd.Flags().GetString("memoid"); err == nil && memoid != "" {
-		id, err := strconv.ParseUint(memoid, 10, 64)
-		if err != nil {
-			logrus.WithFields(logFields).Debugf("error parsing memoid: %v", err)
-			return nil, errors.Errorf("bad memoid: %s", memoid)
+// txOptions returns the transaction options set by the flags of cmd.
+func (cli *CLI) txOptions(cmd *cobra.Command) client.TxOptions {
+	opts := client.TxOptions{}
+	opts.MemoText, _ = cmd.Flags().GetString("memotext")
+	opts.MemoID, _ = cmd.Flags().GetString("memoid")
+	opts.Signers, _ = cmd.Flags().GetStringSlice("signers")
+	opts.NoSign, _ = cmd.Flags().GetBool("nosign")
+	opts.Sequence, _ = cmd.Flags().GetInt64("sequence")
+	opts.NoSubmit, _ = cli.rootCmd.Flags().GetBool("nosubmit")
+	opts.NoSubmit = opts.NoSubmit || cli.offline
+	opts.DryRun = cli.dryRun
+	opts.Submitted = cli.recordTx
+
+	if reason := cli.confirmReason(); reason != "" && !opts.DryRun && !opts.NoSubmit {
+		opts.Confirm = func(preview *client.TxPreview) error {
+			return cli.confirmTx(reason, preview)
 		}
-		opts = opts.WithMemoID(id)
 	}
 
-	if signers, err := cmd.Flags().GetStringSlice("signers"); err == nil && len(signers) > 0 {
-		for _, signer := range signers {
-			logrus.WithFields(logFields).Debugf("adding signer: %s", signer)
-			address, err := cli.ResolveAccount(logFields, signer, "seed")
-
-			if err != nil {
-				logrus.WithFields(logFields).Debugf("bad signer %s: %v", signer, err)
-				return nil, errors.Errorf("bad signer: %s", signer)
-			}
+	return opts
+}
 
-			opts = opts.WithSigner(address)
-		}
+// confirmReason returns why transactions must be confirmed before they're
+// submitted, if they must: they're on the public network, or in a protected
+// namespace. Confirmation is skipped with --yes.
+func (cli *CLI) confirmReason() string {
+	if yes, _ := cli.rootCmd.PersistentFlags().GetBool("yes"); yes {
+		return ""
 	}
 
-	if nosubmit, _ := cli.rootCmd.Flags().GetBool("nosubmit"); nosubmit {
-		handler := func(args ...interface{}) (bool, error) {
-			showSuccess(args[0].(string))
-			return false, nil
-		}
-
-		txHandler := microstellar.TxHandler(handler)
-		logrus.WithFields(logFields).Debugf("sign-only transaction")
-		opts = opts.On(microstellar.EvBeforeSubmit, &txHandler)
+	if client.IsPublicNetwork(cli.network) {
+		return "on the public network"
 	}
 
-	if nosign, err := cmd.Flags().GetBool("nosign"); err == nil && nosign {
-		opts = opts.SkipSignatures()
+	if cli.isProtected(cli.ns) {
+		return "in protected namespace " + cli.ns
 	}
 
-	return opts, nil
+	return ""
 }
 
-// ResolveAccount returns an address or seed (depending on keyType), by looking up lookupKey
-// in the local store (or in federation servers.)
-func (cli *CLI) ResolveAccount(fields logrus.Fields, lookupKey string, keyType string) (string, error) {
-	var err error
-	addressOrSeed := lookupKey
+// errNotConfirmed is returned when the user doesn't confirm a transaction.
+type errNotConfirmed struct {
+	msg string
+}
 
-	if strings.Contains(lookupKey, "*") {
-		logrus.WithFields(fields).Debugf("resolving federation address: %s", lookupKey)
-		resolvedAddr, err := cli.ms.Resolve(lookupKey)
+func (e *errNotConfirmed) Error() string {
+	return e.msg
+}
 
-		if err == nil {
-			logrus.WithFields(fields).Debugf("got address: %s = %s", lookupKey, resolvedAddr)
-			addressOrSeed = resolvedAddr
-			lookupKey = resolvedAddr
-		}
+// confirmTx shows preview on the terminal, and asks the user to confirm the
+// transaction. Without a terminal, transactions can't be confirmed.
+func (cli *CLI) confirmTx(reason string, preview *client.TxPreview) error {
+	fd := int(os.Stdin.Fd())
+	if cli.testing || !terminal.IsTerminal(fd) {
+		return &errNotConfirmed{fmt.Sprintf("transactions %s must be confirmed, use --yes to skip confirmation", reason)}
 	}
 
-	if !microstellar.ValidAddressOrSeed(lookupKey) {
-		addressOrSeed, err = cli.GetAccountOrSeed(lookupKey, keyType)
-		if err != nil {
-			logrus.WithFields(fields).Debugf("invalid address, seed, or account name: %s", lookupKey)
-			return "", err
-		}
+	writeTxPreview(cli.stderr, preview)
+	fmt.Fprintf(cli.stderr, "Submit this transaction %s? [y/N] ", reason)
 
-		if strings.Contains(addressOrSeed, "*") {
-			return cli.ResolveAccount(fields, addressOrSeed, keyType)
-		}
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return &errNotConfirmed{"transaction not confirmed"}
 	}
 
-	return addressOrSeed, nil
-}
-
-// ResolveAsset looks up name and returns a microstellar Asset
-func (cli *CLI) ResolveAsset(name string) (*microstellar.Asset, error) {
-	if name == "" || name == "native" {
-		return microstellar.NativeAsset, nil
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return &errNotConfirmed{"transaction not confirmed"}
 	}
 
-	var code, issuer, assetType string
-	if strings.Contains(name, ":") {
-		var issuerName string
-		parts := strings.Split(name, ":")
-		if len(parts) < 2 {
-			return nil, errors.Errorf("bad asset: %s", name)
-		}
-
-		code = parts[0]
-		issuerName = parts[1]
+	return nil
+}
 
-		if len(parts) > 2 {
-			assetType = parts[2]
-		} else {
-			if len(code) <= 5 {
-				assetType = string(microstellar.Credit4Type)
-			} else {
-				assetType = string(microstellar.Credit12Type)
-			}
+// showTxResult displays the result of a transaction: its hash if it was
+// submitted, or the transaction if it wasn't.
+func (cli *CLI) showTxResult(logFields logrus.Fields, result *client.TxResult) {
+	cli.showResult(logFields, result, func() {
+		if result.Hash != "" {
+			cli.showSuccess("%s", result.Hash)
+		} else if result.Preview != nil {
+			cli.showSuccess("dry run: not signed or submitted")
+			writeTxPreview(cli.stdout, result.Preview)
+		} else if result.Envelope != "" {
+			cli.showSuccess("%s", result.Envelope)
 		}
+	})
+}
 
-		var err error
-		issuer, err = cli.ResolveAccount(logrus.Fields{"method": "ResolveAsset"}, issuerName, "address")
-		if err != nil {
-			return nil, errors.Errorf("bad asset issuer: %v", issuerName)
+// writeTxPreview describes the transaction in p to w.
+func writeTxPreview(w io.Writer, p *client.TxPreview) {
+	named := func(name, address string) string {
+		if name == "" {
+			return address
 		}
+		return fmt.Sprintf("%s (%s)", name, address)
+	}
+
+	fmt.Fprintf(w, "%-12s %s\n", "source:", named(p.SourceName, p.Source))
+	fmt.Fprintf(w, "%-12s %d\n", "sequence:", p.Sequence)
+
+	if len(p.Operations) == 0 {
+		fmt.Fprintf(w, "%-12s none\n", "operations:")
 	} else {
-		readField := func(field string) (string, error) {
-			key := fmt.Sprintf("asset:%s:%s", name, field)
-			val, err := cli.GetVar(key)
-			if err != nil {
-				return "", err
-			}
-
-			return val, nil
+		fmt.Fprintln(w, "operations:")
+	}
+	for i, op := range p.Operations {
+		if op.Source != "" {
+			fmt.Fprintf(w, "  %d. %s (source: %s)\n", i+1, op.Description, op.Source)
+		} else {
+			fmt.Fprintf(w, "  %d. %s\n", i+1, op.Description)
 		}
+	}
 
-		var err1, err2, err3 error
-		code, err1 = readField("code")
-		issuer, err2 = readField("issuer")
-		assetType, err3 = readField("type")
+	fmt.Fprintf(w, "%-12s %d stroops\n", "fee:", p.Fee)
+	if p.Memo != "" {
+		fmt.Fprintf(w, "%-12s %s\n", "memo:", p.Memo)
+	}
 
-		if err1 != nil || err2 != nil || err3 != nil {
-			return nil, errors.Errorf("could not read asset: %v, %v, %v", err1, err2, err3)
+	bounds := "none"
+	if p.MinTime > 0 || p.MaxTime > 0 {
+		bounds = "from " + time.Unix(int64(p.MinTime), 0).UTC().Format(time.RFC3339)
+		if p.MaxTime > 0 {
+			bounds += " until " + time.Unix(int64(p.MaxTime), 0).UTC().Format(time.RFC3339)
 		}
 	}
+	fmt.Fprintf(w, "%-12s %s\n", "time bounds:", bounds)
 
-	var asset *microstellar.Asset
+	if p.Threshold != "" {
+		fmt.Fprintf(w, "%-12s %s threshold, weight %d required, %d available\n", "signers:", p.Threshold, p.Required, p.Available)
+	}
+	for _, signer := range p.Signers {
+		key := "no seed"
+		if signer.HasKey {
+			key = "seed available"
+		}
+		fmt.Fprintf(w, "  %s, weight %d, %s\n", named(signer.Name, signer.Address), signer.Weight, key)
+	}
 
-	if assetType == string(microstellar.Credit4Type) {
-		asset = microstellar.NewAsset(code, issuer, microstellar.Credit4Type)
-	} else if assetType == string(microstellar.Credit12Type) {
-		asset = microstellar.NewAsset(code, issuer, microstellar.Credit12Type)
-	} else {
-		asset = microstellar.NativeAsset
+	sign := ""
+	if p.SubentryChange > 0 {
+		sign = "+"
 	}
+	fmt.Fprintf(w, "%-12s %s%s XLM (%s%d subentries)\n", "reserve:", sign, p.ReserveChange, sign, p.SubentryChange)
 
-	logrus.Debugf("got asset: %+v", asset)
-	return asset, nil
+	if len(p.Violations) > 0 {
+		fmt.Fprintln(w, "policy:      violated")
+	}
+	for _, violation := range p.Violations {
+		fmt.Fprintf(w, "  %s\n", violation)
+	}
 }
 
-// GetAccount returns the account address or seed for "name". Set keyType
-// to "address" or "seed" to specify the return value.
-func (cli *CLI) GetAccount(name, keyType string) (string, error) {
-	if keyType != "address" && keyType != "seed" {
-		return name, errors.Errorf("invalid key type: %s", keyType)
+// submitTx builds a transaction for source with build, using the transaction
+// flags of cmd.
+func (cli *CLI) submitTx(logFields logrus.Fields, cmd *cobra.Command, source string, build client.BuildFunc) error {
+	result, err := cli.client.Submit(cli.ctx, source, cli.txOptions(cmd), build)
+	if err != nil {
+		return err
 	}
 
-	key := fmt.Sprintf("account:%s:%s", name, keyType)
+	cli.showTxResult(logFields, result)
+	return nil
+}
 
-	code, err := cli.GetVar(key)
+// ResolveAccount returns an address or seed (depending on keyType), by looking up lookupKey
+// in the local store (or in federation servers.)
+func (cli *CLI) ResolveAccount(fields logrus.Fields, lookupKey string, keyType string) (string, error) {
+	cli.logger.WithFields(fields).Debugf("resolving %s: %s", keyType, lookupKey)
+	return cli.client.ResolveAccount(lookupKey, keyType)
+}
 
-	if err != nil {
-		return name, err
-	}
+// ResolveAsset looks up name and returns a microstellar Asset
+func (cli *CLI) ResolveAsset(name string) (*microstellar.Asset, error) {
+	return cli.client.ResolveAsset(name)
+}
 
-	return code, nil
+// GetAccount returns the account address or seed for "name". Set keyType
+// to "address" or "seed" to specify the return value. Seeds stored as secret
+// references (env: or exec:) are fetched from the provider.
+func (cli *CLI) GetAccount(name, keyType string) (string, error) {
+	return cli.client.GetAccount(name, keyType)
 }
 
 // GetAccountOrSeed returns the account address or seed for "name". It prefers
 // keyType ("address" or "seed")
 func (cli *CLI) GetAccountOrSeed(name, keyType string) (string, error) {
-	code, err := cli.GetAccount(name, keyType)
+	return cli.client.GetAccountOrSeed(name, keyType)
+}
 
+// listAliases returns the sorted, unique names of all aliases of kind ("account" or
+// "asset") in the current namespace.
+func (cli *CLI) listAliases(kind string) ([]string, error) {
+	keys, err := cli.ListVars(kind + ":")
 	if err != nil {
-		if keyType == "address" {
-			keyType = "seed"
-		} else {
-			keyType = "address"
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, kind+":")
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			name = name[:i]
 		}
 
-		code, err = cli.GetAccount(name, keyType)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
 	}
 
-	return code, err
+	return names, nil
 }
 
-// LoadAccount loads information for "name" from horizon.
-func (cli *CLI) LoadAccount(logFields logrus.Fields, name string) *microstellar.Account {
-	address, err := cli.ResolveAccount(logFields, name, "address")
-
+// listNamespaces returns the sorted names of the namespaces with keys in the
+// store, along with the current namespace.
+func (cli *CLI) listNamespaces() ([]string, error) {
+	keys, err := cli.store.Keys("")
 	if err != nil {
-		cli.error(logFields, "invalid address: %s", name)
-		return nil
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{"global": true}
+	for _, key := range append(keys, cli.ns+":") {
+		parts := strings.SplitN(key, ":", 2)
+		if len(parts) == 2 && parts[0] != "" && !seen[parts[0]] {
+			seen[parts[0]] = true
+			names = append(names, parts[0])
+		}
 	}
 
-	account, err := cli.ms.LoadAccount(address)
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadAccount loads information for "name" from horizon.
+func (cli *CLI) LoadAccount(logFields logrus.Fields, name string) *microstellar.Account {
+	account, err := cli.client.LoadAccount(name)
 
 	if err != nil {
-		cli.error(logFields, "can't load account: %v", microstellar.ErrorString(err))
+		cli.error(logFields, "can't load account: %s", err)
 		return nil
 	}
 
@@ -1,71 +1,75 @@
 package cli
 
 import (
-	"encoding/json"
 	"time"
 
+	"github.com/0xfe/lumen/client"
 	"github.com/0xfe/microstellar"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
-func showEntry(logFields logrus.Fields, entry interface{}, format string) {
-	if format == "json" {
-		data, err := json.MarshalIndent(entry, "", "  ")
+// showEntry shows an entry from a watched stream, as JSON unless --output
+// selects another format.
+func (cli *CLI) showEntry(logFields logrus.Fields, entry interface{}) {
+	format := cli.outputFormat()
+	if format == "" {
+		format = "json"
+	}
 
-		if err != nil {
-			logrus.WithFields(logFields).Errorf("skipping bad data: %v", err)
-		} else {
-			showSuccess("%v", string(data))
-		}
-	} else {
-		showSuccess("%+v", entry)
+	if err := writeResult(cli.stdout, entry, format); err != nil {
+		cli.logger.WithFields(logFields).Errorf("skipping bad data: %v", err)
 	}
 }
 
-func watch(ms *microstellar.MicroStellar, logFields logrus.Fields, entity string, address string, format string, stopFunc *func(), opts *microstellar.Options) error {
+// watch streams entity to the output until the command is cancelled, or the
+// watcher is stopped.
+func (cli *CLI) watch(logFields logrus.Fields, entity string, address string, opts *microstellar.Options) error {
 	var watcher interface{}
 	var err error
 	var streamErr *error
 
-	for err == nil {
+	for err == nil && cli.ctx.Err() == nil {
 		switch entity {
 		case "payments":
-			watcher, err = ms.WatchPayments(address, opts)
-			*stopFunc = watcher.(*microstellar.PaymentWatcher).Done
+			watcher, err = cli.ms.WatchPayments(address, opts)
+			cli.setStopWatcher(watcher.(*microstellar.PaymentWatcher).Done)
 			streamErr = watcher.(*microstellar.PaymentWatcher).Err
 			for entry := range watcher.(*microstellar.PaymentWatcher).Ch {
-				showEntry(logFields, entry, format)
+				cli.showEntry(logFields, entry)
 			}
 		case "transactions":
-			watcher, err = ms.WatchTransactions(address, opts)
-			*stopFunc = watcher.(*microstellar.TransactionWatcher).Done
+			watcher, err = cli.ms.WatchTransactions(address, opts)
+			cli.setStopWatcher(watcher.(*microstellar.TransactionWatcher).Done)
 			streamErr = watcher.(*microstellar.TransactionWatcher).Err
 			for entry := range watcher.(*microstellar.TransactionWatcher).Ch {
-				showEntry(logFields, entry, format)
+				cli.showEntry(logFields, entry)
 			}
 		case "ledger":
-			watcher, err = ms.WatchLedgers(opts)
-			*stopFunc = watcher.(*microstellar.LedgerWatcher).Done
+			watcher, err = cli.ms.WatchLedgers(opts)
+			cli.setStopWatcher(watcher.(*microstellar.LedgerWatcher).Done)
 			streamErr = watcher.(*microstellar.LedgerWatcher).Err
 			for entry := range watcher.(*microstellar.LedgerWatcher).Ch {
-				showEntry(logFields, entry, format)
+				cli.showEntry(logFields, entry)
 			}
 		default:
 			return errors.Errorf("invalid watch entity: %s", entity)
 		}
 
 		if *streamErr != nil {
-			debugf(logFields, "connection closed: %v", *streamErr)
+			cli.debugf(logFields, "connection closed: %v", *streamErr)
 		}
 
 		if err != nil {
 			return errors.Wrapf(err, "can't watch address: %v", microstellar.ErrorString(err))
 		}
 
-		debugf(logFields, "retrying in 2s...")
-		time.Sleep(2 * time.Second)
+		cli.debugf(logFields, "retrying in 2s...")
+		select {
+		case <-cli.ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
 	}
 
 	return nil
@@ -88,7 +92,7 @@ func (cli *CLI) buildWatchCmd() *cobra.Command {
 				address, err = cli.ResolveAccount(logFields, name, "address")
 
 				if err != nil {
-					cli.error(logFields, "invalid address: %s", name)
+					cli.errorKind(ErrResolution, logFields, "invalid address: %s", name)
 					return
 				}
 			}
@@ -100,17 +104,21 @@ func (cli *CLI) buildWatchCmd() *cobra.Command {
 				opts = opts.WithCursor(cursor)
 			}
 
-			format, _ := cmd.Flags().GetString("format")
-			err := watch(cli.ms, logFields, entity, address, format, &cli.stopWatcher, opts)
+			if cli.offline {
+				cli.error(logFields, "can't watch stream: %v", client.ErrOffline)
+				return
+			}
+
+			err := cli.watch(logFields, entity, address, opts)
 
 			if err != nil {
-				cli.error(logFields, "can't watch stream: %v", microstellar.ErrorString(err))
+				cli.error(logFields, "can't watch stream: %v", err)
 				return
 			}
 		},
 	}
 
-	cmd.Flags().String("format", "json", "output format (json, yaml, struct)")
+	addFormatAlias(cmd)
 	cmd.Flags().String("cursor", "now", "start watching from (now, start, paging_token)")
 
 	return cmd
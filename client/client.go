@@ -0,0 +1,390 @@
+// Package client is the Go API for Lumen. It resolves account and asset
+// aliases from a Lumen data store the same way the lumen command does, and
+// builds, signs, and submits transactions on the Stellar network.
+//
+//	s, _ := store.NewStore("file", "/home/mo/.lumen-data.yml")
+//	c := client.New(s, client.Options{})
+//	result, err := c.Pay(ctx, client.PayRequest{From: "mo", To: "bob", Amount: "10"})
+//
+// A Client only writes to the store to record payments for the daily limits
+// of spending policies (see Policy), and is safe for concurrent use.
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xfe/lumen/agent"
+	"github.com/0xfe/lumen/store"
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures a Client. All fields are optional.
+type Options struct {
+	// Namespace for aliases. Defaults to the namespace selected in the store
+	// (with "lumen ns"), or "default".
+	Namespace string
+
+	// Network is a microstellar network spec, e.g., "test", "public", or
+	// "custom;url;passphrase", or the name of a network profile (see
+	// LoadNetwork.) Defaults to the namespace's config:network variable, or
+	// "test".
+	Network string
+
+	// Friendbot is the URL of the friendbot used by Fund. Defaults to the
+	// network profile's friendbot, or DefaultFriendbot on the test network.
+	Friendbot string
+
+	// Fee is the base fee for transactions, in stroops per operation. Zero
+	// uses the network's minimum.
+	Fee uint32
+
+	// Timeout limits how long transactions wait for the network. Zero
+	// means no limit.
+	Timeout time.Duration
+
+	// Agent signs transactions instead of seeds from the store.
+	Agent *agent.Client
+
+	// Secrets caches seeds fetched from secret references. Share it between
+	// clients to avoid running secret helpers repeatedly.
+	Secrets *Secrets
+
+	// Stderr is passed to secret helpers, so they can prompt the user.
+	// Defaults to os.Stderr.
+	Stderr io.Writer
+
+	// Logger defaults to the standard logrus logger.
+	Logger *logrus.Logger
+
+	// Offline refuses network access, e.g., to build transactions on an
+	// air-gapped machine. Transactions need TxOptions.Sequence, and are
+	// returned in TxResult.Envelope instead of being submitted.
+	Offline bool
+}
+
+// Client is a Lumen client bound to a store, namespace, and network.
+type Client struct {
+	store     store.API
+	ns        string
+	network   string
+	friendbot string
+	fee       uint32
+	timeout   time.Duration
+	agent     *agent.Client
+	secrets   *Secrets
+	stderr    io.Writer
+	logger    *logrus.Logger
+	offline   bool
+}
+
+// New returns a client that reads aliases from s.
+func New(s store.API, opts Options) *Client {
+	c := &Client{
+		store:     s,
+		ns:        opts.Namespace,
+		network:   opts.Network,
+		friendbot: opts.Friendbot,
+		fee:       opts.Fee,
+		timeout:   opts.Timeout,
+		agent:     opts.Agent,
+		secrets:   opts.Secrets,
+		stderr:    opts.Stderr,
+		logger:    opts.Logger,
+		offline:   opts.Offline,
+	}
+
+	if c.secrets == nil {
+		c.secrets = NewSecrets()
+	}
+
+	if c.stderr == nil {
+		c.stderr = os.Stderr
+	}
+
+	if c.logger == nil {
+		c.logger = logrus.StandardLogger()
+	}
+
+	if c.ns == "" {
+		if ns, err := s.Get("global:ns"); err == nil {
+			c.ns = ns
+		} else {
+			c.ns = "default"
+		}
+	}
+
+	if c.network == "" {
+		if network, err := c.getVar("vars:config:network"); err == nil {
+			c.network = network
+		} else {
+			c.network = "test"
+		}
+	}
+
+	if !BuiltinNetwork(c.network) {
+		if network, err := LoadNetwork(s, c.network); err == nil {
+			c.network = network.Spec()
+			if c.friendbot == "" {
+				c.friendbot = network.Friendbot
+			}
+		}
+	}
+
+	if c.friendbot == "" && c.network == "test" {
+		c.friendbot = DefaultFriendbot
+	}
+
+	return c
+}
+
+// Namespace returns the namespace used for aliases.
+func (c *Client) Namespace() string {
+	return c.ns
+}
+
+// Network returns the microstellar network spec.
+func (c *Client) Network() string {
+	return c.network
+}
+
+// Offline returns true if the client doesn't access the network.
+func (c *Client) Offline() bool {
+	return c.offline
+}
+
+func (c *Client) debugf(method string, msg string, args ...interface{}) {
+	c.logger.WithFields(logrus.Fields{"type": "client", "method": method}).Debugf(msg, args...)
+}
+
+// microstellar returns a fresh microstellar instance, which keeps the state of
+// a single transaction. Offline, it has no horizon server.
+func (c *Client) microstellar() *microstellar.MicroStellar {
+	if c.offline {
+		return microstellar.NewFromSpec(OfflineNetwork(c.network))
+	}
+
+	return microstellar.NewFromSpec(c.network)
+}
+
+// getVar reads key in the client's namespace.
+func (c *Client) getVar(key string) (string, error) {
+	return c.store.Get(fmt.Sprintf("%s:%s", c.ns, key))
+}
+
+// GetAccount returns the account address or seed for alias name. Set keyType
+// to "address" or "seed" to specify the return value. Seeds stored as secret
+// references (env: or exec:) are fetched from the provider.
+func (c *Client) GetAccount(name, keyType string) (string, error) {
+	if keyType != "address" && keyType != "seed" {
+		return name, errors.Errorf("invalid key type: %s", keyType)
+	}
+
+	code, err := c.getVar(fmt.Sprintf("account:%s:%s", name, keyType))
+	if err != nil {
+		return name, err
+	}
+
+	if keyType == "seed" && IsSecretRef(code) {
+		return c.resolveSecret(name, code)
+	}
+
+	return code, nil
+}
+
+// GetAccountOrSeed returns the account address or seed for alias name. It
+// prefers keyType ("address" or "seed").
+func (c *Client) GetAccountOrSeed(name, keyType string) (string, error) {
+	code, err := c.GetAccount(name, keyType)
+
+	if err != nil {
+		if keyType == "address" {
+			keyType = "seed"
+		} else {
+			keyType = "address"
+		}
+
+		code, err = c.GetAccount(name, keyType)
+	}
+
+	return code, err
+}
+
+// ResolveAccount returns an address or seed (depending on keyType) for name,
+// which can be an address, a seed, an alias, or a federation address.
+func (c *Client) ResolveAccount(name string, keyType string) (string, error) {
+	var err error
+	addressOrSeed := name
+
+	if strings.Contains(name, "*") && c.offline {
+		return "", errors.Wrapf(ErrOffline, "can't resolve federation address %s", name)
+	}
+
+	if strings.Contains(name, "*") {
+		c.debugf("ResolveAccount", "resolving federation address: %s", name)
+		resolvedAddr, err := c.microstellar().Resolve(name)
+
+		if err == nil {
+			c.debugf("ResolveAccount", "got address: %s = %s", name, resolvedAddr)
+			addressOrSeed = resolvedAddr
+			name = resolvedAddr
+		}
+	}
+
+	if !microstellar.ValidAddressOrSeed(name) {
+		addressOrSeed, err = c.GetAccountOrSeed(name, keyType)
+		if err != nil {
+			c.debugf("ResolveAccount", "can't get account %s: %v", name, err)
+			return "", resolveErrorf(name, "invalid address, seed, or account name: %s", name)
+		}
+
+		if strings.Contains(addressOrSeed, "*") {
+			return c.ResolveAccount(addressOrSeed, keyType)
+		}
+	}
+
+	return addressOrSeed, nil
+}
+
+// ResolveAsset returns the asset for name, which can be "native" (or empty),
+// an alias, or code:issuer[:type].
+func (c *Client) ResolveAsset(name string) (*microstellar.Asset, error) {
+	if name == "" || name == "native" {
+		return microstellar.NativeAsset, nil
+	}
+
+	var code, issuer, assetType string
+	if strings.Contains(name, ":") {
+		var issuerName string
+		parts := strings.Split(name, ":")
+		if len(parts) < 2 {
+			return nil, resolveErrorf(name, "bad asset: %s", name)
+		}
+
+		code = parts[0]
+		issuerName = parts[1]
+
+		if len(parts) > 2 {
+			assetType = parts[2]
+		} else {
+			if len(code) <= 5 {
+				assetType = string(microstellar.Credit4Type)
+			} else {
+				assetType = string(microstellar.Credit12Type)
+			}
+		}
+
+		var err error
+		issuer, err = c.ResolveAccount(issuerName, "address")
+		if err != nil {
+			return nil, resolveErrorf(name, "bad asset issuer: %v", issuerName)
+		}
+	} else {
+		readField := func(field string) (string, error) {
+			return c.getVar(fmt.Sprintf("asset:%s:%s", name, field))
+		}
+
+		var err1, err2, err3 error
+		code, err1 = readField("code")
+		issuer, err2 = readField("issuer")
+		assetType, err3 = readField("type")
+
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, resolveErrorf(name, "could not read asset: %v, %v, %v", err1, err2, err3)
+		}
+	}
+
+	var asset *microstellar.Asset
+
+	if assetType == string(microstellar.Credit4Type) {
+		asset = microstellar.NewAsset(code, issuer, microstellar.Credit4Type)
+	} else if assetType == string(microstellar.Credit12Type) {
+		asset = microstellar.NewAsset(code, issuer, microstellar.Credit12Type)
+	} else {
+		asset = microstellar.NativeAsset
+	}
+
+	c.debugf("ResolveAsset", "got asset: %+v", asset)
+	return asset, nil
+}
+
+// LoadAccount loads the account for name from horizon.
+func (c *Client) LoadAccount(name string) (*microstellar.Account, error) {
+	address, err := c.ResolveAccount(name, "address")
+	if err != nil {
+		return nil, resolveErrorf(name, "invalid address: %s", name)
+	}
+
+	if c.offline {
+		return nil, errors.Wrapf(ErrOffline, "can't load account %s", name)
+	}
+
+	account, err := c.microstellar().LoadAccount(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load account")
+	}
+
+	return account, nil
+}
+
+// NextSequence returns the sequence number of the next transaction of account
+// name, for building transactions offline (see TxOptions.Sequence.)
+func (c *Client) NextSequence(name string) (int64, error) {
+	account, err := c.LoadAccount(name)
+	if err != nil {
+		return 0, err
+	}
+
+	seq, err := strconv.ParseInt(account.Sequence, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "bad sequence number for %s: %s", name, account.Sequence)
+	}
+
+	return seq + 1, nil
+}
+
+// Balances returns the balances of account name, starting with the native
+// balance.
+func (c *Client) Balances(ctx context.Context, name string) ([]microstellar.Balance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	account, err := c.LoadAccount(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]microstellar.Balance{account.NativeBalance}, account.Balances...), nil
+}
+
+// Balance returns the balance of asset (a name, or code:issuer[:type]) in
+// account name, or "0" if the account doesn't trust the asset.
+func (c *Client) Balance(ctx context.Context, name string, assetName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	asset, err := c.ResolveAsset(assetName)
+	if err != nil {
+		return "", resolveErrorf(assetName, "bad asset: %s", assetName)
+	}
+
+	account, err := c.LoadAccount(name)
+	if err != nil {
+		return "", err
+	}
+
+	if balance := account.GetBalance(asset); balance != "" {
+		return balance, nil
+	}
+
+	return "0", nil
+}
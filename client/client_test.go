@@ -0,0 +1,586 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	testSeed    = "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU"
+	testAddress = "GDGO2Z2556NQ2JXFHQH2CUIF3E54KTHZIDA7EGUZSG4TJXPV6YZ4MEI4"
+	testTarget  = "GBY7XDYKXBDHQ2B523SF7K6BNJNRYHVQMWY7AYAEKTYLCQMYVFHL57UM"
+)
+
+func newTestClient(t *testing.T, opts Options) *Client {
+	s, err := store.NewStore("internal", "")
+	if err != nil {
+		t.Fatalf("couldn't setup internal store: %v", err)
+	}
+
+	s.Set("global:ns", "test", 0)
+	s.Set("test:vars:config:network", "fake", 0)
+	s.Set("test:account:mo:seed", testSeed, 0)
+	s.Set("test:account:mo:address", testAddress, 0)
+	s.Set("test:account:kelly:address", testTarget, 0)
+	s.Set("test:asset:USD:code", "USD", 0)
+	s.Set("test:asset:USD:issuer", testTarget, 0)
+	s.Set("test:asset:USD:type", string(microstellar.Credit4Type), 0)
+
+	return New(s, opts)
+}
+
+func TestNew(t *testing.T) {
+	c := newTestClient(t, Options{})
+	if c.Namespace() != "test" || c.Network() != "fake" {
+		t.Errorf("want test/fake, got %s/%s", c.Namespace(), c.Network())
+	}
+
+	c = newTestClient(t, Options{Namespace: "other", Network: "public"})
+	if c.Namespace() != "other" || c.Network() != "public" {
+		t.Errorf("want other/public, got %s/%s", c.Namespace(), c.Network())
+	}
+
+	// Aliases are read from the client's namespace
+	if _, err := c.ResolveAccount("mo", "address"); err == nil {
+		t.Errorf("want error resolving mo in namespace other")
+	}
+}
+
+func TestResolveAccount(t *testing.T) {
+	c := newTestClient(t, Options{})
+
+	tests := []struct {
+		name    string
+		keyType string
+		want    string
+	}{
+		{"mo", "address", testAddress},
+		{"mo", "seed", testSeed},
+		{"kelly", "address", testTarget},
+		{"kelly", "seed", testTarget}, // no seed, falls back to the address
+		{testTarget, "address", testTarget},
+		{testSeed, "address", testSeed},
+	}
+
+	for _, test := range tests {
+		got, err := c.ResolveAccount(test.name, test.keyType)
+		if err != nil || got != test.want {
+			t.Errorf("ResolveAccount(%s, %s): want %s, got %s, %v", test.name, test.keyType, test.want, got, err)
+		}
+	}
+
+	if _, err := c.ResolveAccount("bob", "address"); err == nil {
+		t.Errorf("ResolveAccount(bob): want error")
+	}
+}
+
+func TestResolveAsset(t *testing.T) {
+	c := newTestClient(t, Options{})
+
+	tests := []struct {
+		name string
+		want *microstellar.Asset
+	}{
+		{"", microstellar.NativeAsset},
+		{"native", microstellar.NativeAsset},
+		{"USD", microstellar.NewAsset("USD", testTarget, microstellar.Credit4Type)},
+		{"EUR:kelly", microstellar.NewAsset("EUR", testTarget, microstellar.Credit4Type)},
+		{"CHOCOLATE:kelly", microstellar.NewAsset("CHOCOLATE", testTarget, microstellar.Credit12Type)},
+	}
+
+	for _, test := range tests {
+		got, err := c.ResolveAsset(test.name)
+		if err != nil || !got.Equals(*test.want) {
+			t.Errorf("ResolveAsset(%s): want %+v, got %+v, %v", test.name, test.want, got, err)
+		}
+	}
+
+	for _, name := range []string{"EUR", "EUR:bob"} {
+		if _, err := c.ResolveAsset(name); err == nil {
+			t.Errorf("ResolveAsset(%s): want error", name)
+		}
+	}
+}
+
+func TestSecretRef(t *testing.T) {
+	c := newTestClient(t, Options{})
+	c.store.Set("test:account:bob:seed", "env:LUMEN_TEST_CLIENT_SEED", 0)
+
+	if _, err := c.GetAccount("bob", "seed"); err == nil {
+		t.Errorf("want error for unset environment variable")
+	}
+
+	os.Setenv("LUMEN_TEST_CLIENT_SEED", testSeed)
+	defer os.Unsetenv("LUMEN_TEST_CLIENT_SEED")
+
+	seed, err := c.ResolveAccount("bob", "seed")
+	if err != nil || seed != testSeed {
+		t.Errorf("want %s, got %s, %v", testSeed, seed, err)
+	}
+}
+
+func TestPay(t *testing.T) {
+	c := newTestClient(t, Options{})
+	ctx := context.Background()
+
+	result, err := c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "10", TxOptions: TxOptions{MemoText: "hi"}})
+	if err != nil || result == nil {
+		t.Errorf("Pay: got %+v, %v", result, err)
+	}
+
+	result, err = c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "10", TxOptions: TxOptions{NoSubmit: true}})
+	if err != nil || result.Envelope == "" {
+		t.Errorf("Pay with NoSubmit: want envelope, got %+v, %v", result, err)
+	}
+
+	if _, err := c.Pay(ctx, PayRequest{From: "mo", To: "bob", Amount: "10"}); err == nil {
+		t.Errorf("Pay to bob: want error")
+	}
+
+	if _, err := c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "10", TxOptions: TxOptions{MemoID: "bad"}}); err == nil {
+		t.Errorf("Pay with bad memoid: want error")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.Pay(cancelled, PayRequest{From: "mo", To: "kelly", Amount: "10"}); err != context.Canceled {
+		t.Errorf("Pay with cancelled context: want %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestSetFee(t *testing.T) {
+	tx, err := build.Transaction(
+		build.SourceAccount{AddressOrSeed: testAddress},
+		build.Sequence{Sequence: 1},
+		build.TestNetwork,
+		build.Payment(build.Destination{AddressOrSeed: testTarget}, build.NativeAmount{Amount: "10"}),
+		build.Payment(build.Destination{AddressOrSeed: testTarget}, build.NativeAmount{Amount: "20"}),
+	)
+	if err != nil {
+		t.Fatalf("build.Transaction: %v", err)
+	}
+
+	txe, _ := tx.Sign()
+	envelope, _ := txe.Base64()
+
+	envelope, err = setFee(envelope, 250)
+	if err != nil {
+		t.Fatalf("setFee: %v", err)
+	}
+
+	decoded, err := microstellar.DecodeTx(envelope)
+	if err != nil || decoded.Tx.Fee != 500 {
+		t.Errorf("setFee: want fee 500 for 2 operations, got %+v, %v", decoded, err)
+	}
+
+	// The fee isn't set on the fake network, which has no real transactions.
+	c := newTestClient(t, Options{Fee: 250})
+	if _, err := c.Pay(context.Background(), PayRequest{From: "mo", To: "kelly", Amount: "10"}); err != nil {
+		t.Errorf("Pay with fee: %v", err)
+	}
+}
+
+func TestNetworkProfiles(t *testing.T) {
+	var funded string
+	friendbot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		funded = r.URL.Query().Get("addr")
+		w.Write([]byte("funded"))
+	}))
+	defer friendbot.Close()
+
+	s, _ := store.NewStore("internal", "")
+	s.Set(NetworkKey("local", "horizon"), "http://localhost:8000", 0)
+	s.Set(NetworkKey("local", "passphrase"), "Standalone Network ; February 2017", 0)
+	s.Set(NetworkKey("local", "friendbot"), friendbot.URL, 0)
+	s.Set(NetworkKey("staging", "horizon"), "https://horizon.example.com", 0)
+	s.Set(NetworkKey("staging", "passphrase"), "Staging", 0)
+
+	names, err := ListNetworks(s)
+	if err != nil || len(names) != 2 || names[0] != "local" || names[1] != "staging" {
+		t.Errorf("ListNetworks: got %v, %v", names, err)
+	}
+
+	if _, err := LoadNetwork(s, "nowhere"); !IsResolveError(err) {
+		t.Errorf("LoadNetwork(nowhere): want ResolveError, got %v", err)
+	}
+
+	c := New(s, Options{Namespace: "test", Network: "local"})
+	if c.Network() != "custom;http://localhost:8000;Standalone Network ; February 2017" || c.Friendbot() != friendbot.URL {
+		t.Errorf("New: want local network, got %s (friendbot %s)", c.Network(), c.Friendbot())
+	}
+
+	response, err := c.Fund(context.Background(), testAddress)
+	if err != nil || response != "funded" || funded != testAddress {
+		t.Errorf("Fund: got %q, %v (funded %s)", response, err, funded)
+	}
+
+	if c := New(s, Options{Namespace: "test", Network: "staging"}); c.Friendbot() != "" {
+		t.Errorf("staging: want no friendbot, got %s", c.Friendbot())
+	} else if _, err := c.Fund(context.Background(), testAddress); err == nil {
+		t.Errorf("Fund on staging: want error")
+	}
+
+	for spec, want := range map[string]bool{
+		"public": true,
+		"custom;https://horizon.example.com;Public Global Stellar Network ; September 2015": true,
+		"test":           false,
+		c.Network():      false,
+		"fake":           false,
+		"custom;public;": false,
+	} {
+		if IsPublicNetwork(spec) != want {
+			t.Errorf("IsPublicNetwork(%s): want %v", spec, want)
+		}
+	}
+
+	if c := New(s, Options{Namespace: "test", Network: "test"}); c.Friendbot() != DefaultFriendbot {
+		t.Errorf("test: want %s, got %s", DefaultFriendbot, c.Friendbot())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{
+			"id": "` + address + `", "account_id": "` + address + `",
+			"sequence": "100", "subentry_count": 0,
+			"thresholds": {"low_threshold": 0, "med_threshold": 2, "high_threshold": 3},
+			"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+			"signers": [
+				{"public_key": "` + testAddress + `", "weight": 1, "key": "` + testAddress + `", "type": "ed25519_public_key"},
+				{"public_key": "` + testTarget + `", "weight": 1, "key": "` + testTarget + `", "type": "ed25519_public_key"}
+			]}`))
+	}))
+	defer horizon.Close()
+
+	c := newTestClient(t, Options{Network: "custom;" + horizon.URL + ";Test SDF Network ; September 2015", Fee: 200})
+	ctx := context.Background()
+
+	result, err := c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "10", Asset: "USD", TxOptions: TxOptions{MemoText: "hi", DryRun: true}})
+	if err != nil || result.Preview == nil {
+		t.Fatalf("Pay: want preview, got %+v, %v", result, err)
+	}
+
+	p := result.Preview
+	if p.Source != testAddress || p.SourceName != "mo" || p.Sequence != 101 || p.Fee != 200 || p.Memo != `text "hi"` {
+		t.Errorf("Pay: got preview %+v", p)
+	}
+
+	if len(p.Operations) != 1 || p.Operations[0].Description != "pay 10 USD to kelly" {
+		t.Errorf("Pay: got operations %+v", p.Operations)
+	}
+
+	// mo's seed is in the store, but kelly's isn't.
+	if p.Threshold != "medium" || p.Required != 2 || p.Available != 1 || len(p.Signers) != 2 || !p.Signers[0].HasKey || p.Signers[1].HasKey {
+		t.Errorf("Pay: got signers %+v", p)
+	}
+
+	result, err = c.Trust(ctx, TrustRequest{Account: testAddress, Asset: "EUR:kelly", TxOptions: TxOptions{DryRun: true}})
+	if err != nil || result.Preview.SubentryChange != 1 || result.Preview.ReserveChange != "0.5" || result.Preview.SourceName != "mo" {
+		t.Errorf("Trust: got %+v, %v", result, err)
+	}
+
+	// Accounts without seeds can be previewed.
+	result, err = c.Pay(ctx, PayRequest{From: "kelly", To: "mo", Amount: "10", TxOptions: TxOptions{DryRun: true}})
+	if err != nil || result.Preview.Source != testTarget || result.Preview.Operations[0].Description != "pay 10 XLM to mo" {
+		t.Errorf("Pay from kelly: got %+v, %v", result, err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			w.Write([]byte(`{"hash": "abcd", "ledger": 42}`))
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{
+			"id": "` + address + `", "account_id": "` + address + `", "sequence": "100",
+			"thresholds": {"low_threshold": 0, "med_threshold": 0, "high_threshold": 0},
+			"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+			"signers": [{"public_key": "` + address + `", "weight": 1, "key": "` + address + `", "type": "ed25519_public_key"}]}`))
+	}))
+	defer horizon.Close()
+
+	c := newTestClient(t, Options{Network: "custom;" + horizon.URL + ";Test SDF Network ; September 2015"})
+	ctx := context.Background()
+
+	pay := func(to, amount, asset string, opts TxOptions) (*TxResult, error) {
+		return c.Pay(ctx, PayRequest{From: "mo", To: to, Amount: amount, Asset: asset, TxOptions: opts})
+	}
+
+	// Without a policy, anything goes.
+	if result, err := pay("kelly", "1000", "USD", TxOptions{}); err != nil || result.Hash != "abcd" {
+		t.Fatalf("Pay without policy: got %+v, %v", result, err)
+	}
+
+	c.store.Set(PolicyKey("test", PolicyMaxPayment, "USD:"+testTarget), "100", 0)
+	c.store.Set(PolicyKey("test", PolicyDailyLimit, "native"), "25", 0)
+	c.store.Set(PolicyKey("test", PolicyDestinations, ""), "kelly,"+testAddress, 0)
+
+	policy, err := c.Policy()
+	if err != nil || policy.MaxPayment["USD:"+testTarget] != "100" || policy.DailyLimit["native"] != "25" || len(policy.Destinations) != 2 {
+		t.Fatalf("Policy: got %+v, %v", policy, err)
+	}
+
+	_, err = pay("kelly", "150", "USD", TxOptions{})
+	if !IsPolicyError(err) || !strings.Contains(err.Error(), "payment of 150 USD to kelly is over the maximum of 100") {
+		t.Errorf("Pay over maximum: want policy error, got %v", err)
+	}
+
+	if _, err := pay("kelly", "100", "USD", TxOptions{}); err != nil {
+		t.Errorf("Pay at maximum: got %v", err)
+	}
+
+	_, err = pay("GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U", "1", "", TxOptions{})
+	if !IsPolicyError(err) || !strings.Contains(err.Error(), "destination GBH6GGAPBFH6IXCQBPJ7WSN2WMUFU7PO346BIVZXS6Q22YNFBUNVJS4U is not allowed") {
+		t.Errorf("Pay to other destination: want policy error, got %v", err)
+	}
+
+	// Payments count towards the daily limit once they're submitted.
+	for i := 0; i < 2; i++ {
+		if _, err := pay("kelly", "10", "", TxOptions{}); err != nil {
+			t.Fatalf("Pay %d under daily limit: got %v", i, err)
+		}
+	}
+
+	// Records older than the window don't count, even if they haven't expired.
+	old := time.Now().Add(-SpendingWindow - time.Minute).UnixNano()
+	c.store.Set(spendingPrefix("test", "native")+strconv.FormatInt(old, 10), "1000000000", 0)
+
+	if spent, err := c.spent("native"); err != nil || spent != 200000000 {
+		t.Errorf("spent: want 20 XLM, got %d, %v", spent, err)
+	}
+
+	_, err = pay("kelly", "10", "", TxOptions{})
+	if !IsPolicyError(err) || !strings.Contains(err.Error(), "paying 10 XLM is over the daily limit of 25 (20 paid") {
+		t.Errorf("Pay over daily limit: want policy error, got %v", err)
+	}
+
+	// Dry runs and unsubmitted transactions show violations without failing.
+	result, err := pay("kelly", "10", "", TxOptions{DryRun: true})
+	if err != nil || len(result.Preview.Violations) != 1 {
+		t.Errorf("Pay dry run: want violation, got %+v, %v", result, err)
+	}
+
+	c.store.Set(PolicyKey("test", PolicyForbiddenAssets, ""), "USD:"+testTarget, 0)
+	c.store.Set(PolicyKey("test", PolicyRequireSigners, ""), "2", 0)
+
+	result, err = pay("kelly", "1", "USD", TxOptions{NoSubmit: true})
+	if err != nil {
+		t.Fatalf("Pay without submitting: got %v", err)
+	}
+
+	violations, err := c.CheckPolicy(result.Envelope)
+	if err != nil || strings.Join(violations, "; ") != "needs 2 signers, has 1; asset USD is forbidden" {
+		t.Errorf("CheckPolicy: got %v, %v", violations, err)
+	}
+
+	if err := c.EnforcePolicy(result.Envelope); !IsPolicyError(err) {
+		t.Errorf("EnforcePolicy: want policy error, got %v", err)
+	}
+
+	// Bad limits are errors, not missing rules.
+	c.store.Set(PolicyKey("test", PolicyMaxPayment, "USD:"+testTarget), "lots", 0)
+	if _, err := c.Policy(); err == nil {
+		t.Errorf("Policy with bad max payment: want error")
+	}
+
+	if _, err := c.CheckPolicy(result.Envelope); err == nil || IsPolicyError(err) {
+		t.Errorf("CheckPolicy with bad max payment: want error, got %v", err)
+	}
+
+	if _, err := c.checkPolicy(&Policy{DailyLimit: map[string]string{"native": "lots"}}, &xdr.TransactionEnvelope{}, 1); err == nil {
+		t.Errorf("checkPolicy with bad daily limit: want error")
+	}
+}
+
+func TestAliasesEncrypted(t *testing.T) {
+	base, _ := store.NewStore("internal", "")
+	base.Set("global:ns", "test", 0)
+
+	enc := store.NewEncryptedStore(base, func() (string, error) { return "secret", nil })
+	enc.Enable()
+	enc.Set("test:account:mo:seed", testSeed, 0)
+	enc.Set("test:account:mo:address", testAddress, 0)
+	bob, _ := keypair.Random()
+	enc.Set("test:account:bob:seed", bob.Seed(), 0)
+	enc.Set("test:account:kelly:seed", "env:KELLY_SEED", 0)
+	enc.Set("test:account:kelly:address", testTarget, 0)
+
+	// Seeds are only decrypted to find an unnamed source.
+	unlocks := 0
+	c := New(store.NewEncryptedStore(base, func() (string, error) { unlocks++; return "secret", nil }), Options{})
+	accounts, _, seeded := c.aliases("")
+	if unlocks != 0 || accounts[testAddress] != "mo" || !seeded[testAddress] || !seeded[testTarget] || len(accounts) != 2 {
+		t.Errorf("aliases: got %v, %v, %d unlocks", accounts, seeded, unlocks)
+	}
+
+	accounts, _, _ = c.aliases(testAddress)
+	if unlocks != 0 || accounts[testAddress] != "mo" {
+		t.Errorf("aliases of named source: got %v, %d unlocks", accounts, unlocks)
+	}
+
+	accounts, _, seeded = c.aliases(bob.Address())
+	if unlocks != 1 || accounts[bob.Address()] != "bob" || !seeded[bob.Address()] {
+		t.Errorf("aliases of unnamed source: got %v, %v, %d unlocks", accounts, seeded, unlocks)
+	}
+}
+
+func TestSubmitTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var hangAccounts int32 = 1
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" || atomic.LoadInt32(&hangAccounts) == 1 {
+			<-release
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{"id": "` + address + `", "account_id": "` + address + `", "sequence": "100"}`))
+	}))
+	defer horizon.Close()
+	defer close(release)
+
+	c := newTestClient(t, Options{Network: "custom;" + horizon.URL + ";Test SDF Network ; September 2015", Timeout: 100 * time.Millisecond})
+	pay := func() error {
+		_, err := c.Pay(context.Background(), PayRequest{From: "mo", To: "kelly", Amount: "1"})
+		return err
+	}
+
+	// Timing out before the transaction is sent is a plain timeout.
+	if err := pay(); err != context.DeadlineExceeded {
+		t.Errorf("Pay before submit: want %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// After it's sent, the error says the outcome is unknown.
+	atomic.StoreInt32(&hangAccounts, 0)
+	err := pay()
+	if errors.Cause(err) != context.DeadlineExceeded || !strings.Contains(err.Error(), "may or may not have been applied") {
+		t.Errorf("Pay after submit: want unknown outcome, got %v", err)
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"type": "transaction_failed", "title": "Transaction Failed", "status": 400,
+				"extras": {"result_codes": {"transaction": "tx_bad_seq"}, "result_xdr": "AAAAAAAAAGT////7AAAAAA=="}}`))
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		w.Write([]byte(`{"id": "` + address + `", "account_id": "` + address + `", "sequence": "100",
+			"thresholds": {"low_threshold": 0, "med_threshold": 0, "high_threshold": 0},
+			"balances": [{"balance": "100.0000000", "asset_type": "native"}],
+			"signers": [{"public_key": "` + address + `", "weight": 1, "key": "` + address + `", "type": "ed25519_public_key"}]}`))
+	}))
+	defer horizon.Close()
+
+	c := newTestClient(t, Options{Network: "custom;" + horizon.URL + ";Test SDF Network ; September 2015"})
+
+	var receipt *Receipt
+	opts := TxOptions{Submitted: func(r *Receipt) { receipt = r }}
+	if _, err := c.Pay(context.Background(), PayRequest{From: "mo", To: "kelly", Amount: "10", TxOptions: opts}); err == nil {
+		t.Fatalf("Pay: want error")
+	}
+
+	if receipt == nil || receipt.Status != ReceiptFailed || receipt.Fee != 100 || len(receipt.Hash) != 64 || receipt.Envelope == "" || receipt.Error == "" {
+		t.Errorf("Pay: got receipt %+v", receipt)
+	}
+
+	success := c.Receipt(receipt.Envelope, &microstellar.TxResponse{Hash: "c0ffee", Ledger: 42, Result: "AAAAAAAAAGQAAAAAAAAAAAAAAAA="}, nil)
+	if success.Status != ReceiptSuccess || success.Hash != "c0ffee" || success.Ledger != 42 || success.Fee != 100 || success.Error != "" {
+		t.Errorf("Receipt: got %+v", success)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	horizon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("offline client requested %s", r.URL)
+	}))
+	defer horizon.Close()
+
+	c := newTestClient(t, Options{Network: "custom;" + horizon.URL + ";" + network.PublicNetworkPassphrase, Offline: true})
+	ctx := context.Background()
+
+	if _, err := c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "10"}); err == nil {
+		t.Errorf("Pay without sequence: want error")
+	}
+
+	result, err := c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "10", TxOptions: TxOptions{Sequence: 101}})
+	if err != nil || result.Hash != "" || result.Envelope == "" {
+		t.Fatalf("Pay: want envelope, got %+v, %v", result, err)
+	}
+
+	txe, err := microstellar.DecodeTx(result.Envelope)
+	if err != nil || txe.Tx.SeqNum != 101 || len(txe.Signatures) != 1 {
+		t.Fatalf("Pay: want transaction 101 with a signature, got %+v, %v", txe, err)
+	}
+
+	// Offline transactions are signed for the network's passphrase.
+	hash, _ := network.HashTransaction(&txe.Tx, network.PublicNetworkPassphrase)
+	if kp, _ := keypair.Parse(testAddress); kp.Verify(hash[:], txe.Signatures[0].Signature) != nil {
+		t.Errorf("Pay: want signature for the public network")
+	}
+
+	// Other operations are built without loading the source account too.
+	builds := map[xdr.OperationType]func(TxOptions) (*TxResult, error){
+		xdr.OperationTypeChangeTrust: func(opts TxOptions) (*TxResult, error) {
+			return c.Trust(ctx, TrustRequest{Account: "mo", Asset: "USD", Limit: "100", TxOptions: opts})
+		},
+		xdr.OperationTypeManageOffer: func(opts TxOptions) (*TxResult, error) {
+			return c.ManageOffer(ctx, OfferRequest{Account: "mo", Sell: "native", Buy: "USD", Amount: "1", Price: "2", TxOptions: opts})
+		},
+		xdr.OperationTypePathPayment: func(opts TxOptions) (*TxResult, error) {
+			return c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "1", Asset: "USD", With: "native", Max: "20", Path: []string{"native"}, TxOptions: opts})
+		},
+	}
+
+	for opType, build := range builds {
+		result, err := build(TxOptions{Sequence: 102, MemoText: "hi"})
+		if err != nil {
+			t.Errorf("%v: %v", opType, err)
+			continue
+		}
+
+		txe, err := microstellar.DecodeTx(result.Envelope)
+		if err != nil || txe.Tx.SeqNum != 102 || len(txe.Tx.Operations) != 1 || txe.Tx.Operations[0].Body.Type != opType || txe.Tx.Memo.Text == nil || *txe.Tx.Memo.Text != "hi" {
+			t.Errorf("%v: want transaction 102 with memo, got %+v, %v", opType, txe, err)
+		}
+	}
+
+	for name, err := range map[string]error{
+		"PathPay without path": func() error {
+			_, err := c.Pay(ctx, PayRequest{From: "mo", To: "kelly", Amount: "1", Asset: "USD", With: "native", Max: "20", TxOptions: TxOptions{Sequence: 102}})
+			return err
+		}(),
+		"NextSequence": func() error { _, err := c.NextSequence("mo"); return err }(),
+		"Fund":         func() error { _, err := c.Fund(ctx, "mo"); return err }(),
+		"ResolveAccount": func() error {
+			_, err := c.ResolveAccount("mo*example.com", "address")
+			return err
+		}(),
+	} {
+		if !IsOffline(err) {
+			t.Errorf("%s: want offline error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+
+	"github.com/0xfe/microstellar"
+)
+
+// OfferRequest describes an offer on the DEX to sell Amount of Sell for Buy,
+// at Price units of Buy per unit of Sell.
+type OfferRequest struct {
+	Account string
+	Buy     string
+	Sell    string
+	Amount  string
+	Price   string
+	Passive bool
+
+	// Set one of these to update or delete an existing offer.
+	Update string
+	Delete string
+
+	TxOptions
+}
+
+// ManageOffer creates, updates, or deletes an offer.
+func (c *Client) ManageOffer(ctx context.Context, req OfferRequest) (*TxResult, error) {
+	buyAsset, err := c.ResolveAsset(req.Buy)
+	if err != nil {
+		return nil, resolveErrorf(req.Buy, "invalid buy asset: %s", req.Buy)
+	}
+
+	sellAsset, err := c.ResolveAsset(req.Sell)
+	if err != nil {
+		return nil, resolveErrorf(req.Sell, "invalid sell asset: %s", req.Sell)
+	}
+
+	params := &microstellar.OfferParams{
+		OfferType:  microstellar.OfferCreate,
+		SellAsset:  sellAsset,
+		SellAmount: req.Amount,
+		BuyAsset:   buyAsset,
+		Price:      req.Price,
+	}
+
+	if req.Update != "" {
+		params.OfferType = microstellar.OfferUpdate
+		params.OfferID = req.Update
+	} else if req.Delete != "" {
+		params.OfferType = microstellar.OfferDelete
+		params.OfferID = req.Delete
+	} else if req.Passive {
+		params.OfferType = microstellar.OfferCreatePassive
+	}
+
+	return c.Submit(ctx, req.Account, req.TxOptions, func(b Builder, source string, opts *microstellar.Options) error {
+		return b.ManageOffer(source, params, opts)
+	})
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ResolveError is returned when an account, asset, or signer can't be
+// resolved, e.g., because of a typo in an alias.
+type ResolveError struct {
+	Name string // the name that couldn't be resolved
+	msg  string
+}
+
+func (e *ResolveError) Error() string {
+	return e.msg
+}
+
+func resolveErrorf(name string, msg string, args ...interface{}) error {
+	return &ResolveError{Name: name, msg: fmt.Sprintf(msg, args...)}
+}
+
+// IsResolveError returns true if err was caused by a ResolveError.
+func IsResolveError(err error) bool {
+	_, ok := errors.Cause(err).(*ResolveError)
+	return ok
+}
+
+// ErrOffline is returned by clients in offline mode (see Options.Offline) for
+// anything that needs the network.
+var ErrOffline = errors.New("lumen is offline")
+
+// IsOffline returns true if err was caused by the client being offline.
+func IsOffline(err error) bool {
+	return errors.Cause(err) == ErrOffline
+}
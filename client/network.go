@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/network"
+)
+
+// DefaultFriendbot is the friendbot for the test network.
+const DefaultFriendbot = "https://friendbot.stellar.org"
+
+// Network is a network profile: a custom network saved under a name (with
+// "lumen network add"), so it can be used like "test" or "public".
+type Network struct {
+	Name       string `json:"name"`
+	Horizon    string `json:"horizon"`
+	Passphrase string `json:"passphrase"`
+	Friendbot  string `json:"friendbot,omitempty"`
+}
+
+// Spec returns the microstellar network spec for n.
+func (n *Network) Spec() string {
+	return fmt.Sprintf("custom;%s;%s", n.Horizon, n.Passphrase)
+}
+
+// NetworkKey returns the store key for field (horizon, passphrase, or
+// friendbot) of network profile name. Profiles are shared by all namespaces.
+func NetworkKey(name, field string) string {
+	return fmt.Sprintf("global:network:%s:%s", name, field)
+}
+
+// BuiltinNetwork returns true if name is a network known to microstellar,
+// which can't be used for a profile.
+func BuiltinNetwork(name string) bool {
+	return name == "test" || name == "public" || strings.HasPrefix(name, "fake") || strings.HasPrefix(name, "custom")
+}
+
+// IsPublicNetwork returns true if the network spec is the public network,
+// including custom networks (e.g., a private horizon) with its passphrase.
+func IsPublicNetwork(spec string) bool {
+	parts := strings.SplitN(spec, ";", 3)
+	return parts[0] == "public" || (parts[0] == "custom" && len(parts) == 3 && parts[2] == network.PublicNetworkPassphrase)
+}
+
+// networkPassphrase returns the passphrase of the network spec.
+func networkPassphrase(spec string) string {
+	parts := strings.SplitN(spec, ";", 3)
+	switch {
+	case parts[0] == "public":
+		return network.PublicNetworkPassphrase
+	case parts[0] == "custom" && len(parts) == 3:
+		return parts[2]
+	}
+
+	return network.TestNetworkPassphrase
+}
+
+// LoadNetwork returns network profile name from s.
+func LoadNetwork(s store.API, name string) (*Network, error) {
+	horizon, err := s.Get(NetworkKey(name, "horizon"))
+	if err != nil {
+		return nil, resolveErrorf(name, "no such network: %s", name)
+	}
+
+	passphrase, err := s.Get(NetworkKey(name, "passphrase"))
+	if err != nil {
+		return nil, resolveErrorf(name, "no passphrase for network: %s", name)
+	}
+
+	friendbot, _ := s.Get(NetworkKey(name, "friendbot"))
+	return &Network{Name: name, Horizon: horizon, Passphrase: passphrase, Friendbot: friendbot}, nil
+}
+
+// ListNetworks returns the names of the network profiles in s, in sorted order.
+func ListNetworks(s store.API) ([]string, error) {
+	prefix := "global:network:"
+	keys, err := s.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		name = name[:strings.LastIndex(name, ":")]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// Friendbot returns the friendbot URL for the client's network, or "" if
+// it has none.
+func (c *Client) Friendbot() string {
+	return c.friendbot
+}
+
+// Fund funds account name with the network's friendbot, and returns the
+// friendbot's response.
+func (c *Client) Fund(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	address, err := c.ResolveAccount(name, "address")
+	if err != nil {
+		return "", err
+	}
+
+	if c.offline {
+		return "", errors.Wrap(ErrOffline, "can't fund account")
+	}
+
+	if c.friendbot == "" {
+		return "", errors.Errorf("no friendbot for network: %s", c.network)
+	}
+
+	u, err := url.Parse(c.friendbot)
+	if err != nil {
+		return "", errors.Wrapf(err, "bad friendbot URL: %s", c.friendbot)
+	}
+
+	query := u.Query()
+	query.Set("addr", address)
+	u.RawQuery = query.Encode()
+
+	c.debugf("Fund", "funding %s with %s", address, u)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
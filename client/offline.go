@@ -0,0 +1,243 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+)
+
+// OfflineNetwork returns a network spec with the passphrase of the network
+// spec, and no horizon server, for offline use.
+func OfflineNetwork(spec string) string {
+	// The fake network doesn't need one.
+	if strings.HasPrefix(spec, "fake") {
+		return spec
+	}
+
+	// Requests that get past the checks for offline mode fail without
+	// leaving the process.
+	return "custom;;" + networkPassphrase(spec)
+}
+
+// offlineBuilder builds transactions with an explicit sequence number, so
+// the source account isn't loaded from horizon. Transactions are built
+// unsigned, and passed to handler (see txOptions), which signs them.
+type offlineBuilder struct {
+	passphrase string
+	sequence   int64
+	memo       build.TransactionMutator // nil for no memo
+	handler    microstellar.TxHandler
+}
+
+// newOfflineBuilder returns a builder for transactions on network (a network
+// spec), with the sequence number and memo in opts.
+func newOfflineBuilder(network string, opts TxOptions, handler microstellar.TxHandler) *offlineBuilder {
+	b := &offlineBuilder{
+		passphrase: networkPassphrase(network),
+		sequence:   opts.Sequence,
+		handler:    handler,
+	}
+
+	// As in microstellar, a memo ID replaces the memo text. It's checked by
+	// txOptions.
+	if opts.MemoID != "" {
+		id, _ := strconv.ParseUint(opts.MemoID, 10, 64)
+		b.memo = build.MemoID{Value: id}
+	} else if opts.MemoText != "" {
+		b.memo = build.MemoText{Value: opts.MemoText}
+	}
+
+	return b
+}
+
+// build builds a transaction for source with op, and passes it to the
+// handler.
+func (b *offlineBuilder) build(source string, op build.TransactionMutator) error {
+	muts := []build.TransactionMutator{
+		build.SourceAccount{AddressOrSeed: source},
+		build.Network{Passphrase: b.passphrase},
+		build.Sequence{Sequence: uint64(b.sequence)},
+		op,
+	}
+
+	if b.memo != nil {
+		muts = append(muts, b.memo)
+	}
+
+	tx, err := build.Transaction(muts...)
+	if err != nil {
+		return errors.Wrap(err, "could not build transaction")
+	}
+
+	var txe build.TransactionEnvelopeBuilder
+	if err := txe.Mutate(tx); err != nil {
+		return errors.Wrap(err, "could not build transaction")
+	}
+
+	envelope, err := txe.Base64()
+	if err != nil {
+		return errors.Wrap(err, "could not encode transaction")
+	}
+
+	_, err = b.handler(envelope)
+	return err
+}
+
+// Pay builds a payment of amount of asset from source to target.
+func (b *offlineBuilder) Pay(source, target, amount string, asset *microstellar.Asset, opts ...*microstellar.Options) error {
+	return b.pay(source, target, amount, asset, nil)
+}
+
+// PathPay builds a path payment. Paths can't be found offline, so path.Path
+// must be set.
+func (b *offlineBuilder) PathPay(source, target, amount string, asset *microstellar.Asset, path PaymentPath, opts ...*microstellar.Options) error {
+	if len(path.Path) == 0 {
+		return errors.Wrap(ErrOffline, "can't find a payment path")
+	}
+
+	payPath := build.PayWith(path.With.ToStellarAsset(), path.Max)
+	for _, through := range path.Path {
+		payPath = payPath.Through(through.ToStellarAsset())
+	}
+
+	return b.pay(source, target, amount, asset, payPath)
+}
+
+func (b *offlineBuilder) pay(source, target, amount string, asset *microstellar.Asset, payPath interface{}) error {
+	if err := asset.Validate(); err != nil {
+		return errors.Wrap(err, "can't pay")
+	}
+
+	muts := []interface{}{build.Destination{AddressOrSeed: target}}
+	if asset.IsNative() {
+		muts = append(muts, build.NativeAmount{Amount: amount})
+	} else {
+		muts = append(muts, build.CreditAmount{Code: asset.Code, Issuer: asset.Issuer, Amount: amount})
+	}
+
+	if payPath != nil {
+		muts = append(muts, payPath)
+	}
+
+	return b.build(source, build.Payment(muts...))
+}
+
+// FundAccount builds a transaction that creates target with amount lumens
+// from source.
+func (b *offlineBuilder) FundAccount(source, target, amount string, opts ...*microstellar.Options) error {
+	return b.build(source, build.CreateAccount(build.Destination{AddressOrSeed: target}, build.NativeAmount{Amount: amount}))
+}
+
+// CreateTrustLine builds a transaction that trusts asset, up to limit (or
+// without a limit, if it's empty.)
+func (b *offlineBuilder) CreateTrustLine(source string, asset *microstellar.Asset, limit string, opts ...*microstellar.Options) error {
+	if err := asset.Validate(); err != nil {
+		return errors.Wrap(err, "can't create trust line")
+	}
+
+	if limit == "" {
+		return b.build(source, build.Trust(asset.Code, asset.Issuer))
+	}
+
+	return b.build(source, build.Trust(asset.Code, asset.Issuer, build.Limit(limit)))
+}
+
+// RemoveTrustLine builds a transaction that removes the trust line to asset.
+func (b *offlineBuilder) RemoveTrustLine(source string, asset *microstellar.Asset, opts ...*microstellar.Options) error {
+	if err := asset.Validate(); err != nil {
+		return errors.Wrap(err, "can't remove trust line")
+	}
+
+	return b.build(source, build.RemoveTrust(asset.Code, asset.Issuer))
+}
+
+// ManageOffer builds a transaction that creates, updates, or deletes an
+// offer on the DEX.
+func (b *offlineBuilder) ManageOffer(source string, params *microstellar.OfferParams, opts ...*microstellar.Options) error {
+	if err := params.BuyAsset.Validate(); err != nil {
+		return errors.Wrap(err, "bad buy asset")
+	}
+
+	if err := params.SellAsset.Validate(); err != nil {
+		return errors.Wrap(err, "bad sell asset")
+	}
+
+	rate := build.Rate{
+		Selling: params.SellAsset.ToStellarAsset(),
+		Buying:  params.BuyAsset.ToStellarAsset(),
+		Price:   build.Price(params.Price),
+	}
+
+	var offerID uint64
+	if params.OfferID != "" {
+		var err error
+		if offerID, err = strconv.ParseUint(params.OfferID, 10, 64); err != nil {
+			return errors.Errorf("bad offer ID: %s", params.OfferID)
+		}
+	}
+
+	switch params.OfferType {
+	case microstellar.OfferCreate:
+		return b.build(source, build.CreateOffer(rate, build.Amount(params.SellAmount)))
+	case microstellar.OfferCreatePassive:
+		return b.build(source, build.CreatePassiveOffer(rate, build.Amount(params.SellAmount)))
+	case microstellar.OfferUpdate:
+		return b.build(source, build.UpdateOffer(rate, build.Amount(params.SellAmount), build.OfferID(offerID)))
+	case microstellar.OfferDelete:
+		return b.build(source, build.DeleteOffer(rate, build.OfferID(offerID)))
+	}
+
+	return errors.Errorf("bad offer type: %v", params.OfferType)
+}
+
+// AddSigner builds a transaction that adds signer to source with weight.
+func (b *offlineBuilder) AddSigner(source, signer string, weight uint32, opts ...*microstellar.Options) error {
+	return b.build(source, build.AddSigner(signer, weight))
+}
+
+// RemoveSigner builds a transaction that removes signer from source.
+func (b *offlineBuilder) RemoveSigner(source, signer string, opts ...*microstellar.Options) error {
+	return b.build(source, build.RemoveSigner(signer))
+}
+
+// SetThresholds builds a transaction that sets the signing thresholds of
+// source.
+func (b *offlineBuilder) SetThresholds(source string, low, medium, high uint32, opts ...*microstellar.Options) error {
+	return b.build(source, build.SetThresholds(low, medium, high))
+}
+
+// SetMasterWeight builds a transaction that sets the weight of source's key.
+func (b *offlineBuilder) SetMasterWeight(source string, weight uint32, opts ...*microstellar.Options) error {
+	return b.build(source, build.MasterWeight(weight))
+}
+
+// SetFlags builds a transaction that sets flags on source.
+func (b *offlineBuilder) SetFlags(source string, flags microstellar.AccountFlags, opts ...*microstellar.Options) error {
+	return b.build(source, build.SetFlag(int32(flags)))
+}
+
+// ClearFlags builds a transaction that clears flags on source.
+func (b *offlineBuilder) ClearFlags(source string, flags microstellar.AccountFlags, opts ...*microstellar.Options) error {
+	return b.build(source, build.ClearFlag(int32(flags)))
+}
+
+// SetData builds a transaction that sets key to val on source.
+func (b *offlineBuilder) SetData(source, key string, val []byte, opts ...*microstellar.Options) error {
+	if key == "" || len(key) > 64 || len(val) > 64 {
+		return errors.Errorf("data keys and values must be 1 to 64 bytes")
+	}
+
+	return b.build(source, build.SetData(key, val))
+}
+
+// ClearData builds a transaction that removes key from source.
+func (b *offlineBuilder) ClearData(source, key string, opts ...*microstellar.Options) error {
+	if len(key) > 64 {
+		return errors.Errorf("data key must be under 64 bytes: %s", key)
+	}
+
+	return b.build(source, build.ClearData(key))
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+)
+
+// PayRequest describes a payment. Accounts can be names, addresses, seeds,
+// or federation addresses, and assets can be names or code:issuer[:type].
+type PayRequest struct {
+	From   string
+	To     string
+	Amount string
+	Asset  string // native if empty
+
+	Fund bool // create the target account with the payment
+
+	// For path payments: pay with up to Max of With, through Path (or
+	// through a path found by horizon if empty.)
+	With string
+	Max  string
+	Path []string
+
+	TxOptions
+}
+
+// Pay sends a payment.
+func (c *Client) Pay(ctx context.Context, req PayRequest) (*TxResult, error) {
+	asset, err := c.ResolveAsset(req.Asset)
+	if err != nil {
+		c.debugf("Pay", "could not get asset %s: %v", req.Asset, err)
+		return nil, resolveErrorf(req.Asset, "bad asset: %s", req.Asset)
+	}
+
+	target, err := c.ResolveAccount(req.To, "address")
+	if err != nil {
+		return nil, resolveErrorf(req.To, "bad target account: %s", req.To)
+	}
+
+	var withAsset *microstellar.Asset
+	var assetPath []*microstellar.Asset
+	sourceAddress := ""
+
+	if req.With != "" {
+		if withAsset, err = c.ResolveAsset(req.With); err != nil {
+			return nil, resolveErrorf(req.With, "bad path payment asset: %s", req.With)
+		}
+
+		if req.Max == "" {
+			return nil, errors.Errorf("max amount is required for path payments")
+		}
+
+		for _, a := range req.Path {
+			pathAsset, err := c.ResolveAsset(a)
+			if err != nil {
+				return nil, resolveErrorf(a, "bad path asset: %s", a)
+			}
+
+			assetPath = append(assetPath, pathAsset)
+		}
+
+		if len(assetPath) == 0 {
+			if sourceAddress, err = c.ResolveAccount(req.From, "address"); err != nil {
+				return nil, resolveErrorf(req.From, "no address for source account: %s", req.From)
+			}
+		}
+	}
+
+	return c.Submit(ctx, req.From, req.TxOptions, func(b Builder, source string, opts *microstellar.Options) error {
+		if req.Fund {
+			c.debugf("Pay", "initial fund from %s to %s", req.From, target)
+			return b.FundAccount(source, target, req.Amount, opts)
+		}
+
+		if withAsset != nil {
+			if len(assetPath) > 0 {
+				c.debugf("Pay", "path payment with %s (max %s) through %+v", req.With, req.Max, req.Path)
+			} else {
+				c.debugf("Pay", "path payment with %s (max %s), searching for paths from: %s", req.With, req.Max, sourceAddress)
+			}
+
+			path := PaymentPath{With: withAsset, Max: req.Max, Path: assetPath, Source: sourceAddress}
+			return b.PathPay(source, target, req.Amount, asset, path, opts)
+		}
+
+		c.debugf("Pay", "paying %s %s/%s from %s to %s", req.Amount, asset.Code, asset.Issuer, req.From, target)
+		return b.Pay(source, target, req.Amount, asset, opts)
+	})
+}
@@ -0,0 +1,418 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/xdr"
+)
+
+// Policy rules, saved in the store under PolicyKey.
+const (
+	PolicyMaxPayment      = "max_payment"      // per asset: the largest amount of a single payment
+	PolicyDailyLimit      = "daily_limit"      // per asset: the most paid in SpendingWindow
+	PolicyDestinations    = "destinations"     // comma-separated accounts that payments can go to
+	PolicyForbiddenAssets = "forbidden_assets" // comma-separated assets that can't be used
+	PolicyRequireSigners  = "require_signers"  // the fewest signatures on a transaction
+)
+
+// SpendingWindow is the rolling window of the daily limits of policies.
+const SpendingWindow = 24 * time.Hour
+
+// Policy is the spending policy of a namespace (set with "lumen policy".) The
+// client doesn't submit transactions that violate it. Assets are keyed by
+// AssetKey, and amounts are in units of the asset.
+type Policy struct {
+	MaxPayment      map[string]string `json:"max_payment,omitempty"`
+	DailyLimit      map[string]string `json:"daily_limit,omitempty"`
+	Destinations    []string          `json:"destinations,omitempty"` // names or addresses
+	ForbiddenAssets []string          `json:"forbidden_assets,omitempty"`
+	RequireSigners  int               `json:"require_signers,omitempty"`
+}
+
+// Empty returns true if p has no rules.
+func (p *Policy) Empty() bool {
+	return len(p.MaxPayment) == 0 && len(p.DailyLimit) == 0 && len(p.Destinations) == 0 && len(p.ForbiddenAssets) == 0 && p.RequireSigners == 0
+}
+
+// PolicyKey returns the store key for rule in namespace ns. The amount rules
+// (PolicyMaxPayment and PolicyDailyLimit) are set per asset, so they take the
+// asset's key (see AssetKey), and the others take "".
+func PolicyKey(ns, rule, asset string) string {
+	if asset == "" {
+		return fmt.Sprintf("%s:policy:%s", ns, rule)
+	}
+
+	return fmt.Sprintf("%s:policy:%s:%s", ns, rule, asset)
+}
+
+// AssetKey returns "native" or "code:issuer" for asset, which identifies it
+// in policies.
+func AssetKey(asset *microstellar.Asset) string {
+	if asset.IsNative() {
+		return "native"
+	}
+
+	return asset.Code + ":" + asset.Issuer
+}
+
+// assetKey is AssetKey for an XDR asset.
+func assetKey(asset xdr.Asset) string {
+	var assetType xdr.AssetType
+	var code, issuer string
+	if err := asset.Extract(&assetType, &code, &issuer); err != nil || assetType == xdr.AssetTypeAssetTypeNative {
+		return "native"
+	}
+
+	return code + ":" + issuer
+}
+
+// LoadPolicy returns the policy of namespace ns from s. Namespaces without
+// rules have an empty policy. Rules with bad values are errors, so a damaged
+// policy never allows more than it was set to.
+func LoadPolicy(s store.API, ns string) (*Policy, error) {
+	prefix := PolicyKey(ns, "", "")
+	keys, err := s.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{MaxPayment: map[string]string{}, DailyLimit: map[string]string{}}
+	for _, key := range keys {
+		value, err := s.Get(key)
+		if err != nil {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(key, prefix), ":", 2)
+		switch {
+		case parts[0] == PolicyMaxPayment && len(parts) == 2:
+			if _, err := amount.Parse(value); err != nil {
+				return nil, errors.Errorf("bad %s for %s: %s", PolicyMaxPayment, parts[1], value)
+			}
+			p.MaxPayment[parts[1]] = value
+		case parts[0] == PolicyDailyLimit && len(parts) == 2:
+			if _, err := amount.Parse(value); err != nil {
+				return nil, errors.Errorf("bad %s for %s: %s", PolicyDailyLimit, parts[1], value)
+			}
+			p.DailyLimit[parts[1]] = value
+		case parts[0] == PolicyDestinations:
+			p.Destinations = strings.Split(value, ",")
+		case parts[0] == PolicyForbiddenAssets:
+			p.ForbiddenAssets = strings.Split(value, ",")
+		case parts[0] == PolicyRequireSigners:
+			if p.RequireSigners, err = strconv.Atoi(value); err != nil {
+				return nil, errors.Errorf("bad %s: %s", PolicyRequireSigners, value)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Policy returns the spending policy of the client's namespace.
+func (c *Client) Policy() (*Policy, error) {
+	return LoadPolicy(c.store, c.ns)
+}
+
+// PolicyError is returned when a transaction violates the spending policy of
+// the namespace, instead of submitting it.
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return "policy violation: " + strings.Join(e.Violations, "; ")
+}
+
+// IsPolicyError returns true if err was caused by a PolicyError.
+func IsPolicyError(err error) bool {
+	_, ok := errors.Cause(err).(*PolicyError)
+	return ok
+}
+
+// CheckPolicy returns descriptions of the ways the transaction in envelope
+// violates the spending policy of the client's namespace, if any. Without a
+// policy, envelope isn't decoded.
+func (c *Client) CheckPolicy(envelope string) ([]string, error) {
+	policy, err := c.Policy()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load policy")
+	}
+
+	if policy.Empty() {
+		return []string{}, nil
+	}
+
+	txe, err := microstellar.DecodeTx(envelope)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode transaction")
+	}
+
+	return c.checkPolicy(policy, txe, len(txe.Signatures))
+}
+
+// EnforcePolicy returns a PolicyError if the transaction in envelope violates
+// the spending policy of the client's namespace.
+func (c *Client) EnforcePolicy(envelope string) error {
+	violations, err := c.CheckPolicy(envelope)
+	if err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{violations}
+	}
+
+	return nil
+}
+
+// payment is an amount that an operation sends to an account.
+type payment struct {
+	destination xdr.AccountId
+	asset       xdr.Asset
+	amount      xdr.Int64 // stroops, or -1 for the whole balance (account merges)
+}
+
+// opPayment returns the payment made by the operation in body, if any. Path
+// payments count the most they can send.
+func opPayment(body xdr.OperationBody) (payment, bool) {
+	switch body.Type {
+	case xdr.OperationTypeCreateAccount:
+		native, _ := xdr.NewAsset(xdr.AssetTypeAssetTypeNative, nil)
+		return payment{body.CreateAccountOp.Destination, native, body.CreateAccountOp.StartingBalance}, true
+	case xdr.OperationTypePayment:
+		op := body.PaymentOp
+		return payment{op.Destination, op.Asset, op.Amount}, true
+	case xdr.OperationTypePathPayment:
+		op := body.PathPaymentOp
+		return payment{op.Destination, op.SendAsset, op.SendMax}, true
+	case xdr.OperationTypeAccountMerge:
+		native, _ := xdr.NewAsset(xdr.AssetTypeAssetTypeNative, nil)
+		return payment{*body.Destination, native, -1}, true
+	}
+
+	return payment{}, false
+}
+
+// opAssets returns the assets used by the operation in body.
+func opAssets(body xdr.OperationBody) []xdr.Asset {
+	switch body.Type {
+	case xdr.OperationTypePayment:
+		return []xdr.Asset{body.PaymentOp.Asset}
+	case xdr.OperationTypePathPayment:
+		op := body.PathPaymentOp
+		return append([]xdr.Asset{op.SendAsset, op.DestAsset}, op.Path...)
+	case xdr.OperationTypeManageOffer:
+		return []xdr.Asset{body.ManageOfferOp.Selling, body.ManageOfferOp.Buying}
+	case xdr.OperationTypeCreatePassiveOffer:
+		return []xdr.Asset{body.CreatePassiveOfferOp.Selling, body.CreatePassiveOfferOp.Buying}
+	case xdr.OperationTypeChangeTrust:
+		return []xdr.Asset{body.ChangeTrustOp.Line}
+	}
+
+	return nil
+}
+
+// checkPolicy is CheckPolicy for a decoded transaction with signatures
+// signatures.
+func (c *Client) checkPolicy(policy *Policy, txe *xdr.TransactionEnvelope, signatures int) ([]string, error) {
+	violations := []string{}
+	if policy.Empty() {
+		return violations, nil
+	}
+
+	accounts, assets, _ := c.aliases("")
+	names := aliasNames{accounts, assets}
+
+	if signatures < policy.RequireSigners {
+		violations = append(violations, fmt.Sprintf("needs %d signers, has %d", policy.RequireSigners, signatures))
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range policy.Destinations {
+		address, err := c.ResolveAccount(name, "address")
+		if err != nil {
+			c.debugf("checkPolicy", "can't resolve allowed destination %s: %v", name, err)
+			continue
+		}
+		allowed[addressOf(address)] = true
+	}
+
+	forbidden := map[string]bool{}
+	for _, key := range policy.ForbiddenAssets {
+		forbidden[key] = true
+	}
+
+	maxPayments, err := parseLimits(PolicyMaxPayment, policy.MaxPayment)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyLimits, err := parseLimits(PolicyDailyLimit, policy.DailyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	reported := map[string]bool{}
+	totals, paid := map[string]xdr.Int64{}, map[string]xdr.Asset{}
+	for _, op := range txe.Tx.Operations {
+		for _, asset := range opAssets(op.Body) {
+			if key := assetKey(asset); forbidden[key] && !reported[key] {
+				reported[key] = true
+				violations = append(violations, fmt.Sprintf("asset %s is forbidden", names.asset(asset)))
+			}
+		}
+
+		p, ok := opPayment(op.Body)
+		if !ok {
+			continue
+		}
+
+		if len(policy.Destinations) > 0 && !allowed[p.destination.Address()] {
+			violations = append(violations, fmt.Sprintf("destination %s is not allowed", names.account(p.destination)))
+		}
+
+		key := assetKey(p.asset)
+		max, hasMax := maxPayments[key]
+		_, hasDaily := dailyLimits[key]
+		if p.amount < 0 {
+			if hasMax || hasDaily {
+				violations = append(violations, fmt.Sprintf("merge into %s sends the whole balance, which isn't limited", names.account(p.destination)))
+			}
+			continue
+		}
+
+		if hasMax && p.amount > max {
+			violations = append(violations, fmt.Sprintf("payment of %s %s to %s is over the maximum of %s", formatAmount(p.amount), names.asset(p.asset), names.account(p.destination), formatAmount(max)))
+		}
+
+		totals[key] += p.amount
+		paid[key] = p.asset
+	}
+
+	keys := []string{}
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		daily, ok := dailyLimits[key]
+		if !ok {
+			continue
+		}
+
+		spent, err := c.spent(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read spending")
+		}
+
+		if spent+totals[key] > daily {
+			violations = append(violations, fmt.Sprintf("paying %s %s is over the daily limit of %s (%s paid in the last %s)", formatAmount(totals[key]), names.asset(paid[key]), formatAmount(daily), formatAmount(spent), SpendingWindow))
+		}
+	}
+
+	return violations, nil
+}
+
+// parseLimits parses the amounts of the rule in limits, keyed by asset.
+func parseLimits(rule string, limits map[string]string) (map[string]xdr.Int64, error) {
+	parsed := map[string]xdr.Int64{}
+	for key, value := range limits {
+		v, err := amount.Parse(value)
+		if err != nil {
+			return nil, errors.Errorf("bad %s for %s: %s", rule, key, value)
+		}
+		parsed[key] = v
+	}
+
+	return parsed, nil
+}
+
+// spendingPrefix returns the prefix of the store keys that record payments of
+// asset (an AssetKey) in namespace ns, for daily limits. The keys end with the
+// time of the payment in nanoseconds, and expire after SpendingWindow.
+func spendingPrefix(ns, asset string) string {
+	return fmt.Sprintf("%s:spending:%s:", ns, asset)
+}
+
+// spent returns the amount of asset (an AssetKey) paid in the client's
+// namespace in the last SpendingWindow, in stroops. Records are dated by
+// their keys rather than by their TTLs, which a store may not honour.
+func (c *Client) spent(asset string) (xdr.Int64, error) {
+	prefix := spendingPrefix(c.ns, asset)
+	keys, err := c.store.Keys(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	since := time.Now().Add(-SpendingWindow).UnixNano()
+	var total xdr.Int64
+	for _, key := range keys {
+		paidAt, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			c.debugf("spent", "bad spending record %s", key)
+			continue
+		}
+
+		if paidAt < since {
+			continue // outside the window
+		}
+
+		value, err := c.store.Get(key)
+		if err != nil {
+			continue // expired
+		}
+
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.debugf("spent", "bad spending record %s: %s", key, value)
+			continue
+		}
+		total += xdr.Int64(v)
+	}
+
+	return total, nil
+}
+
+// RecordSpending records the payments in the submitted transaction in
+// envelope, for the daily limits of the namespace's policy. Only assets with
+// a daily limit are recorded.
+func (c *Client) RecordSpending(envelope string) error {
+	policy, err := c.Policy()
+	if err != nil || len(policy.DailyLimit) == 0 {
+		return err
+	}
+
+	txe, err := microstellar.DecodeTx(envelope)
+	if err != nil {
+		return errors.Wrap(err, "can't decode transaction")
+	}
+
+	totals := map[string]xdr.Int64{}
+	for _, op := range txe.Tx.Operations {
+		if p, ok := opPayment(op.Body); ok && p.amount > 0 {
+			if key := assetKey(p.asset); policy.DailyLimit[key] != "" {
+				totals[key] += p.amount
+			}
+		}
+	}
+
+	now := time.Now().UnixNano()
+	for key, total := range totals {
+		record := spendingPrefix(c.ns, key) + strconv.FormatInt(now, 10)
+		if err := c.store.Set(record, strconv.FormatInt(int64(total), 10), SpendingWindow); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
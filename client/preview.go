@@ -0,0 +1,547 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/0xfe/lumen/store"
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+)
+
+// BaseReserve is the reserve, in stroops, that an account holds for each of
+// its subentries (trustlines, offers, signers, and data entries.)
+const BaseReserve = 5000000
+
+// TxPreview describes a transaction built in a dry run (see TxOptions.DryRun),
+// with the aliases of accounts and assets resolved.
+type TxPreview struct {
+	Source     string        `json:"source"`
+	SourceName string        `json:"source_name,omitempty"`
+	Sequence   int64         `json:"sequence,omitempty"`
+	Operations []OpPreview   `json:"operations"`
+	Fee        uint32        `json:"fee"` // stroops
+	Memo       string        `json:"memo,omitempty"`
+	MinTime    uint64        `json:"min_time,omitempty"`
+	MaxTime    uint64        `json:"max_time,omitempty"`
+	Threshold  string        `json:"threshold,omitempty"` // low, medium, or high
+	Required   uint32        `json:"required_weight"`
+	Available  uint32        `json:"available_weight"`
+	Signers    []SignerEntry `json:"signers"`
+
+	// SubentryChange is the change in the number of subentries of the
+	// source account, which changes its reserve by ReserveChange XLM.
+	SubentryChange int    `json:"subentry_change"`
+	ReserveChange  string `json:"reserve_change"`
+
+	// Violations describe how the transaction violates the spending policy
+	// of the namespace, if it does (see Policy.)
+	Violations []string `json:"policy_violations,omitempty"`
+}
+
+// OpPreview describes an operation of a TxPreview.
+type OpPreview struct {
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"` // if not the source of the transaction
+	Description string `json:"description"`
+}
+
+// SignerEntry is a signer of the source account of a TxPreview. HasKey is
+// true if its seed is in the store or the agent, or was given as a signer.
+type SignerEntry struct {
+	Address string `json:"address"`
+	Name    string `json:"name,omitempty"`
+	Weight  int32  `json:"weight"`
+	HasKey  bool   `json:"has_key"`
+}
+
+// addressOf returns the address for addressOrSeed.
+func addressOf(addressOrSeed string) string {
+	if microstellar.ValidSeed(addressOrSeed) != nil {
+		return addressOrSeed
+	}
+
+	kp, err := keypair.Parse(addressOrSeed)
+	if err != nil {
+		return addressOrSeed
+	}
+
+	return kp.Address()
+}
+
+// aliases returns the names of the account and asset aliases in the client's
+// namespace, by address and by code:issuer, and the addresses with seeds in
+// the store. Secret references aren't resolved, so helpers don't run, and
+// encrypted seeds are only decrypted to find source (an address, or "") when
+// no account has it as its address.
+func (c *Client) aliases(source string) (accounts map[string]string, assets map[string]string, seeded map[string]bool) {
+	accounts, assets, seeded = map[string]string{}, map[string]string{}, map[string]bool{}
+	prefix := c.ns + ":"
+
+	keys, err := c.store.Keys(prefix + "account:")
+	if err != nil {
+		c.debugf("aliases", "can't list accounts: %v", err)
+	}
+
+	addAccount := func(address, name string) {
+		if _, ok := accounts[address]; !ok && address != "" {
+			accounts[address] = name
+		}
+	}
+
+	// Keys are sorted, so an account's address comes before its seed.
+	sort.Strings(keys)
+	addresses := map[string]string{} // by name
+	locked := []string{}             // names with encrypted seeds, but no address
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix+"account:")
+		i := strings.LastIndex(name, ":")
+		if i < 0 {
+			continue
+		}
+		name, field := name[:i], name[i+1:]
+
+		value, err := store.GetRaw(c.store, key)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case field == "address" && microstellar.ValidAddress(value) == nil:
+			addresses[name] = value
+			addAccount(value, name)
+		case field == "seed" && (IsSecretRef(value) || store.IsEncryptedValue(value)):
+			if address, ok := addresses[name]; ok {
+				seeded[address] = true
+			} else if store.IsEncryptedValue(value) {
+				locked = append(locked, name)
+			}
+		case field == "seed" && microstellar.ValidSeed(value) == nil:
+			address := addressOf(value)
+			seeded[address] = true
+			addAccount(address, name)
+		}
+	}
+
+	for _, name := range locked {
+		if _, ok := accounts[source]; ok || source == "" {
+			break
+		}
+
+		seed, err := c.getVar(fmt.Sprintf("account:%s:seed", name))
+		if err != nil || microstellar.ValidSeed(seed) != nil {
+			c.debugf("aliases", "can't decrypt seed of %s: %v", name, err)
+			continue
+		}
+
+		address := addressOf(seed)
+		seeded[address] = true
+		addAccount(address, name)
+	}
+
+	keys, err = c.store.Keys(prefix + "asset:")
+	if err != nil {
+		c.debugf("aliases", "can't list assets: %v", err)
+	}
+
+	for _, key := range keys {
+		if name := strings.TrimPrefix(key, prefix+"asset:"); strings.HasSuffix(name, ":code") {
+			name = strings.TrimSuffix(name, ":code")
+			if asset, err := c.ResolveAsset(name); err == nil {
+				assets[asset.Code+":"+asset.Issuer] = name
+			}
+		}
+	}
+
+	return accounts, assets, seeded
+}
+
+// aliasNames names accounts and assets by their aliases (see aliases), for
+// descriptions of transactions.
+type aliasNames struct {
+	accounts map[string]string // by address
+	assets   map[string]string // by code:issuer
+}
+
+// account returns the alias of aid, or its address.
+func (n aliasNames) account(aid xdr.AccountId) string {
+	address := aid.Address()
+	if name, ok := n.accounts[address]; ok {
+		return name
+	}
+	return address
+}
+
+// asset returns the alias of asset, or its code and the alias of its issuer.
+func (n aliasNames) asset(asset xdr.Asset) string {
+	key := assetKey(asset)
+	if key == "native" {
+		return "XLM"
+	}
+
+	if name, ok := n.assets[key]; ok {
+		return name
+	}
+
+	parts := strings.SplitN(key, ":", 2)
+	if name, ok := n.accounts[parts[1]]; ok {
+		return parts[0] + ":" + name
+	}
+	return key
+}
+
+// hasKey returns true if the client can sign for address with a seed in the
+// store, the agent, or seeds.
+func hasKey(address string, seeds []string, seeded, agentKeys map[string]bool) bool {
+	for _, seed := range seeds {
+		if microstellar.ValidSeed(seed) == nil && addressOf(seed) == address {
+			return true
+		}
+	}
+
+	return seeded[address] || agentKeys[address]
+}
+
+// Preview describes the transaction in envelope, e.g., before submitting it.
+func (c *Client) Preview(envelope string) (*TxPreview, error) {
+	source := ""
+	if !strings.HasPrefix(c.network, "fake") {
+		txe, err := microstellar.DecodeTx(envelope)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't decode transaction")
+		}
+		source = txe.Tx.SourceAccount.Address()
+	}
+
+	return c.preview(envelope, source, nil)
+}
+
+// preview describes the transaction in envelope, built for source (an
+// address), and signed by signers (seeds or addresses.)
+func (c *Client) preview(envelope string, source string, signers []string) (*TxPreview, error) {
+	accounts, assets, seeded := c.aliases(source)
+	names := aliasNames{accounts, assets}
+	p := &TxPreview{Source: source, SourceName: accounts[source], Operations: []OpPreview{}, Signers: []SignerEntry{}}
+
+	// The fake network has no real transactions.
+	if strings.HasPrefix(c.network, "fake") {
+		p.ReserveChange = formatAmount(0)
+		return p, nil
+	}
+
+	txe, err := microstellar.DecodeTx(envelope)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode transaction")
+	}
+
+	if c.offline {
+		return nil, errors.Wrap(ErrOffline, "can't load source account")
+	}
+
+	account, err := c.microstellar().LoadAccount(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load source account")
+	}
+
+	tx := txe.Tx
+	p.Sequence = int64(tx.SeqNum)
+	p.Fee = uint32(tx.Fee)
+	p.Memo = memoString(tx.Memo)
+	if tx.TimeBounds != nil {
+		p.MinTime, p.MaxTime = uint64(tx.TimeBounds.MinTime), uint64(tx.TimeBounds.MaxTime)
+	}
+
+	level := "low"
+	for _, op := range tx.Operations {
+		opLevel, subentries, description := describeOp(op.Body, account, names.account, names.asset)
+		preview := OpPreview{Type: opType(op.Body.Type), Description: description}
+
+		if op.SourceAccount != nil && op.SourceAccount.Address() != source {
+			preview.Source = names.account(*op.SourceAccount)
+		} else {
+			p.SubentryChange += subentries
+			if thresholdLevels[opLevel] > thresholdLevels[level] {
+				level = opLevel
+			}
+		}
+
+		p.Operations = append(p.Operations, preview)
+	}
+
+	p.Threshold = level
+	switch level {
+	case "low":
+		p.Required = uint32(account.Thresholds.Low)
+	case "medium":
+		p.Required = uint32(account.Thresholds.Medium)
+	case "high":
+		p.Required = uint32(account.Thresholds.High)
+	}
+
+	agentKeys := map[string]bool{}
+	if c.agent != nil {
+		if keys, err := c.agent.List(); err == nil {
+			for _, key := range keys {
+				agentKeys[key.Address] = true
+			}
+		}
+	}
+
+	for _, signer := range account.Signers {
+		address := signer.PublicKey
+		if address == "" {
+			address = signer.Key
+		}
+
+		if address == "" || signer.Weight == 0 {
+			continue
+		}
+
+		entry := SignerEntry{Address: address, Name: accounts[address], Weight: signer.Weight}
+		entry.HasKey = hasKey(address, signers, seeded, agentKeys)
+		if entry.HasKey {
+			p.Available += uint32(signer.Weight)
+		}
+
+		p.Signers = append(p.Signers, entry)
+	}
+
+	p.ReserveChange = formatAmount(xdr.Int64(p.SubentryChange * BaseReserve))
+
+	// Unsigned transactions (e.g., in dry runs) count the signers they'd have.
+	signatures := len(txe.Signatures)
+	if signatures == 0 {
+		signatures = len(signers)
+	}
+
+	policy, err := c.Policy()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load policy")
+	}
+
+	if p.Violations, err = c.checkPolicy(policy, txe, signatures); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// formatAmount returns the amount in v stroops, without trailing zeros.
+func formatAmount(v xdr.Int64) string {
+	s := amount.String(v)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// thresholdLevels orders the signing threshold levels of operations.
+var thresholdLevels = map[string]int{"low": 0, "medium": 1, "high": 2}
+
+// opType returns the name of an operation type, e.g., "payment".
+func opType(t xdr.OperationType) string {
+	name := strings.TrimPrefix(t.String(), "OperationType")
+	snake := []rune{}
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			snake = append(snake, '_')
+		}
+		snake = append(snake, r)
+	}
+
+	return strings.ToLower(string(snake))
+}
+
+// memoString describes a transaction memo.
+func memoString(memo xdr.Memo) string {
+	switch memo.Type {
+	case xdr.MemoTypeMemoText:
+		return fmt.Sprintf("text %q", *memo.Text)
+	case xdr.MemoTypeMemoId:
+		return fmt.Sprintf("id %d", uint64(*memo.Id))
+	case xdr.MemoTypeMemoHash:
+		return fmt.Sprintf("hash %x", *memo.Hash)
+	case xdr.MemoTypeMemoReturn:
+		return fmt.Sprintf("return %x", *memo.RetHash)
+	}
+
+	return ""
+}
+
+// describeOp returns the threshold level of the operation in body, the change
+// in the number of subentries of account, and a description of it.
+func describeOp(body xdr.OperationBody, account *microstellar.Account, accountName func(xdr.AccountId) string, assetName func(xdr.Asset) string) (string, int, string) {
+	trusts := func(asset xdr.Asset) bool {
+		var assetType xdr.AssetType
+		var code, issuer string
+		asset.Extract(&assetType, &code, &issuer)
+		for _, balance := range account.Balances {
+			if balance.Asset.Code == code && balance.Asset.Issuer == issuer {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch body.Type {
+	case xdr.OperationTypeCreateAccount:
+		op := body.CreateAccountOp
+		return "medium", 0, fmt.Sprintf("create account %s with %s XLM", accountName(op.Destination), formatAmount(op.StartingBalance))
+	case xdr.OperationTypePayment:
+		op := body.PaymentOp
+		return "medium", 0, fmt.Sprintf("pay %s %s to %s", formatAmount(op.Amount), assetName(op.Asset), accountName(op.Destination))
+	case xdr.OperationTypePathPayment:
+		op := body.PathPaymentOp
+		path := []string{}
+		for _, asset := range op.Path {
+			path = append(path, assetName(asset))
+		}
+
+		description := fmt.Sprintf("pay %s %s to %s with at most %s %s", formatAmount(op.DestAmount), assetName(op.DestAsset), accountName(op.Destination), formatAmount(op.SendMax), assetName(op.SendAsset))
+		if len(path) > 0 {
+			description += " through " + strings.Join(path, ", ")
+		}
+		return "medium", 0, description
+	case xdr.OperationTypeManageOffer:
+		op := body.ManageOfferOp
+		offer := fmt.Sprintf("sell %s %s for %s at %s", formatAmount(op.Amount), assetName(op.Selling), assetName(op.Buying), op.Price.String())
+		switch {
+		case op.OfferId == 0:
+			return "medium", 1, offer
+		case op.Amount == 0:
+			return "medium", -1, fmt.Sprintf("delete offer %d", uint64(op.OfferId))
+		default:
+			return "medium", 0, fmt.Sprintf("update offer %d: %s", uint64(op.OfferId), offer)
+		}
+	case xdr.OperationTypeCreatePassiveOffer:
+		op := body.CreatePassiveOfferOp
+		return "medium", 1, fmt.Sprintf("passive offer: sell %s %s for %s at %s", formatAmount(op.Amount), assetName(op.Selling), assetName(op.Buying), op.Price.String())
+	case xdr.OperationTypeSetOptions:
+		return describeSetOptions(body.SetOptionsOp, account, accountName)
+	case xdr.OperationTypeChangeTrust:
+		op := body.ChangeTrustOp
+		switch {
+		case op.Limit == 0:
+			return "medium", -1, fmt.Sprintf("remove trustline to %s", assetName(op.Line))
+		case trusts(op.Line):
+			return "medium", 0, fmt.Sprintf("change trustline to %s, limit %s", assetName(op.Line), formatAmount(op.Limit))
+		default:
+			return "medium", 1, fmt.Sprintf("trust %s, limit %s", assetName(op.Line), formatAmount(op.Limit))
+		}
+	case xdr.OperationTypeAllowTrust:
+		op := body.AllowTrustOp
+		verb := "revoke"
+		if op.Authorize {
+			verb = "allow"
+		}
+		return "low", 0, fmt.Sprintf("%s trust by %s", verb, accountName(op.Trustor))
+	case xdr.OperationTypeAccountMerge:
+		return "high", 0, fmt.Sprintf("merge account into %s", accountName(*body.Destination))
+	case xdr.OperationTypeInflation:
+		return "low", 0, "run inflation"
+	case xdr.OperationTypeManageData:
+		op := body.ManageDataOp
+		key := string(op.DataName)
+		_, exists := account.Data[key]
+		switch {
+		case op.DataValue == nil && exists:
+			return "medium", -1, fmt.Sprintf("clear data %s", key)
+		case op.DataValue == nil:
+			return "medium", 0, fmt.Sprintf("clear data %s (not set)", key)
+		case exists:
+			return "medium", 0, fmt.Sprintf("set data %s=%q", key, string(*op.DataValue))
+		default:
+			return "medium", 1, fmt.Sprintf("set data %s=%q", key, string(*op.DataValue))
+		}
+	}
+
+	return "medium", 0, opType(body.Type)
+}
+
+// describeSetOptions describes a set_options operation (see describeOp.)
+func describeSetOptions(op *xdr.SetOptionsOp, account *microstellar.Account, accountName func(xdr.AccountId) string) (string, int, string) {
+	level, subentries, changes := "medium", 0, []string{}
+
+	flagNames := func(flags xdr.Uint32) string {
+		names := []string{}
+		for _, flag := range []struct {
+			bit  xdr.Uint32
+			name string
+		}{{1, "auth_required"}, {2, "auth_revocable"}, {4, "auth_immutable"}} {
+			if flags&flag.bit != 0 {
+				names = append(names, flag.name)
+			}
+		}
+		return strings.Join(names, ",")
+	}
+
+	if op.InflationDest != nil {
+		changes = append(changes, "set inflation destination to "+accountName(*op.InflationDest))
+	}
+	if op.SetFlags != nil {
+		changes = append(changes, "set flags "+flagNames(*op.SetFlags))
+	}
+	if op.ClearFlags != nil {
+		changes = append(changes, "clear flags "+flagNames(*op.ClearFlags))
+	}
+	if op.HomeDomain != nil {
+		changes = append(changes, fmt.Sprintf("set home domain %q", string(*op.HomeDomain)))
+	}
+	if op.MasterWeight != nil {
+		level = "high"
+		changes = append(changes, fmt.Sprintf("set master weight %d", uint32(*op.MasterWeight)))
+	}
+	if op.LowThreshold != nil || op.MedThreshold != nil || op.HighThreshold != nil {
+		level = "high"
+		threshold := func(name string, value *xdr.Uint32) {
+			if value != nil {
+				changes = append(changes, fmt.Sprintf("set %s threshold %d", name, uint32(*value)))
+			}
+		}
+		threshold("low", op.LowThreshold)
+		threshold("medium", op.MedThreshold)
+		threshold("high", op.HighThreshold)
+	}
+	if op.Signer != nil {
+		level = "high"
+		address := op.Signer.Key.Address()
+		name := address
+		if aid, err := accountID(address); err == nil {
+			name = accountName(aid)
+		}
+
+		exists := false
+		for _, signer := range account.Signers {
+			if signer.PublicKey == address || signer.Key == address {
+				exists = true
+			}
+		}
+
+		switch {
+		case op.Signer.Weight == 0:
+			changes = append(changes, "remove signer "+name)
+			if exists {
+				subentries--
+			}
+		case exists:
+			changes = append(changes, fmt.Sprintf("change weight of signer %s to %d", name, uint32(op.Signer.Weight)))
+		default:
+			changes = append(changes, fmt.Sprintf("add signer %s with weight %d", name, uint32(op.Signer.Weight)))
+			subentries++
+		}
+	}
+
+	if len(changes) == 0 {
+		changes = append(changes, "no changes")
+	}
+
+	return level, subentries, strings.Join(changes, ", ")
+}
+
+// accountID returns the xdr.AccountId for address.
+func accountID(address string) (xdr.AccountId, error) {
+	var aid xdr.AccountId
+	err := aid.SetAddress(address)
+	return aid, err
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizon"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+// Receipt statuses.
+const (
+	ReceiptSuccess = "success" // the network applied the transaction
+	ReceiptFailed  = "failed"  // the network rejected the transaction, or couldn't be reached
+)
+
+// Receipt describes a transaction submitted to the network, and its result.
+type Receipt struct {
+	Hash      string `json:"hash"`
+	Ledger    int32  `json:"ledger,omitempty"`
+	Fee       int64  `json:"fee"` // stroops charged
+	Envelope  string `json:"envelope"`
+	ResultXDR string `json:"result_xdr,omitempty"`
+	Status    string `json:"status"` // ReceiptSuccess or ReceiptFailed
+	Error     string `json:"error,omitempty"`
+}
+
+// Receipt returns the receipt for the transaction in envelope, submitted to
+// the client's network, from the response or error of the submission. Failed
+// transactions have the result from horizon's error, if any.
+func (c *Client) Receipt(envelope string, resp *microstellar.TxResponse, err error) *Receipt {
+	r := &Receipt{Envelope: envelope, Status: ReceiptSuccess}
+
+	if txe, decodeErr := microstellar.DecodeTx(envelope); decodeErr == nil {
+		if hash, hashErr := network.HashTransaction(&txe.Tx, networkPassphrase(c.network)); hashErr == nil {
+			r.Hash = hex.EncodeToString(hash[:])
+		}
+	}
+
+	if err != nil {
+		r.Status, r.Error = ReceiptFailed, microstellar.ErrorString(err)
+		if herr, ok := errors.Cause(err).(*horizon.Error); ok {
+			if raw, ok := herr.Problem.Extras["result_xdr"]; ok {
+				json.Unmarshal(raw, &r.ResultXDR)
+			}
+		}
+	} else if resp != nil {
+		r.Hash, r.Ledger, r.ResultXDR = resp.Hash, resp.Ledger, resp.Result
+	}
+
+	var result xdr.TransactionResult
+	if r.ResultXDR != "" && xdr.SafeUnmarshalBase64(r.ResultXDR, &result) == nil {
+		r.Fee = int64(result.FeeCharged)
+	}
+
+	return r
+}
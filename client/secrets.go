@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+)
+
+// Seeds can be stored as references to an external secret provider instead
+// of as plaintext:
+//
+//	env:VAR       read the seed from environment variable VAR
+//	exec:COMMAND  run COMMAND (via the shell) and read the seed from its output
+//
+// Exec helpers follow a protocol similar to git credential helpers. Lumen writes
+// the request to the helper's stdin as key=value lines, terminated by a blank
+// line:
+//
+//	action=get
+//	type=seed
+//	name=treasury
+//	namespace=default
+//
+// The helper writes the seed to stdout, either as a bare line (so that commands
+// like "pass show" work unchanged), or as key=value lines with a "seed" key. A
+// non-zero exit status is an error. The helper's stderr is passed through, so it
+// can prompt the user.
+const (
+	secretRefEnv  = "env:"
+	secretRefExec = "exec:"
+)
+
+// IsSecretRef returns true if v is a reference to an external secret.
+func IsSecretRef(v string) bool {
+	return strings.HasPrefix(v, secretRefEnv) || strings.HasPrefix(v, secretRefExec)
+}
+
+// IsExecRef returns true if v is a reference to a secret helper, which runs
+// a command.
+func IsExecRef(v string) bool {
+	return strings.HasPrefix(v, secretRefExec)
+}
+
+// Secrets caches seeds fetched from secret references.
+type Secrets struct {
+	mu    *sync.Mutex // protects seeds
+	seeds map[string]string
+}
+
+// NewSecrets returns an empty cache.
+func NewSecrets() *Secrets {
+	return &Secrets{
+		mu:    &sync.Mutex{},
+		seeds: map[string]string{},
+	}
+}
+
+func (secrets *Secrets) get(ref string) (string, bool) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	seed, ok := secrets.seeds[ref]
+	return seed, ok
+}
+
+func (secrets *Secrets) set(ref, seed string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	secrets.seeds[ref] = seed
+}
+
+// resolveSecret fetches the seed for account name from the reference ref.
+// Results are cached in c.secrets.
+func (c *Client) resolveSecret(name, ref string) (string, error) {
+	seed, ok := c.secrets.get(ref)
+	if ok {
+		return seed, nil
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(ref, secretRefEnv):
+		envVar := strings.TrimPrefix(ref, secretRefEnv)
+		c.debugf("resolveSecret", "reading seed for %s from env %s", name, envVar)
+		if seed = strings.TrimSpace(os.Getenv(envVar)); seed == "" {
+			return "", errors.Errorf("env %s is not set", envVar)
+		}
+	case strings.HasPrefix(ref, secretRefExec):
+		command := strings.TrimPrefix(ref, secretRefExec)
+		c.debugf("resolveSecret", "reading seed for %s from helper: %s", name, command)
+		if seed, err = c.runSecretHelper(name, command); err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.Errorf("unknown secret reference: %s", ref)
+	}
+
+	if microstellar.ValidSeed(seed) != nil {
+		return "", errors.Errorf("secret provider returned an invalid seed for %s", name)
+	}
+
+	c.secrets.set(ref, seed)
+	return seed, nil
+}
+
+// runSecretHelper runs command with the helper protocol and returns the seed.
+func (c *Client) runSecretHelper(name, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	request := fmt.Sprintf("action=get\ntype=seed\nname=%s\nnamespace=%s\n\n", name, c.ns)
+	cmd.Stdin = strings.NewReader(request)
+	cmd.Stderr = c.stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "secret helper failed: %s", command)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.Contains(line, "=") {
+			// Bare seed
+			return line, nil
+		}
+
+		if parts := strings.SplitN(line, "=", 2); parts[0] == "seed" {
+			return strings.TrimSpace(parts[1]), nil
+		}
+	}
+
+	return "", errors.Errorf("secret helper returned no seed: %s", command)
+}
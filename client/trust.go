@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+
+	"github.com/0xfe/microstellar"
+)
+
+// TrustRequest describes a change to a trustline.
+type TrustRequest struct {
+	Account string
+	Asset   string
+	Limit   string // no limit if empty
+	Remove  bool   // remove the trustline instead of creating it
+
+	TxOptions
+}
+
+// Trust creates or removes the trustline between an account and an asset.
+func (c *Client) Trust(ctx context.Context, req TrustRequest) (*TxResult, error) {
+	asset, err := c.ResolveAsset(req.Asset)
+	if err != nil {
+		return nil, resolveErrorf(req.Asset, "invalid asset: %s", req.Asset)
+	}
+
+	return c.Submit(ctx, req.Account, req.TxOptions, func(b Builder, source string, opts *microstellar.Options) error {
+		if req.Remove {
+			return b.RemoveTrustLine(source, asset, opts)
+		}
+
+		return b.CreateTrustLine(source, asset, req.Limit, opts)
+	})
+}
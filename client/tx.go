@@ -0,0 +1,504 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/0xfe/microstellar"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stellar/go/xdr"
+)
+
+// TxOptions are the options shared by all transactions.
+type TxOptions struct {
+	MemoText string
+	MemoID   string   // decimal
+	Signers  []string // accounts (names, addresses, or seeds) that sign instead of the source
+	NoSign   bool     // don't sign the transaction
+	NoSubmit bool     // return the signed transaction in TxResult.Envelope instead of submitting it
+	Sequence int64    // sequence number of the transaction; zero uses the source account's next one
+
+	// DryRun builds the transaction without loading seeds, signing, or
+	// submitting it, and describes it in TxResult.Preview.
+	DryRun bool
+
+	// Confirm, if set, is called with a preview of the transaction before
+	// it's submitted. If it returns an error, the transaction isn't submitted.
+	Confirm func(preview *TxPreview) error
+
+	// Submitted, if set, is called with the receipt of the transaction
+	// after it's submitted, whether or not the network accepted it.
+	Submitted func(receipt *Receipt)
+}
+
+// TxResult describes a transaction built by the client. If it was submitted,
+// Hash and Ledger are set, otherwise Envelope has the transaction.
+type TxResult struct {
+	Hash     string     `json:"hash,omitempty"`
+	Ledger   int32      `json:"ledger,omitempty"`
+	Fee      int64      `json:"fee,omitempty"` // stroops charged
+	Envelope string     `json:"envelope,omitempty"`
+	Preview  *TxPreview `json:"preview,omitempty"` // for dry runs
+}
+
+// BuildFunc builds and submits a transaction for source (a seed, or an
+// address if it's signed by an agent or other signers) with b, e.g., by
+// calling b.Pay(source, ..., opts).
+type BuildFunc func(b Builder, source string, opts *microstellar.Options) error
+
+// Builder builds a transaction with a single operation, and passes it to the
+// handler in opts (see txOptions.) The methods are those of microstellar,
+// which loads the sequence number of the source account from horizon. Offline,
+// an offlineBuilder uses the sequence number in TxOptions instead.
+type Builder interface {
+	Pay(source, target, amount string, asset *microstellar.Asset, opts ...*microstellar.Options) error
+	PathPay(source, target, amount string, asset *microstellar.Asset, path PaymentPath, opts ...*microstellar.Options) error
+	FundAccount(source, target, amount string, opts ...*microstellar.Options) error
+	CreateTrustLine(source string, asset *microstellar.Asset, limit string, opts ...*microstellar.Options) error
+	RemoveTrustLine(source string, asset *microstellar.Asset, opts ...*microstellar.Options) error
+	ManageOffer(source string, params *microstellar.OfferParams, opts ...*microstellar.Options) error
+	AddSigner(source, signer string, weight uint32, opts ...*microstellar.Options) error
+	RemoveSigner(source, signer string, opts ...*microstellar.Options) error
+	SetThresholds(source string, low, medium, high uint32, opts ...*microstellar.Options) error
+	SetMasterWeight(source string, weight uint32, opts ...*microstellar.Options) error
+	SetFlags(source string, flags microstellar.AccountFlags, opts ...*microstellar.Options) error
+	ClearFlags(source string, flags microstellar.AccountFlags, opts ...*microstellar.Options) error
+	SetData(source, key string, val []byte, opts ...*microstellar.Options) error
+	ClearData(source, key string, opts ...*microstellar.Options) error
+}
+
+// PaymentPath is the sending side of a path payment: up to Max of With,
+// through Path, or through a path found by horizon for Source (an address) if
+// Path is empty.
+type PaymentPath struct {
+	With   *microstellar.Asset
+	Max    string
+	Path   []*microstellar.Asset
+	Source string
+}
+
+// onlineBuilder builds transactions with microstellar.
+type onlineBuilder struct {
+	*microstellar.MicroStellar
+}
+
+// PathPay makes a path payment with microstellar, which takes the path in the
+// options.
+func (b onlineBuilder) PathPay(source, target, amount string, asset *microstellar.Asset, path PaymentPath, opts ...*microstellar.Options) error {
+	o := microstellar.Opts()
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	o = o.WithAsset(path.With, path.Max)
+	if len(path.Path) > 0 {
+		o = o.Through(path.Path...)
+	} else {
+		o = o.FindPathFrom(path.Source)
+	}
+
+	return b.Pay(source, target, amount, asset, o)
+}
+
+// txn is the signing state of a single transaction.
+type txn struct {
+	source  string   // address of the source account
+	signers []string // seeds, or addresses for the agent (see resolveSigner)
+	result  *TxResult
+	err     error // from the pre-submit handler, which microstellar ignores
+
+	mu        sync.Mutex
+	submitted bool // the transaction was sent to horizon (see Submit)
+}
+
+// startSubmit marks t as submitted, unless ctx is done. Once it's marked, a
+// timeout can't tell whether the transaction made it to the network.
+func (t *txn) startSubmit(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.submitted = true
+	return nil
+}
+
+// wasSubmitted returns true if t was sent to horizon.
+func (t *txn) wasSubmitted() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.submitted
+}
+
+// resolveSigner returns the seed for name, for signing transactions, and
+// records it as a signer of t. If a signing agent is in use, it returns the
+// address instead, so the seed is never loaded.
+func (c *Client) resolveSigner(t *txn, name string) (string, error) {
+	if c.agent == nil {
+		seed, err := c.ResolveAccount(name, "seed")
+		if err == nil {
+			t.signers = append(t.signers, seed)
+		}
+		return seed, err
+	}
+
+	address := name
+	if microstellar.ValidAddressOrSeed(name) {
+		// Raw addresses and seeds are used as-is. Seeds are signed locally.
+	} else if stored, err := c.GetAccount(name, "address"); err == nil {
+		if address, err = c.ResolveAccount(stored, "address"); err != nil {
+			return "", err
+		}
+	} else if address, err = c.agent.Lookup(name); err != nil {
+		c.debugf("resolveSigner", "no address for %s in store or agent: %v", name, err)
+		return "", resolveErrorf(name, "no address for %s, use: lumen agent add %s", name, name)
+	}
+
+	c.debugf("resolveSigner", "signing as %s with agent", address)
+	t.signers = append(t.signers, address)
+	return address, nil
+}
+
+// sign signs envelope with signers, which are seeds, or addresses returned by
+// resolveSigner if an agent is in use.
+func (c *Client) sign(ms *microstellar.MicroStellar, envelope string, signers []string) (string, error) {
+	if c.agent == nil {
+		return ms.SignTransaction(envelope, signers...)
+	}
+
+	addresses := []string{}
+	seeds := []string{}
+	for _, signer := range signers {
+		if microstellar.ValidSeed(signer) == nil {
+			seeds = append(seeds, signer)
+		} else {
+			addresses = append(addresses, signer)
+		}
+	}
+
+	var err error
+	if len(addresses) > 0 {
+		if envelope, err = c.agent.Sign(envelope, c.network, addresses); err != nil {
+			return "", errors.Wrap(err, "agent could not sign")
+		}
+	}
+
+	if len(seeds) > 0 {
+		return ms.SignTransaction(envelope, seeds...)
+	}
+
+	return envelope, nil
+}
+
+// Sign signs the base64-encoded transaction envelope with signers (names,
+// addresses, or seeds), and returns the signed envelope.
+func (c *Client) Sign(ctx context.Context, envelope string, signers []string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if len(signers) < 1 {
+		return "", errors.Errorf("need at least one signer")
+	}
+
+	t := &txn{}
+	keys := []string{}
+	for _, signer := range signers {
+		key, err := c.resolveSigner(t, signer)
+		if err != nil {
+			return "", errors.Wrapf(err, "bad signer account: %s", signer)
+		}
+
+		if c.agent == nil && microstellar.ValidSeed(key) != nil {
+			return "", resolveErrorf(signer, "no seed found in %s", signer)
+		}
+
+		keys = append(keys, key)
+	}
+
+	signed, err := c.sign(c.microstellar(), envelope, keys)
+	if err != nil {
+		return "", errors.Wrap(err, "signing error")
+	}
+
+	return signed, nil
+}
+
+// txOptions returns the microstellar options for a transaction, and the
+// handler in them, which signs and submits the built transaction.
+func (c *Client) txOptions(ctx context.Context, ms *microstellar.MicroStellar, t *txn, txOpts TxOptions) (*microstellar.Options, microstellar.TxHandler, error) {
+	opts := microstellar.Opts()
+
+	if txOpts.MemoText != "" {
+		opts = opts.WithMemoText(txOpts.MemoText)
+	}
+
+	if txOpts.MemoID != "" {
+		id, err := strconv.ParseUint(txOpts.MemoID, 10, 64)
+		if err != nil {
+			c.debugf("txOptions", "error parsing memoid: %v", err)
+			return nil, nil, errors.Errorf("bad memoid: %s", txOpts.MemoID)
+		}
+		opts = opts.WithMemoID(id)
+	}
+
+	if len(txOpts.Signers) > 0 {
+		// Explicit signers replace the source account.
+		t.signers = nil
+		for _, signer := range txOpts.Signers {
+			c.debugf("txOptions", "adding signer: %s", signer)
+			if txOpts.DryRun {
+				key, err := c.ResolveAccount(signer, "address")
+				if err != nil {
+					return nil, nil, resolveErrorf(signer, "bad signer: %s", signer)
+				}
+				t.signers = append(t.signers, key)
+				continue
+			}
+
+			key, err := c.resolveSigner(t, signer)
+
+			if err != nil {
+				c.debugf("txOptions", "bad signer %s: %v", signer, err)
+				return nil, nil, resolveErrorf(signer, "bad signer: %s", signer)
+			}
+
+			if c.agent == nil {
+				opts = opts.WithSigner(key)
+			}
+		}
+	}
+
+	// If the agent signs the transaction, or the fee or sequence number has
+	// to be set first, build the transaction unsigned, and sign it before
+	// submitting. The fake network has no real transactions, so neither is
+	// set there.
+	fake := strings.HasPrefix(c.network, "fake")
+	setsFee := c.fee > 0 && !fake
+	setsSeq := txOpts.Sequence > 0 && !fake
+	signLater := !txOpts.NoSign && !txOpts.DryRun && (c.agent != nil || setsFee || setsSeq)
+	if signLater || txOpts.NoSign || txOpts.DryRun {
+		c.debugf("txOptions", "building unsigned transaction")
+		opts = opts.SkipSignatures()
+	}
+
+	handler := func(args ...interface{}) (bool, error) {
+		envelope := args[0].(string)
+
+		if setsFee {
+			withFee, err := setFee(envelope, c.fee)
+			if err != nil {
+				t.err = err
+				return false, err
+			}
+			envelope = withFee
+		}
+
+		if setsSeq {
+			withSeq, err := setSequence(envelope, txOpts.Sequence)
+			if err != nil {
+				t.err = err
+				return false, err
+			}
+			envelope = withSeq
+		}
+
+		if signLater {
+			signed, err := c.sign(ms, envelope, t.signers)
+			if err != nil {
+				t.err = err
+				return false, err
+			}
+			envelope = signed
+		}
+
+		if txOpts.DryRun {
+			c.debugf("txOptions", "dry run, not submitting transaction")
+			t.result.Envelope = envelope
+			return false, nil
+		}
+
+		if txOpts.NoSubmit {
+			c.debugf("txOptions", "sign-only transaction")
+			t.result.Envelope = envelope
+			return false, nil
+		}
+
+		// The fake network's transactions can't be decoded, so they're not
+		// checked against the namespace's policy.
+		if !fake {
+			if err := c.EnforcePolicy(envelope); err != nil {
+				t.err = err
+				return false, err
+			}
+		}
+
+		if txOpts.Confirm != nil {
+			preview, err := c.preview(envelope, t.source, t.signers)
+			if err == nil {
+				err = txOpts.Confirm(preview)
+			}
+
+			if err != nil {
+				t.err = err
+				return false, err
+			}
+		}
+
+		if fake {
+			c.debugf("txOptions", "not submitting to fake network")
+			return false, nil
+		}
+
+		// Submit here rather than in microstellar, to get the response for
+		// all types of transactions.
+		if err := t.startSubmit(ctx); err != nil {
+			t.err = err
+			return false, err
+		}
+
+		c.debugf("txOptions", "submitting transaction")
+		resp, err := ms.SubmitTransaction(envelope)
+		receipt := c.Receipt(envelope, resp, err)
+		if txOpts.Submitted != nil {
+			txOpts.Submitted(receipt)
+		}
+
+		if err != nil {
+			t.err = errors.Wrap(err, "could not submit transaction")
+			return false, t.err
+		}
+
+		t.result.Hash = resp.Hash
+		t.result.Ledger = resp.Ledger
+		t.result.Fee = receipt.Fee
+
+		if err := c.RecordSpending(envelope); err != nil {
+			c.logger.WithFields(logrus.Fields{"type": "client", "method": "txOptions"}).Warnf("could not record spending for policy: %v", err)
+		}
+		return false, nil
+	}
+
+	txHandler := microstellar.TxHandler(handler)
+	return opts.On(microstellar.EvBeforeSubmit, &txHandler), txHandler, nil
+}
+
+// setFee sets the fee of the unsigned transaction in envelope to fee stroops
+// per operation.
+func setFee(envelope string, fee uint32) (string, error) {
+	txe, err := microstellar.DecodeTx(envelope)
+	if err != nil {
+		return "", errors.Wrap(err, "can't decode transaction")
+	}
+
+	txe.Tx.Fee = xdr.Uint32(fee * uint32(len(txe.Tx.Operations)))
+	return xdr.MarshalBase64(txe)
+}
+
+// setSequence sets the sequence number of the unsigned transaction in
+// envelope to seq.
+func setSequence(envelope string, seq int64) (string, error) {
+	txe, err := microstellar.DecodeTx(envelope)
+	if err != nil {
+		return "", errors.Wrap(err, "can't decode transaction")
+	}
+
+	txe.Tx.SeqNum = xdr.SequenceNumber(seq)
+	return xdr.MarshalBase64(txe)
+}
+
+// Submit builds a transaction for source (a name, address, or seed) with
+// build, then signs and submits it according to opts. Offline, opts.Sequence
+// is required, and the transaction isn't submitted. If ctx is done (or the
+// client's timeout passes) after the transaction was sent, the error wraps
+// ctx.Err(), and the transaction may or may not have been applied.
+func (c *Client) Submit(ctx context.Context, source string, opts TxOptions, build BuildFunc) (*TxResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Sequence < 0 {
+		return nil, errors.Errorf("bad sequence number: %d", opts.Sequence)
+	}
+
+	if c.offline {
+		if opts.Sequence == 0 {
+			return nil, errors.Errorf("offline transactions need a sequence number, see: lumen tx seq")
+		}
+
+		opts.NoSubmit = true
+	}
+
+	t := &txn{result: &TxResult{}}
+	var key string
+	var err error
+	if opts.DryRun {
+		// Dry runs don't need seeds, but raw seeds count as available keys.
+		if key, err = c.ResolveAccount(source, "address"); err == nil {
+			t.signers = append(t.signers, key)
+			key = addressOf(key)
+		}
+	} else {
+		key, err = c.resolveSigner(t, source)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid account: %s", source)
+	}
+	t.source = addressOf(key)
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	ms := c.microstellar()
+	msOpts, handler, err := c.txOptions(ctx, ms, t, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The fake network has no horizon server, and no real transactions.
+	var b Builder = onlineBuilder{ms}
+	if c.offline && !strings.HasPrefix(c.network, "fake") {
+		b = newOfflineBuilder(c.network, opts, handler)
+	}
+
+	// microstellar doesn't take a context for requests, so stop waiting
+	// when ctx is done. The transaction isn't submitted after that, but if
+	// it was already sent, it may still make it to the network.
+	done := make(chan error, 1)
+	go func() {
+		if err := build(b, key, msOpts); err != nil {
+			done <- err
+			return
+		}
+		done <- t.err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		if t.wasSubmitted() {
+			return nil, errors.Wrap(ctx.Err(), "transaction was sent, but may or may not have been applied; check the account before retrying")
+		}
+		return nil, ctx.Err()
+	}
+
+	if opts.DryRun {
+		if t.result.Preview, err = c.preview(t.result.Envelope, t.source, t.signers); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.result, nil
+}
@@ -0,0 +1,488 @@
+package store
+
+// Encrypted wraps another store and encrypts secrets (account seeds) at rest
+// with a key derived from a passphrase.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	encryptedPrefix = "lumen-enc:v1:"
+	cryptoPrefix    = "global:crypto:" // internal keys, never exported
+	checkKey        = cryptoPrefix + "check"
+	checkValue      = "lumen"
+
+	// Convert stages new values under stagedPrefix, with the new check value
+	// in pendingKey, until the check key is replaced.
+	stagedPrefix = cryptoPrefix + "staged:"
+	pendingKey   = cryptoPrefix + "pending"
+
+	kdfIterations = 100000
+	kdfSaltLen    = 16
+	kdfKeyLen     = 32
+)
+
+// ErrBadPassphrase is returned when an encrypted value can't be decrypted
+// with the supplied passphrase.
+var ErrBadPassphrase = errors.New("bad passphrase")
+
+// PassphraseFunc returns the passphrase for an encrypted store. It's only
+// called when a secret needs to be encrypted or decrypted.
+type PassphraseFunc func() (string, error)
+
+// IsSecretKey returns true if k is a key whose value must be encrypted.
+func IsSecretKey(k string) bool {
+	return strings.Contains(k, "account:") && strings.HasSuffix(k, ":seed")
+}
+
+// IsEncryptedValue returns true if v was encrypted by an Encrypted store.
+func IsEncryptedValue(v string) bool {
+	return strings.HasPrefix(v, encryptedPrefix)
+}
+
+// Encrypted is a store that encrypts secret values before handing them
+// to the backend store.
+type Encrypted struct {
+	*Store
+	backend    API
+	passphrase PassphraseFunc
+	mu         *sync.Mutex // protects pass and keys
+	pass       *string
+	keys       map[string][]byte // salt -> derived key
+}
+
+// NewEncryptedStore returns a store that wraps backend. The passphrase
+// function is called lazily, at most once.
+func NewEncryptedStore(backend API, passphrase PassphraseFunc) *Encrypted {
+	return &Encrypted{
+		Store: &Store{
+			driver:     "encrypted",
+			parameters: "",
+		},
+		backend:    backend,
+		passphrase: passphrase,
+		mu:         &sync.Mutex{},
+		keys:       make(map[string][]byte),
+	}
+}
+
+// Backend returns the underlying store.
+func (store *Encrypted) Backend() API {
+	return store.backend
+}
+
+// GetRaw reads k from s without decrypting it, looking through encrypted
+// stores and overlays. Use it to check what kind of value a seed is (e.g.,
+// with IsEncryptedValue) without paying for key derivation.
+func GetRaw(s API, k string) (string, error) {
+	switch s := s.(type) {
+	case *Encrypted:
+		return GetRaw(s.backend, k)
+	case *Overlay:
+		return s.get(k, GetRaw)
+	}
+
+	return s.Get(k)
+}
+
+// Enabled returns true if encryption has been turned on for the backend.
+func (store *Encrypted) Enabled() bool {
+	_, err := store.backend.Get(checkKey)
+	return err == nil
+}
+
+// getPassphrase returns the passphrase, verifying it against the check value
+// in the backend. Must be called under mu.
+func (store *Encrypted) getPassphrase() (string, error) {
+	if store.pass != nil {
+		return *store.pass, nil
+	}
+
+	pass, err := store.passphrase()
+	if err != nil {
+		return "", errors.Wrap(err, "can't get passphrase")
+	}
+
+	if check, err := store.backend.Get(checkKey); err == nil {
+		if _, err := store.open(pass, check); err != nil {
+			return "", err
+		}
+
+		if err := store.recoverStaged(check); err != nil {
+			return "", err
+		}
+	}
+
+	store.pass = &pass
+	return pass, nil
+}
+
+// recoverStaged finishes a conversion that was interrupted after the check
+// key was replaced, or discards one that was interrupted before. Must be
+// called under mu.
+func (store *Encrypted) recoverStaged(check string) error {
+	pending, err := store.backend.Get(pendingKey)
+	if err != nil {
+		return nil
+	}
+
+	if pending != check {
+		log.WithFields(log.Fields{"type": "store", "store": "encrypted"}).Infof("discarding interrupted conversion")
+		return store.discardStaged()
+	}
+
+	log.WithFields(log.Fields{"type": "store", "store": "encrypted"}).Infof("finishing interrupted conversion")
+	if err := store.moveStaged(); err != nil {
+		return errors.Wrap(err, "can't finish converting secrets")
+	}
+
+	return nil
+}
+
+// moveStaged moves the staged values of a conversion over the old ones. Must
+// be called under mu.
+func (store *Encrypted) moveStaged() error {
+	keys, err := store.backend.Keys(stagedPrefix)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(keys)
+	for _, staged := range keys {
+		v, err := store.backend.Get(staged)
+		if err != nil {
+			return err
+		}
+
+		if err := store.backend.Set(strings.TrimPrefix(staged, stagedPrefix), v, 0); err != nil {
+			return err
+		}
+
+		if err := store.backend.Delete(staged); err != nil {
+			return err
+		}
+	}
+
+	return store.backend.Delete(pendingKey)
+}
+
+// discardStaged deletes the staged values of a conversion. Must be called
+// under mu.
+func (store *Encrypted) discardStaged() error {
+	keys, err := store.backend.Keys(stagedPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, staged := range append(keys, pendingKey) {
+		if err := store.backend.Delete(staged); err != nil {
+			if _, getErr := store.backend.Get(staged); getErr == nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Enable turns on encryption for the backend, using the current passphrase.
+func (store *Encrypted) Enable() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	pass, err := store.getPassphrase()
+	if err != nil {
+		return err
+	}
+
+	check, err := store.seal(pass, checkValue)
+	if err != nil {
+		return err
+	}
+
+	return store.backend.Set(checkKey, check, 0)
+}
+
+// Convert encrypts every plaintext secret in keys, and re-encrypts existing
+// secrets with newPassphrase (if set.) Returns the number of values written.
+//
+// All values are encrypted before any is written, and the new values are
+// staged next to the old ones until the check key is replaced. If Convert is
+// interrupted, the store opens with either the old passphrase, or the new one
+// (and the conversion is finished then.)
+func (store *Encrypted) Convert(keys []string, newPassphrase string) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	pass, err := store.getPassphrase()
+	if err != nil {
+		return 0, err
+	}
+
+	if newPassphrase == "" {
+		newPassphrase = pass
+	}
+
+	sealed := map[string]string{}
+	for _, k := range keys {
+		if !IsSecretKey(k) || strings.HasPrefix(k, stagedPrefix) {
+			continue
+		}
+
+		v, err := store.backend.Get(k)
+		if err != nil {
+			continue
+		}
+
+		if IsEncryptedValue(v) {
+			if newPassphrase == pass {
+				continue
+			}
+
+			if v, err = store.open(pass, v); err != nil {
+				return 0, errors.Wrapf(err, "can't decrypt %s", k)
+			}
+		}
+
+		if sealed[k], err = store.seal(newPassphrase, v); err != nil {
+			return 0, err
+		}
+	}
+
+	check, err := store.seal(newPassphrase, checkValue)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := store.discardStaged(); err != nil {
+		return 0, errors.Wrap(err, "can't discard interrupted conversion")
+	}
+
+	stage := func() error {
+		if err := store.backend.Set(pendingKey, check, 0); err != nil {
+			return err
+		}
+
+		for k, v := range sealed {
+			if err := store.backend.Set(stagedPrefix+k, v, 0); err != nil {
+				return errors.Wrapf(err, "can't write %s", k)
+			}
+		}
+
+		return store.backend.Set(checkKey, check, 0)
+	}
+
+	if err := stage(); err != nil {
+		store.discardStaged()
+		return 0, err
+	}
+
+	// The check key is replaced, so the store now opens with the new
+	// passphrase, which finishes the conversion if this fails.
+	store.pass = &newPassphrase
+	if err := store.moveStaged(); err != nil {
+		return 0, errors.Wrap(err, "can't move converted secrets into place (retried when the store is next opened)")
+	}
+
+	log.WithFields(log.Fields{"type": "store", "store": "encrypted"}).Debugf("converted %d secrets", len(sealed))
+	return len(sealed), nil
+}
+
+// Set encrypts v if k is a secret and encryption is enabled, and writes it
+// to the backend.
+func (store *Encrypted) Set(k string, v string, ttl time.Duration) error {
+	if IsSecretKey(k) && !IsEncryptedValue(v) && store.Enabled() {
+		store.mu.Lock()
+		pass, err := store.getPassphrase()
+		if err == nil {
+			v, err = store.seal(pass, v)
+		}
+		store.mu.Unlock()
+
+		if err != nil {
+			return errors.Wrapf(err, "can't encrypt %s", k)
+		}
+	}
+
+	return store.backend.Set(k, v, ttl)
+}
+
+// Get reads k from the backend, decrypting it if necessary.
+func (store *Encrypted) Get(k string) (string, error) {
+	v, err := store.backend.Get(k)
+	if err != nil || !IsEncryptedValue(v) {
+		return v, err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	pass, err := store.getPassphrase()
+	if err != nil {
+		return "", err
+	}
+
+	// Opening the store may have finished an interrupted conversion, which
+	// replaces v, so read it again.
+	v, err = store.backend.Get(k)
+	if err != nil || !IsEncryptedValue(v) {
+		return v, err
+	}
+
+	return store.open(pass, v)
+}
+
+// Decrypt decrypts v, a value read from the backend (e.g., by GetRaw, or from
+// another store with the same passphrase.) Values that aren't encrypted are
+// returned as-is.
+func (store *Encrypted) Decrypt(v string) (string, error) {
+	if !IsEncryptedValue(v) {
+		return v, nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	pass, err := store.getPassphrase()
+	if err != nil {
+		return "", err
+	}
+
+	return store.open(pass, v)
+}
+
+// Delete removes k from the backend.
+func (store *Encrypted) Delete(k string) error {
+	return store.backend.Delete(k)
+}
+
+// Keys returns all keys in the backend that start with prefix.
+func (store *Encrypted) Keys(prefix string) ([]string, error) {
+	return store.backend.Keys(prefix)
+}
+
+// Incr adds one to the integer in k in the backend. Counters aren't secrets.
+func (store *Encrypted) Incr(k string) (int64, error) {
+	return store.backend.Incr(k)
+}
+
+// ExpiresOn returns the time k expires in the backend.
+func (store *Encrypted) ExpiresOn(k string) (time.Time, error) {
+	return store.backend.ExpiresOn(k)
+}
+
+// deriveKey returns the AES key for pass and salt. Must be called under mu.
+func (store *Encrypted) deriveKey(pass string, salt []byte) []byte {
+	cacheKey := pass + string(salt)
+	if key, ok := store.keys[cacheKey]; ok {
+		return key
+	}
+
+	key := pbkdf2SHA256([]byte(pass), salt, kdfIterations, kdfKeyLen)
+	store.keys[cacheKey] = key
+	return key
+}
+
+// seal encrypts plaintext with AES-256-GCM. Must be called under mu.
+func (store *Encrypted) seal(pass string, plaintext string) (string, error) {
+	salt := make([]byte, kdfSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", errors.Wrap(err, "can't generate salt")
+	}
+
+	gcm, err := newGCM(store.deriveKey(pass, salt))
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "can't generate nonce")
+	}
+
+	data := append(salt, nonce...)
+	data = gcm.Seal(data, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// open decrypts a value created by seal. Must be called under mu.
+func (store *Encrypted) open(pass string, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, encryptedPrefix))
+	if err != nil || len(data) < kdfSaltLen {
+		return "", errors.Errorf("corrupt encrypted value")
+	}
+
+	salt := data[:kdfSaltLen]
+	gcm, err := newGCM(store.deriveKey(pass, salt))
+	if err != nil {
+		return "", err
+	}
+
+	data = data[kdfSaltLen:]
+	if len(data) < gcm.NonceSize() {
+		return "", errors.Errorf("corrupt encrypted value")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrBadPassphrase
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 2898) with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+
+	return dk[:keyLen]
+}
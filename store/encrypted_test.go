@@ -0,0 +1,176 @@
+package store
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTestEncryptedStore(backend API, pass string) *Encrypted {
+	return NewEncryptedStore(backend, func() (string, error) { return pass, nil })
+}
+
+func TestEncryptedStore_BasicLookup(t *testing.T) {
+	backend, _ := NewStore("internal", "")
+	testBasicLookup(t, newTestEncryptedStore(backend, "secret"))
+}
+
+func TestEncryptedStore_Seeds(t *testing.T) {
+	backend, _ := NewStore("internal", "")
+	store := newTestEncryptedStore(backend, "secret")
+
+	key := "default:account:mo:seed"
+	seed := "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU"
+
+	// Not enabled, so seeds are written in the clear.
+	store.Set(key, seed, 0)
+	if v, _ := backend.Get(key); v != seed {
+		t.Errorf("want plaintext seed in backend, got %v", v)
+	}
+
+	count, err := store.Convert([]string{key, "default:account:mo:address"}, "")
+	if err != nil || count != 1 {
+		t.Fatalf("convert failed: want 1 key, got %d (%v)", count, err)
+	}
+
+	if v, _ := backend.Get(key); !strings.HasPrefix(v, encryptedPrefix) {
+		t.Errorf("want encrypted seed in backend, got %v", v)
+	}
+
+	if v, err := store.Get(key); err != nil || v != seed {
+		t.Errorf("wrong decrypted seed: want %v, got %v (%v)", seed, v, err)
+	}
+
+	// Addresses and other values stay in the clear.
+	store.Set("default:account:mo:address", "GABC", 0)
+	if v, _ := backend.Get("default:account:mo:address"); v != "GABC" {
+		t.Errorf("want plaintext address in backend, got %v", v)
+	}
+
+	// New seeds are encrypted
+	store.Set("default:account:bob:seed", seed, 0)
+	if v, _ := backend.Get("default:account:bob:seed"); !IsEncryptedValue(v) {
+		t.Errorf("want encrypted seed in backend, got %v", v)
+	}
+
+	// Wrong passphrase
+	bad := newTestEncryptedStore(backend, "wrong")
+	if v, err := bad.Get(key); err == nil {
+		t.Errorf("want error with bad passphrase, got %v", v)
+	}
+
+	// Rekey
+	count, err = store.Convert([]string{key, "default:account:bob:seed"}, "new secret")
+	if err != nil || count != 2 {
+		t.Fatalf("rekey failed: want 2 keys, got %d (%v)", count, err)
+	}
+
+	if v, err := newTestEncryptedStore(backend, "new secret").Get(key); err != nil || v != seed {
+		t.Errorf("wrong seed after rekey: want %v, got %v (%v)", seed, v, err)
+	}
+
+	if _, err := newTestEncryptedStore(backend, "secret").Get(key); err == nil {
+		t.Errorf("want error with old passphrase")
+	}
+}
+
+func TestEncryptedStore_GetRaw(t *testing.T) {
+	backend, _ := NewStore("internal", "")
+	store := newTestEncryptedStore(backend, "secret")
+	store.Enable()
+	store.Set("default:account:mo:seed", "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU", 0)
+
+	if v, err := GetRaw(store, "default:account:mo:seed"); err != nil || !IsEncryptedValue(v) {
+		t.Errorf("GetRaw: want encrypted value, got %v, %v", v, err)
+	}
+
+	overlay := NewOverlayStore(store)
+	if v, err := GetRaw(overlay, "default:account:mo:seed"); err != nil || !IsEncryptedValue(v) {
+		t.Errorf("GetRaw through overlay: want encrypted value, got %v, %v", v, err)
+	}
+
+	overlay.Delete("default:account:mo:seed")
+	if _, err := GetRaw(overlay, "default:account:mo:seed"); err == nil {
+		t.Errorf("GetRaw of deleted key: want error")
+	}
+}
+
+// failingStore fails writes to keys for which fail returns true.
+type failingStore struct {
+	API
+	fail func(k string) bool
+}
+
+func (store *failingStore) Set(k string, v string, ttl time.Duration) error {
+	if store.fail(k) {
+		return errors.Errorf("can't write %s", k)
+	}
+
+	return store.API.Set(k, v, ttl)
+}
+
+func TestEncryptedStore_InterruptedRekey(t *testing.T) {
+	seed := "SBJ24KK6HWOF44MWFH3J7VPAGOMFOFO7O23YW6H37MYZU6F44JBYKLMU"
+	keys := []string{"default:account:bob:seed", "default:account:mo:seed", "default:account:sue:seed"}
+
+	for _, test := range []struct {
+		name string
+		fail func(k string) bool // fails writes to interrupt the rekey
+		pass string              // the passphrase that opens the store afterwards
+	}{
+		{"staging", func(k string) bool { return k == stagedPrefix+keys[1] }, "secret"},
+		{"check key", func(k string) bool { return k == checkKey }, "secret"},
+		{"moving", func(k string) bool { return k == keys[1] }, "new secret"},
+		{"moving first", func(k string) bool { return k == keys[0] }, "new secret"},
+	} {
+		backend, _ := NewStore("internal", "")
+		store := newTestEncryptedStore(backend, "secret")
+		store.Enable()
+		for _, k := range keys {
+			store.Set(k, seed, 0)
+		}
+
+		failing := &failingStore{API: backend, fail: test.fail}
+		if _, err := newTestEncryptedStore(failing, "secret").Convert(keys, "new secret"); err == nil {
+			t.Errorf("%s: want error", test.name)
+		}
+
+		// Every seed opens with one passphrase. Read the last key first: it's
+		// never moved before the failure, so it's stale until the store is
+		// opened.
+		reopened := newTestEncryptedStore(backend, test.pass)
+		for _, k := range []string{keys[2], keys[0], keys[1]} {
+			if v, err := reopened.Get(k); err != nil || v != seed {
+				t.Errorf("%s: wrong seed for %s: want %v, got %v (%v)", test.name, k, seed, v, err)
+			}
+		}
+
+		if staged, _ := backend.Keys(stagedPrefix); len(staged) != 0 {
+			t.Errorf("%s: want no staged keys, got %v", test.name, staged)
+		}
+	}
+}
+
+// Test vectors from RFC 7914 (section 11) and for PBKDF2-HMAC-SHA256 in the
+// style of RFC 6070.
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iter, keyLen   int
+		want           string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 40, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+	}
+
+	for _, test := range tests {
+		if got := hex.EncodeToString(pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iter, test.keyLen)); got != test.want {
+			t.Errorf("pbkdf2SHA256(%s, %s, %d, %d): want %s, got %s", test.password, test.salt, test.iter, test.keyLen, test.want, got)
+		}
+	}
+}
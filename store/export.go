@@ -0,0 +1,344 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportFormat and ExportVersion identify lumen export documents. Version 2
+// added expiry times to entries.
+const (
+	ExportFormat  = "lumen-export"
+	ExportVersion = 2
+)
+
+// Conflict policies for Import and Migrate.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// ExportEntry is a single key/value pair in an export. ExpiresOn is nil for
+// keys that never expire.
+type ExportEntry struct {
+	Key       string     `json:"key"`
+	Value     string     `json:"value"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+}
+
+// Export is a portable, versioned dump of a store. If Encrypted is set, the
+// entries are sealed in Payload and must be opened with Decrypt.
+type Export struct {
+	Format    string        `json:"format"`
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"created_at"`
+	Encrypted bool          `json:"encrypted"`
+	Entries   []ExportEntry `json:"entries,omitempty"`
+	Payload   string        `json:"payload,omitempty"`
+}
+
+// ExportOptions selects the keys to export, import, or migrate.
+type ExportOptions struct {
+	Namespaces []string // only keys in these namespaces (all if empty)
+	NoSecrets  bool     // exclude seeds
+	Exclude    []string // exclude keys with these prefixes
+
+	// Check, if set, is called with every key and value before an import or
+	// migration writes anything. An error aborts it.
+	Check func(k, v string) error
+}
+
+// expired returns true if e has expired since it was exported.
+func (e ExportEntry) expired() bool {
+	return e.ExpiresOn != nil && !time.Now().Before(*e.ExpiresOn)
+}
+
+// ttl returns the time left before e expires, or 0 if it never expires.
+func (e ExportEntry) ttl() time.Duration {
+	if e.ExpiresOn == nil {
+		return 0
+	}
+
+	// A ttl of 0 means forever, so keys that expire while they're being
+	// written get the shortest ttl instead.
+	if ttl := time.Until(*e.ExpiresOn); ttl > time.Millisecond {
+		return ttl
+	}
+
+	return time.Millisecond
+}
+
+// ImportStats reports what an import or migration did.
+type ImportStats struct {
+	Written   int `json:"written"`   // new or overwritten keys
+	Skipped   int `json:"skipped"`   // conflicting keys left alone
+	Unchanged int `json:"unchanged"` // keys that already had the same value
+}
+
+// include returns true if key k is selected by opts.
+func (opts ExportOptions) include(k string) bool {
+	// The check value, and any values staged by an interrupted Convert, are
+	// tied to this store's passphrase.
+	if strings.HasPrefix(k, cryptoPrefix) {
+		return false
+	}
+
+	if opts.NoSecrets && IsSecretKey(k) {
+		return false
+	}
+
+	for _, prefix := range opts.Exclude {
+		if strings.HasPrefix(k, prefix) {
+			return false
+		}
+	}
+
+	if len(opts.Namespaces) == 0 {
+		return true
+	}
+
+	ns := strings.SplitN(k, ":", 2)[0]
+	for _, n := range opts.Namespaces {
+		if n == ns {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readEntries reads all keys selected by opts from s, sorted by key.
+func readEntries(s API, opts ExportOptions) ([]ExportEntry, error) {
+	keys, err := s.Keys("")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't list keys")
+	}
+	sort.Strings(keys)
+
+	entries := []ExportEntry{}
+	for _, k := range keys {
+		if !opts.include(k) {
+			continue
+		}
+
+		v, err := s.Get(k)
+		var expiresOn time.Time
+		if err == nil {
+			expiresOn, err = s.ExpiresOn(k)
+		}
+
+		if err != nil {
+			// Expired or deleted since listing
+			log.WithFields(log.Fields{"type": "store", "method": "export"}).Debugf("skipping %s: %v", k, err)
+			continue
+		}
+
+		e := ExportEntry{Key: k, Value: v}
+		if !expiresOn.IsZero() {
+			expiresOn = expiresOn.UTC()
+			e.ExpiresOn = &expiresOn
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// writeEntries writes entries to s using the conflict policy. With ConflictFail,
+// nothing is written if any key conflicts, and nothing is written if check (if
+// set) returns an error for any entry.
+func writeEntries(s API, entries []ExportEntry, policy string, check func(k, v string) error) (ImportStats, error) {
+	stats := ImportStats{}
+
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return stats, errors.Errorf("bad conflict policy: %s, expecting: skip|overwrite|fail", policy)
+	}
+
+	pending := []ExportEntry{}
+	conflicts := []string{}
+	for _, e := range entries {
+		if e.expired() {
+			log.WithFields(log.Fields{"type": "store", "method": "import"}).Debugf("skipping expired key %s", e.Key)
+			continue
+		}
+
+		v, err := s.Get(e.Key)
+		switch {
+		case err != nil:
+			pending = append(pending, e)
+		case v == e.Value:
+			stats.Unchanged++
+		case policy == ConflictOverwrite:
+			pending = append(pending, e)
+		case policy == ConflictSkip:
+			stats.Skipped++
+		default:
+			conflicts = append(conflicts, e.Key)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return stats, errors.Errorf("%d conflicting keys: %s", len(conflicts), strings.Join(conflicts, ", "))
+	}
+
+	if check != nil {
+		for _, e := range pending {
+			if err := check(e.Key, e.Value); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	for _, e := range pending {
+		if err := s.Set(e.Key, e.Value, e.ttl()); err != nil {
+			return stats, errors.Wrapf(err, "can't write %s", e.Key)
+		}
+		stats.Written++
+	}
+
+	return stats, nil
+}
+
+// NewExport returns an export of all keys in s selected by opts.
+func NewExport(s API, opts ExportOptions) (*Export, error) {
+	entries, err := readEntries(s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		Format:    ExportFormat,
+		Version:   ExportVersion,
+		CreatedAt: time.Now().UTC(),
+		Entries:   entries,
+	}, nil
+}
+
+// ParseExport parses and validates an export document.
+func ParseExport(data []byte) (*Export, error) {
+	export := &Export{}
+	if err := json.Unmarshal(data, export); err != nil {
+		return nil, errors.Wrap(err, "can't parse export")
+	}
+
+	if export.Format != ExportFormat {
+		return nil, errors.Errorf("not a lumen export")
+	}
+
+	if export.Version > ExportVersion {
+		return nil, errors.Errorf("unsupported export version %d, upgrade lumen", export.Version)
+	}
+
+	return export, nil
+}
+
+// Encrypt seals the entries with pass.
+func (export *Export) Encrypt(pass string) error {
+	if export.Encrypted {
+		return errors.Errorf("export is already encrypted")
+	}
+
+	data, err := json.Marshal(export.Entries)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal entries")
+	}
+
+	sealer := NewEncryptedStore(nil, nil)
+	sealer.mu.Lock()
+	payload, err := sealer.seal(pass, string(data))
+	sealer.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	export.Encrypted = true
+	export.Entries = nil
+	export.Payload = payload
+	return nil
+}
+
+// Decrypt opens the entries sealed with pass.
+func (export *Export) Decrypt(pass string) error {
+	if !export.Encrypted {
+		return nil
+	}
+
+	sealer := NewEncryptedStore(nil, nil)
+	sealer.mu.Lock()
+	data, err := sealer.open(pass, export.Payload)
+	sealer.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	entries := []ExportEntry{}
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return errors.Wrap(err, "can't parse encrypted entries")
+	}
+
+	export.Encrypted = false
+	export.Entries = entries
+	export.Payload = ""
+	return nil
+}
+
+// Import writes the entries selected by opts into s. The export must be
+// decrypted first.
+func (export *Export) Import(s API, opts ExportOptions, policy string) (ImportStats, error) {
+	if export.Encrypted {
+		return ImportStats{}, errors.Errorf("export is encrypted")
+	}
+
+	entries := []ExportEntry{}
+	for _, e := range export.Entries {
+		if opts.include(e.Key) {
+			entries = append(entries, e)
+		}
+	}
+
+	return writeEntries(s, entries, policy, opts.Check)
+}
+
+// Migrate copies the keys selected by opts from one store to another, using
+// the conflict policy. Values are copied as-is, so encrypted seeds stay
+// encrypted with the same passphrase.
+func Migrate(from, to API, opts ExportOptions, policy string) (ImportStats, error) {
+	entries, err := readEntries(from, opts)
+	if err != nil {
+		return ImportStats{}, err
+	}
+
+	// Carry over the passphrase check value along with any encrypted values.
+	check := ""
+	for _, e := range entries {
+		if IsEncryptedValue(e.Value) {
+			check, _ = from.Get(checkKey)
+			break
+		}
+	}
+
+	if check != "" {
+		if current, err := to.Get(checkKey); err == nil && current != check {
+			return ImportStats{}, errors.Errorf("destination store is already encrypted, migrate to an unencrypted store")
+		}
+	}
+
+	stats, err := writeEntries(to, entries, policy, opts.Check)
+	if err != nil || check == "" {
+		return stats, err
+	}
+
+	if err := to.Set(checkKey, check, 0); err != nil {
+		return stats, errors.Wrap(err, "can't write passphrase check")
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func newTestExportStore(t *testing.T) API {
+	s, err := NewStore("internal", "")
+	if err != nil {
+		t.Fatalf("couldn't setup internal store: %v", err)
+	}
+
+	s.Set("global:ns", "team", 0)
+	s.Set("team:account:mo:address", "GADDRESS", 0)
+	s.Set("team:account:mo:seed", "SSEED", 0)
+	s.Set("other:asset:USD:code", "USD", 0)
+	return s
+}
+
+func TestExport_RoundTrip(t *testing.T) {
+	export, err := NewExport(newTestExportStore(t), ExportOptions{Namespaces: []string{"team"}, NoSecrets: true})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	if len(export.Entries) != 1 || export.Entries[0].Key != "team:account:mo:address" {
+		t.Fatalf("wrong entries: %+v", export.Entries)
+	}
+
+	data, _ := json.Marshal(export)
+	export, err = ParseExport(data)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	dest, _ := NewStore("internal", "")
+	stats, err := export.Import(dest, ExportOptions{}, ConflictSkip)
+	if err != nil || stats.Written != 1 {
+		t.Fatalf("import failed: %+v, %v", stats, err)
+	}
+
+	if v, _ := dest.Get("team:account:mo:address"); v != "GADDRESS" {
+		t.Errorf("wrong value: want GADDRESS, got %v", v)
+	}
+
+	if _, err := ParseExport([]byte(`{"format":"other"}`)); err == nil {
+		t.Errorf("want error parsing foreign document")
+	}
+}
+
+func TestExport_Expiry(t *testing.T) {
+	s := newTestExportStore(t)
+	s.Set("team:spending:native:1", "100", time.Hour)
+
+	export, _ := NewExport(s, ExportOptions{Namespaces: []string{"team"}})
+	data, _ := json.Marshal(export)
+	export, _ = ParseExport(data)
+
+	dest, _ := NewStore("internal", "")
+	if _, err := export.Import(dest, ExportOptions{}, ConflictSkip); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	if e, err := dest.ExpiresOn("team:account:mo:address"); err != nil || !e.IsZero() {
+		t.Errorf("address: want no expiry, got %v, %v", e, err)
+	}
+
+	e, err := dest.ExpiresOn("team:spending:native:1")
+	if err != nil || time.Until(e) < 59*time.Minute || time.Until(e) > time.Hour {
+		t.Errorf("spending record: want expiry in an hour, got %v, %v", e, err)
+	}
+
+	// Keys that expired after the export was made aren't imported.
+	past := time.Now().Add(-time.Minute)
+	export.Entries = []ExportEntry{{Key: "team:spending:native:2", Value: "5", ExpiresOn: &past}}
+	stats, err := export.Import(dest, ExportOptions{}, ConflictSkip)
+	if err != nil || stats.Written != 0 {
+		t.Errorf("import of expired key: want nothing written, got %+v, %v", stats, err)
+	}
+
+	// Migrations keep expiry times too.
+	dest, _ = NewStore("internal", "")
+	if _, err := Migrate(s, dest, ExportOptions{}, ConflictSkip); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	if e, err := dest.ExpiresOn("team:spending:native:1"); err != nil || e.IsZero() {
+		t.Errorf("migrated spending record: want expiry, got %v, %v", e, err)
+	}
+}
+
+func TestExport_Check(t *testing.T) {
+	export, _ := NewExport(newTestExportStore(t), ExportOptions{})
+
+	reject := func(k, v string) error {
+		if IsSecretKey(k) {
+			return errors.Errorf("no seeds")
+		}
+		return nil
+	}
+
+	dest, _ := NewStore("internal", "")
+	if _, err := export.Import(dest, ExportOptions{Check: reject}, ConflictSkip); err == nil {
+		t.Fatalf("want error importing rejected key")
+	}
+
+	if keys, _ := dest.Keys(""); len(keys) != 0 {
+		t.Errorf("want nothing imported, got %v", keys)
+	}
+
+	if stats, err := export.Import(dest, ExportOptions{NoSecrets: true, Check: reject}, ConflictSkip); err != nil || stats.Written != 3 {
+		t.Errorf("import without seeds: got %+v, %v", stats, err)
+	}
+}
+
+func TestExport_Encrypted(t *testing.T) {
+	export, _ := NewExport(newTestExportStore(t), ExportOptions{})
+	if err := export.Encrypt("secret"); err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	if len(export.Entries) != 0 || !IsEncryptedValue(export.Payload) {
+		t.Fatalf("entries not sealed: %+v", export)
+	}
+
+	dest, _ := NewStore("internal", "")
+	if _, err := export.Import(dest, ExportOptions{}, ConflictSkip); err == nil {
+		t.Errorf("want error importing encrypted export")
+	}
+
+	if err := export.Decrypt("wrong"); err != ErrBadPassphrase {
+		t.Errorf("want ErrBadPassphrase, got %v", err)
+	}
+
+	if err := export.Decrypt("secret"); err != nil || len(export.Entries) != 4 {
+		t.Errorf("decrypt failed: %v, %+v", err, export.Entries)
+	}
+}
+
+func TestExport_Internal(t *testing.T) {
+	s := newTestExportStore(t)
+	s.Set(checkKey, "check", 0)
+	s.Set(pendingKey, "pending", 0)
+	s.Set(stagedPrefix+"team:account:mo:seed", "staged", 0)
+
+	export, _ := NewExport(s, ExportOptions{})
+	for _, e := range export.Entries {
+		if strings.HasPrefix(e.Key, cryptoPrefix) {
+			t.Errorf("internal key exported: %s", e.Key)
+		}
+	}
+
+	if len(export.Entries) != 4 {
+		t.Errorf("want 4 entries, got %+v", export.Entries)
+	}
+}
+
+func TestExport_Conflicts(t *testing.T) {
+	export, _ := NewExport(newTestExportStore(t), ExportOptions{Namespaces: []string{"team"}})
+
+	dest, _ := NewStore("internal", "")
+	dest.Set("team:account:mo:address", "GOTHER", 0)
+	dest.Set("team:account:mo:seed", "SSEED", 0)
+
+	if _, err := export.Import(dest, ExportOptions{}, ConflictFail); err == nil {
+		t.Errorf("want conflict error")
+	}
+
+	stats, err := export.Import(dest, ExportOptions{}, ConflictSkip)
+	if err != nil || stats.Written != 0 || stats.Skipped != 1 || stats.Unchanged != 1 {
+		t.Errorf("wrong skip stats: %+v, %v", stats, err)
+	}
+
+	stats, err = export.Import(dest, ExportOptions{}, ConflictOverwrite)
+	if err != nil || stats.Written != 1 || stats.Unchanged != 1 {
+		t.Errorf("wrong overwrite stats: %+v, %v", stats, err)
+	}
+
+	if v, _ := dest.Get("team:account:mo:address"); v != "GADDRESS" {
+		t.Errorf("not overwritten: want GADDRESS, got %v", v)
+	}
+
+	if _, err := export.Import(dest, ExportOptions{}, "merge"); err == nil {
+		t.Errorf("want error for bad policy")
+	}
+}
+
+func TestMigrate_Encrypted(t *testing.T) {
+	backend := newTestExportStore(t)
+	enc := NewEncryptedStore(backend, func() (string, error) { return "secret", nil })
+	if err := enc.Enable(); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	keys, _ := backend.Keys("")
+	enc.Convert(keys, "")
+
+	dest, _ := NewStore("internal", "")
+	stats, err := Migrate(backend, dest, ExportOptions{}, ConflictFail)
+	if err != nil || stats.Written != 4 {
+		t.Fatalf("migrate failed: %+v, %v", stats, err)
+	}
+
+	v, _ := dest.Get("team:account:mo:seed")
+	if !IsEncryptedValue(v) {
+		t.Errorf("seed not encrypted in destination: %v", v)
+	}
+
+	destEnc := NewEncryptedStore(dest, func() (string, error) { return "secret", nil })
+	if v, err := destEnc.Get("team:account:mo:seed"); err != nil || v != "SSEED" {
+		t.Errorf("can't read migrated seed: %v, %v", v, err)
+	}
+}
@@ -1,8 +1,25 @@
 package store
 
+// The file store keeps its data in an append-only log of JSON records, one
+// per line, after a header line:
+//
+//   {"version":"2","seq":41}
+//   {"seq":42,"op":"set","key":"default:account:mo:address","entry":{"value":"GA...","bool":true,...}}
+//   {"seq":43,"op":"del","key":"default:vars:foo"}
+//
+// Writes append a single record, and the log is periodically compacted into
+// one record per live (unexpired) key. Version "1" files, which are a single
+// JSON object with all the pairs, are migrated when the store is opened.
+
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +27,15 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	fileVersion = "2"
+
+	// The log is compacted once it has at least compactMinRecords records, and
+	// more than compactRatio records per live key.
+	compactMinRecords = 256
+	compactRatio      = 2
+)
+
 type fileEntry struct {
 	Value     string    `json:"value"`
 	NoExpire  bool      `json:"bool"`
@@ -20,6 +46,8 @@ func (e fileEntry) expired() bool {
 	return !e.NoExpire && time.Now().After(e.ExpiresOn)
 }
 
+// fileData is the in-memory state of the store. It's also the on-disk format
+// of version "1" files.
 type fileData struct {
 	Version string               `json:"version"`
 	Seq     uint64               `json:"seq"`
@@ -28,69 +56,132 @@ type fileData struct {
 
 func newFileData() *fileData {
 	return &fileData{
-		Version: "1",
+		Version: fileVersion,
 		Seq:     0,
 		Pairs:   make(map[string]fileEntry),
 	}
 }
 
-// newFileDataFromFile tries to load data from fileName, creating a
-// new file with empty data if it can't read it. Returns error if it
-// can't parse an existing file, or reads invalid data.
-func newFileDataFromFile(fileName string) (*fileData, error) {
-	fileData := newFileData()
+// fileHeader is the first line of a version "2" file.
+type fileHeader struct {
+	Version string `json:"version"`
+	Seq     uint64 `json:"seq"`
+}
 
-	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "new"}).Debugf("reading file: %s", fileName)
-	data, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "new"}).Debugf("read error: %v", err)
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "new"}).Infof("creating new file: %s", fileName)
-		return fileData, fileData.sync(fileName)
+// fileRecord is a single mutation in the log.
+type fileRecord struct {
+	Seq   uint64     `json:"seq"`
+	Op    string     `json:"op"` // "set" or "del"
+	Key   string     `json:"key"`
+	Entry *fileEntry `json:"entry,omitempty"`
+}
+
+// apply applies the record to data.
+func (data *fileData) apply(record fileRecord) {
+	switch record.Op {
+	case "set":
+		if record.Entry != nil {
+			data.Pairs[record.Key] = *record.Entry
+		}
+	case "del":
+		delete(data.Pairs, record.Key)
+	}
+
+	if record.Seq > data.Seq {
+		data.Seq = record.Seq
 	}
+}
 
-	err = json.Unmarshal(data, &fileData)
+// parseRecords applies all the complete lines in buf to data, and returns
+// the number of bytes and records consumed. A trailing partial line (from an
+// interrupted write) is left unconsumed.
+func (data *fileData) parseRecords(buf []byte) (int64, int, error) {
+	consumed := int64(0)
+	count := 0
 
-	if err != nil {
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "new"}).Errorf("parse error: %v", err)
-		return nil, errors.Errorf("invalid content in %s: %v", fileName, err)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := buf[:i]
+		buf = buf[i+1:]
+		consumed += int64(i + 1)
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var record fileRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return consumed, count, errors.Errorf("bad record at seq %d: %v", data.Seq, err)
+		}
+
+		data.apply(record)
+		count++
 	}
 
-	return fileData, nil
+	return consumed, count, nil
 }
 
-func (data *fileData) sync(fileName string) error {
-	jsonData, err := json.Marshal(*data)
-
+// writeFileAtomic writes data to a temporary file in the same directory as fileName,
+// then renames it over fileName, so readers never see a partially written file.
+func writeFileAtomic(fileName string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "sync"}).Errorf("marshaling error: %v", err)
-		return errors.Errorf("could not marshall json: %v", err)
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
 	}
 
-	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "sync"}).Debugf("writing to file: %s", fileName)
-	err = ioutil.WriteFile(fileName, jsonData, 0600)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "sync"}).Errorf("write error: %v", err)
-		return errors.Errorf("could not write to file: %v", err)
+		os.Remove(tmp.Name())
 	}
 
-	return nil
+	return err
+}
+
+func backupPath(fileName string) string {
+	return fileName + ".bak"
+}
+
+func lockPath(fileName string) string {
+	return fileName + ".lock"
 }
 
-// DataStore represents the conntection to the Google Cloud Datastore.
+// FileStore is a store backed by a log file. It's safe to use from multiple
+// processes at the same time: every operation takes an advisory lock on a
+// lock file next to the data file, and catches up with records written by
+// other processes before using the data.
 type FileStore struct {
 	*Store
 	path string
-	mu   *sync.RWMutex // protects data
-	data *fileData
+	mu   *sync.Mutex // protects everything below
+
+	data    *fileData
+	info    os.FileInfo // the file that data was loaded from
+	offset  int64       // bytes of the file consumed into data
+	records int         // records in the file
+	rewrite bool        // the file must be compacted before appending
 }
 
 func NewFileStore(path string) (*FileStore, error) {
-	fileData, err := newFileDataFromFile(path)
-
-	if err != nil {
-		return nil, errors.Wrap(err, "can't read or create file store")
-	}
-
 	// Try to connect
 	fileStore := &FileStore{
 		Store: &Store{
@@ -98,15 +189,296 @@ func NewFileStore(path string) (*FileStore, error) {
 			parameters: path,
 		},
 		path: path,
-		mu:   &sync.RWMutex{},
-		data: fileData,
+		mu:   &sync.Mutex{},
+		data: newFileData(),
+	}
+
+	fileStore.mu.Lock()
+	defer fileStore.mu.Unlock()
+
+	if err := fileStore.withLock(true, func() error { return nil }); err != nil {
+		return nil, errors.Wrap(err, "can't read or create file store")
 	}
+
 	return fileStore, nil
 }
 
-// sync must be called under mu
-func (fs *FileStore) sync() error {
-	return fs.data.sync(fs.path)
+// withLock locks the data file (exclusively, if the data is going to be modified),
+// catches up with the file, and calls f. Must be called under mu.
+func (fs *FileStore) withLock(exclusive bool, f func() error) error {
+	lock, err := os.OpenFile(lockPath(fs.path), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "can't open lock file")
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock, exclusive); err != nil {
+		return errors.Wrap(err, "can't lock file")
+	}
+	defer unlockFile(lock)
+
+	if err := fs.refresh(exclusive); err != nil {
+		return err
+	}
+
+	return f()
+}
+
+// refresh brings data up to date with the file. If exclusive is set, new
+// files are created, and old versions are migrated. Must be called with
+// the file lock held.
+func (fs *FileStore) refresh(exclusive bool) error {
+	info, err := os.Stat(fs.path)
+	if os.IsNotExist(err) {
+		fs.data = newFileData()
+		fs.info = nil
+		if !exclusive {
+			return nil
+		}
+
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "refresh"}).Infof("creating new file: %s", fs.path)
+		return fs.compact()
+	}
+
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+
+	if fs.info != nil && os.SameFile(fs.info, info) && info.Size() >= fs.offset && fs.data.Version == fileVersion {
+		if err := fs.readTail(); err != nil {
+			return err
+		}
+	} else if err := fs.load(); err != nil {
+		return err
+	}
+
+	if exclusive && (fs.data.Version != fileVersion || fs.rewrite) {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "refresh"}).Infof("migrating %s from version %s to %s", fs.path, fs.data.Version, fileVersion)
+		return fs.compact()
+	}
+
+	return nil
+}
+
+// load reads the entire file. Must be called with the file lock held.
+func (fs *FileStore) load() error {
+	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "load"}).Debugf("reading file: %s", fs.path)
+	file, err := os.Open(fs.path)
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+
+	buf, err := ioutil.ReadAll(file)
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+
+	invalid := func(err error) error {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "load"}).Errorf("parse error: %v", err)
+		return errors.Errorf("invalid content in %s (previous version in %s): %v", fs.path, backupPath(fs.path), err)
+	}
+
+	data := newFileData()
+	headerLen := bytes.IndexByte(buf, '\n')
+	if headerLen < 0 {
+		headerLen = len(buf)
+	}
+
+	var header fileHeader
+	if err := json.Unmarshal(buf[:headerLen], &header); err != nil {
+		// Hand-edited version "1" files may span multiple lines.
+		if err := json.Unmarshal(buf, &header); err != nil {
+			return invalid(err)
+		}
+	}
+
+	offset := int64(len(buf))
+	records := 0
+	rewrite := false
+
+	if header.Version == "1" || header.Version == "" {
+		// Legacy format: the whole file is one JSON object. Early files
+		// have no version.
+		if err := json.Unmarshal(buf, data); err != nil {
+			return invalid(err)
+		}
+
+		data.Version = "1"
+
+		if data.Pairs == nil {
+			data.Pairs = make(map[string]fileEntry)
+		}
+		records = len(data.Pairs)
+	} else if header.Version == fileVersion && headerLen == len(buf) {
+		// A header without a newline (e.g., edited by hand) has no records,
+		// and records can't be appended to it.
+		data.Seq = header.Seq
+		rewrite = true
+	} else if header.Version == fileVersion {
+		data.Seq = header.Seq
+		consumed, count, err := data.parseRecords(buf[headerLen+1:])
+		if err != nil {
+			return invalid(err)
+		}
+
+		offset = int64(headerLen+1) + consumed
+		records = count
+	} else {
+		return invalid(errors.Errorf("unsupported version: %s", header.Version))
+	}
+
+	fs.data = data
+	fs.info = info
+	fs.offset = offset
+	fs.records = records
+	fs.rewrite = rewrite
+	return nil
+}
+
+// readTail applies the records appended since the last read. Must be called
+// with the file lock held.
+func (fs *FileStore) readTail() error {
+	file, err := os.Open(fs.path)
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(fs.offset, io.SeekStart); err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+
+	buf, err := ioutil.ReadAll(file)
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+
+	consumed, count, err := fs.data.parseRecords(buf)
+	fs.offset += consumed
+	fs.records += count
+
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "readTail"}).Errorf("parse error: %v", err)
+		return errors.Errorf("invalid content in %s: %v", fs.path, err)
+	}
+
+	if count > 0 {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "readTail"}).Debugf("read %d new records", count)
+	}
+
+	return nil
+}
+
+// append writes record to the end of the log, and compacts the log if it's
+// too large. Must be called with the exclusive file lock held.
+func (fs *FileStore) append(record fileRecord) error {
+	fs.data.Seq++
+	record.Seq = fs.data.Seq
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "append"}).Errorf("marshaling error: %v", err)
+		return errors.Errorf("could not marshall json: %v", err)
+	}
+	line = append(line, '\n')
+
+	file, err := os.OpenFile(fs.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Errorf("could not write to file: %v", err)
+	}
+	defer file.Close()
+
+	// Drop any partial record left behind by an interrupted write.
+	if err := file.Truncate(fs.offset); err != nil {
+		return errors.Errorf("could not write to file: %v", err)
+	}
+
+	if _, err := file.Write(line); err != nil {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "append"}).Errorf("write error: %v", err)
+		return errors.Errorf("could not write to file: %v", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Errorf("could not write to file: %v", err)
+	}
+
+	fs.data.apply(record)
+	fs.offset += int64(len(line))
+	fs.records++
+
+	if fs.records >= compactMinRecords && fs.records > compactRatio*len(fs.data.Pairs) {
+		return fs.compact()
+	}
+
+	return nil
+}
+
+// compact rewrites the log with one record per live key, dropping expired
+// entries. The previous generation of the file is kept as a backup. Must be
+// called with the exclusive file lock held.
+func (fs *FileStore) compact() error {
+	for k, v := range fs.data.Pairs {
+		if v.expired() {
+			delete(fs.data.Pairs, k)
+		}
+	}
+
+	var buf bytes.Buffer
+	header, _ := json.Marshal(fileHeader{Version: fileVersion, Seq: fs.data.Seq})
+	buf.Write(header)
+	buf.WriteByte('\n')
+
+	for k, v := range fs.data.Pairs {
+		entry := v
+		line, err := json.Marshal(fileRecord{Seq: fs.data.Seq, Op: "set", Key: k, Entry: &entry})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"type": "filestore", "method": "compact"}).Errorf("marshaling error: %v", err)
+			return errors.Errorf("could not marshall json: %v", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	if previous, err := ioutil.ReadFile(fs.path); err == nil {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "compact"}).Debugf("backing up to file: %s", backupPath(fs.path))
+		if err := writeFileAtomic(backupPath(fs.path), previous); err != nil {
+			logrus.WithFields(logrus.Fields{"type": "filestore", "method": "compact"}).Errorf("backup error: %v", err)
+			return errors.Errorf("could not write backup file: %v", err)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "compact"}).Debugf("compacting %d records into %d in %s", fs.records, len(fs.data.Pairs), fs.path)
+	if err := writeFileAtomic(fs.path, buf.Bytes()); err != nil {
+		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "compact"}).Errorf("write error: %v", err)
+		return errors.Errorf("could not write to file: %v", err)
+	}
+
+	info, err := os.Stat(fs.path)
+	if err != nil {
+		return errors.Errorf("could not read %s: %v", fs.path, err)
+	}
+
+	fs.data.Version = fileVersion
+	fs.info = info
+	fs.offset = int64(buf.Len())
+	fs.records = len(fs.data.Pairs)
+	fs.rewrite = false
+	return nil
+}
+
+// Compact rewrites the data file, dropping overwritten, deleted, and
+// expired entries.
+func (fs *FileStore) Compact() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.withLock(true, fs.compact)
 }
 
 func (fs *FileStore) Set(k string, v string, ttl time.Duration) error {
@@ -114,21 +486,34 @@ func (fs *FileStore) Set(k string, v string, ttl time.Duration) error {
 	defer fs.mu.Unlock()
 
 	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "set", "key": k}).Debugf("writing val: %s (ttl: %v)", v, ttl)
-	fs.data.Pairs[k] = fileEntry{
-		Value:     v,
-		NoExpire:  ttl == 0,
-		ExpiresOn: time.Now().Add(ttl),
-	}
-
-	fs.data.Seq++
-	return fs.sync()
+	return fs.withLock(true, func() error {
+		return fs.append(fileRecord{
+			Op:  "set",
+			Key: k,
+			Entry: &fileEntry{
+				Value:     v,
+				NoExpire:  ttl == 0,
+				ExpiresOn: time.Now().Add(ttl),
+			},
+		})
+	})
 }
 
 func (fs *FileStore) Get(k string) (string, error) {
-	fs.mu.RLock()
-	defer fs.mu.RUnlock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var val fileEntry
+	var ok bool
+	err := fs.withLock(false, func() error {
+		val, ok = fs.data.Pairs[k]
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
 
-	val, ok := fs.data.Pairs[k]
 	if !ok || val.expired() {
 		logrus.WithFields(logrus.Fields{"type": "filestore", "method": "get", "key": k}).Debugf("not found, expired: %v", ok && val.expired())
 		return "", errors.Errorf("not found: %s", k)
@@ -138,11 +523,97 @@ func (fs *FileStore) Get(k string) (string, error) {
 	return val.Value, nil
 }
 
+// Keys returns all unexpired keys that start with prefix.
+func (fs *FileStore) Keys(prefix string) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	keys := []string{}
+	err := fs.withLock(false, func() error {
+		for k, v := range fs.data.Pairs {
+			if strings.HasPrefix(k, prefix) && !v.expired() {
+				keys = append(keys, k)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "keys"}).Debugf("found %d keys with prefix %s", len(keys), prefix)
+	return keys, nil
+}
+
+// Incr adds one to the integer in k, and returns the new value. The file
+// lock is held between reading and writing the value.
+func (fs *FileStore) Incr(k string) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n := int64(0)
+	err := fs.withLock(true, func() error {
+		if v, ok := fs.data.Pairs[k]; ok && !v.expired() {
+			var err error
+			if n, err = strconv.ParseInt(v.Value, 10, 64); err != nil {
+				return errors.Errorf("value for %s is not an integer: %s", k, v.Value)
+			}
+		}
+
+		n++
+		return fs.append(fileRecord{
+			Op:    "set",
+			Key:   k,
+			Entry: &fileEntry{Value: strconv.FormatInt(n, 10), NoExpire: true},
+		})
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "incr", "key": k}).Debugf("incremented to %d", n)
+	return n, nil
+}
+
+// ExpiresOn returns the time k expires, or the zero time if it never expires.
+func (fs *FileStore) ExpiresOn(k string) (time.Time, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var val fileEntry
+	var ok bool
+	err := fs.withLock(false, func() error {
+		val, ok = fs.data.Pairs[k]
+		return nil
+	})
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !ok || val.expired() {
+		return time.Time{}, errors.Errorf("not found: %s", k)
+	}
+
+	if val.NoExpire {
+		return time.Time{}, nil
+	}
+
+	return val.ExpiresOn, nil
+}
+
 func (fs *FileStore) Delete(k string) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
 	logrus.WithFields(logrus.Fields{"type": "filestore", "method": "delete", "key": k}).Debugf("deleting")
-	delete(fs.data.Pairs, k)
-	return fs.sync()
+	return fs.withLock(true, func() error {
+		if _, ok := fs.data.Pairs[k]; !ok {
+			return nil
+		}
+
+		return fs.append(fileRecord{Op: "del", Key: k})
+	})
 }
@@ -1,9 +1,13 @@
 package store
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +45,243 @@ func TestFileStore_TTL(t *testing.T) {
 
 	testTTL(t, store)
 }
+
+func TestFileStore_Keys(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewStore("file", tmpFile)
+
+	if err != nil {
+		t.Errorf("couldn't setup internal store, want %v, got %v", nil, err)
+	}
+
+	testKeys(t, store)
+}
+
+func TestFileStore_Incr(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewStore("file", tmpFile)
+
+	if err != nil {
+		t.Errorf("couldn't setup internal store, want %v, got %v", nil, err)
+	}
+
+	testIncr(t, store)
+}
+
+func TestFileStore_ExpiresOn(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	store, err := NewStore("file", tmpFile)
+
+	if err != nil {
+		t.Errorf("couldn't setup internal store, want %v, got %v", nil, err)
+	}
+
+	testExpiresOn(t, store)
+}
+
+const (
+	numWorkers       = 8
+	writesPerWorker  = 25
+	workerFileEnvVar = "LUMEN_TEST_FILESTORE"
+	workerIDEnvVar   = "LUMEN_TEST_FILESTORE_WORKER"
+)
+
+// TestFileStore_WorkerProcess is not a real test. It's run as a subprocess
+// by TestFileStore_MultiProcess.
+func TestFileStore_WorkerProcess(t *testing.T) {
+	path := os.Getenv(workerFileEnvVar)
+	if path == "" {
+		return
+	}
+
+	worker := os.Getenv(workerIDEnvVar)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("worker %s: can't open store: %v", worker, err)
+	}
+
+	for i := 0; i < writesPerWorker; i++ {
+		if err := store.Set(fmt.Sprintf("worker%s:%d", worker, i), worker, 0); err != nil {
+			t.Fatalf("worker %s: can't write: %v", worker, err)
+		}
+
+		if _, err := store.Incr("counter"); err != nil {
+			t.Fatalf("worker %s: can't increment: %v", worker, err)
+		}
+	}
+}
+
+func TestFileStore_MultiProcess(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	cmds := []*exec.Cmd{}
+	for i := 0; i < numWorkers; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=TestFileStore_WorkerProcess")
+		cmd.Env = append(os.Environ(), workerFileEnvVar+"="+tmpFile, workerIDEnvVar+"="+strconv.Itoa(i))
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("can't start worker: %v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("worker failed: %v", err)
+		}
+	}
+
+	store, err := NewFileStore(tmpFile)
+	if err != nil {
+		t.Fatalf("can't open store: %v", err)
+	}
+
+	keys, _ := store.Keys("worker")
+	if len(keys) != numWorkers*writesPerWorker {
+		t.Errorf("lost writes: want %d keys, got %d", numWorkers*writesPerWorker, len(keys))
+	}
+
+	if v, _ := store.Get("counter"); v != strconv.Itoa(numWorkers*writesPerWorker) {
+		t.Errorf("lost increments: want %d, got %s", numWorkers*writesPerWorker, v)
+	}
+}
+
+func TestFileStore_MigrateV1(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	v1 := `{"version":"1","seq":7,"pairs":{"global:ns":{"value":"test","bool":true,"expires_on":"2018-03-21T08:00:43Z"},` +
+		`"test:vars:old":{"value":"gone","bool":false,"expires_on":"2018-03-21T08:00:43Z"}}}`
+	ioutil.WriteFile(tmpFile, []byte(v1), 0600)
+
+	store, err := NewFileStore(tmpFile)
+	if err != nil {
+		t.Fatalf("can't open v1 store: %v", err)
+	}
+
+	if v, err := store.Get("global:ns"); err != nil || v != "test" {
+		t.Errorf("wrong value after migration: want test, got %v (%v)", v, err)
+	}
+
+	data, _ := ioutil.ReadFile(tmpFile)
+	if !strings.HasPrefix(string(data), `{"version":"2","seq":7}`+"\n") {
+		t.Errorf("file not migrated: %s", data)
+	}
+
+	if strings.Contains(string(data), "test:vars:old") {
+		t.Errorf("expired entry not purged: %s", data)
+	}
+
+	if backup, _ := ioutil.ReadFile(tmpFile + ".bak"); string(backup) != v1 {
+		t.Errorf("v1 file not backed up: %s", backup)
+	}
+}
+
+func TestFileStore_NoVersion(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	// Files written before versions were added are version "1".
+	ioutil.WriteFile(tmpFile, []byte(`{}`), 0600)
+
+	store, err := NewFileStore(tmpFile)
+	if err != nil {
+		t.Fatalf("can't open unversioned store: %v", err)
+	}
+
+	store.Set("foo", "bar", 0)
+	if v, err := store.Get("foo"); err != nil || v != "bar" {
+		t.Errorf("wrong value: want bar, got %v (%v)", v, err)
+	}
+}
+
+func TestFileStore_HeaderOnly(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	ioutil.WriteFile(tmpFile, []byte(`{"version":"2","seq":3}`), 0600)
+
+	store, err := NewFileStore(tmpFile)
+	if err != nil {
+		t.Fatalf("can't open store with only a header: %v", err)
+	}
+
+	if keys, _ := store.Keys(""); len(keys) != 0 {
+		t.Errorf("want no keys, got %v", keys)
+	}
+
+	store.Set("foo", "bar", 0)
+	other, err := NewFileStore(tmpFile)
+	if err != nil {
+		t.Fatalf("can't reopen store: %v", err)
+	}
+
+	if v, err := other.Get("foo"); err != nil || v != "bar" {
+		t.Errorf("wrong value: want bar, got %v (%v)", v, err)
+	}
+
+	if other.data.Seq != 4 {
+		t.Errorf("wrong seq: want 4, got %d", other.data.Seq)
+	}
+}
+
+func TestFileStore_Compaction(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	store, _ := NewFileStore(tmpFile)
+	for i := 0; i < compactMinRecords*2; i++ {
+		store.Set("foo", strconv.Itoa(i), 0)
+	}
+
+	data, _ := ioutil.ReadFile(tmpFile)
+	if lines := strings.Count(string(data), "\n"); lines > compactMinRecords {
+		t.Errorf("log not compacted: %d lines", lines)
+	}
+
+	// A second handle sees the latest value, and the same sequence number
+	other, _ := NewFileStore(tmpFile)
+	if v, _ := other.Get("foo"); v != strconv.Itoa(compactMinRecords*2-1) {
+		t.Errorf("wrong value after compaction: got %v", v)
+	}
+
+	if other.data.Seq != uint64(compactMinRecords*2) {
+		t.Errorf("wrong seq after compaction: want %d, got %d", compactMinRecords*2, other.data.Seq)
+	}
+}
+
+func TestFileStore_TornWrite(t *testing.T) {
+	tmpDir, tmpFile := getTempFile()
+	defer os.RemoveAll(tmpDir)
+
+	store, _ := NewFileStore(tmpFile)
+	store.Set("foo", "bar", 0)
+
+	// Simulate a crash in the middle of an append
+	f, _ := os.OpenFile(tmpFile, os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte(`{"seq":2,"op":"set","key":"ba`))
+	f.Close()
+
+	other, err := NewFileStore(tmpFile)
+	if err != nil {
+		t.Fatalf("can't open store with torn write: %v", err)
+	}
+
+	other.Set("baz", "qux", 0)
+	store.Set("quux", "corge", 0)
+
+	for k, want := range map[string]string{"foo": "bar", "baz": "qux", "quux": "corge"} {
+		if v, err := store.Get(k); v != want {
+			t.Errorf("wrong value for %s: want %v, got %v (%v)", k, want, v, err)
+		}
+	}
+}
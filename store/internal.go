@@ -4,6 +4,8 @@ package store
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -123,3 +125,53 @@ func (store *Internal) Delete(k string) error {
 
 	return fmt.Errorf("No value in store for key: %v", k)
 }
+
+// Incr adds one to the integer in k, and returns the new value.
+func (store *Internal) Incr(k string) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	n := int64(0)
+	if v, ok := store.entries[k]; ok && !v.expired() {
+		var err error
+		if n, err = strconv.ParseInt(v.value, 10, 64); err != nil {
+			return 0, fmt.Errorf("value for key %v is not an integer: %v", k, v.value)
+		}
+	}
+
+	n++
+	store.entries[k] = &entry{strconv.FormatInt(n, 10), time.Time{}, true}
+	return n, nil
+}
+
+// ExpiresOn returns the time k expires, or the zero time if it never expires.
+func (store *Internal) ExpiresOn(k string) (time.Time, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	v, ok := store.entries[k]
+	if !ok || v.expired() {
+		return time.Time{}, fmt.Errorf("No value in store for key: %v", k)
+	}
+
+	if v.noexpire {
+		return time.Time{}, nil
+	}
+
+	return v.expiresOn, nil
+}
+
+// Keys returns all unexpired keys that start with prefix.
+func (store *Internal) Keys(prefix string) ([]string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := []string{}
+	for k, v := range store.entries {
+		if strings.HasPrefix(k, prefix) && !v.expired() {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
@@ -21,3 +21,33 @@ func TestInternalStore_TTL(t *testing.T) {
 
 	testTTL(t, store)
 }
+
+func TestInternalStore_Keys(t *testing.T) {
+	store, err := NewStore("internal", "")
+
+	if err != nil {
+		t.Errorf("couldn't setup internal store, want %v, got %v", nil, err)
+	}
+
+	testKeys(t, store)
+}
+
+func TestInternalStore_Incr(t *testing.T) {
+	store, err := NewStore("internal", "")
+
+	if err != nil {
+		t.Errorf("couldn't setup internal store, want %v, got %v", nil, err)
+	}
+
+	testIncr(t, store)
+}
+
+func TestInternalStore_ExpiresOn(t *testing.T) {
+	store, err := NewStore("internal", "")
+
+	if err != nil {
+		t.Errorf("couldn't setup internal store, want %v, got %v", nil, err)
+	}
+
+	testExpiresOn(t, store)
+}
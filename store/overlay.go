@@ -0,0 +1,146 @@
+package store
+
+// Overlay is a copy-on-write view of another store. Changes are kept in
+// memory, and the underlying store is only read from. It's used for dry runs.
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Overlay is a store that keeps changes in memory, on top of a read-only base.
+type Overlay struct {
+	*Store
+	base    API
+	changes *Internal
+	mu      *sync.RWMutex   // protects deleted
+	deleted map[string]bool // keys deleted from base
+	incrMu  *sync.Mutex     // serializes Incr
+}
+
+// NewOverlayStore returns a store that reads from base, and never writes to it.
+func NewOverlayStore(base API) *Overlay {
+	changes, _ := NewInternalStore()
+
+	return &Overlay{
+		Store: &Store{
+			driver:     "overlay",
+			parameters: "",
+		},
+		base:    base,
+		changes: changes,
+		mu:      &sync.RWMutex{},
+		deleted: map[string]bool{},
+		incrMu:  &sync.Mutex{},
+	}
+}
+
+// Base returns the underlying store.
+func (store *Overlay) Base() API {
+	return store.base
+}
+
+// Set adds (or updates) an entry in the overlay. If 'ttl' is 0, the entry never expires
+func (store *Overlay) Set(k string, v string, ttl time.Duration) error {
+	store.mu.Lock()
+	delete(store.deleted, k)
+	store.mu.Unlock()
+
+	return store.changes.Set(k, v, ttl)
+}
+
+// Get looks up an entry in the overlay, and then in the base store.
+func (store *Overlay) Get(k string) (string, error) {
+	return store.get(k, API.Get)
+}
+
+// get looks up an entry in the overlay, and then in the base store with
+// baseGet.
+func (store *Overlay) get(k string, baseGet func(API, string) (string, error)) (string, error) {
+	if v, err := store.changes.Get(k); err == nil {
+		return v, nil
+	}
+
+	store.mu.RLock()
+	deleted := store.deleted[k]
+	store.mu.RUnlock()
+
+	if deleted {
+		return "", fmt.Errorf("No value in store for key: %v", k)
+	}
+
+	return baseGet(store.base, k)
+}
+
+// Delete hides an entry of the base store, and removes it from the overlay.
+func (store *Overlay) Delete(k string) error {
+	if _, err := store.Get(k); err != nil {
+		return err
+	}
+
+	store.changes.Delete(k)
+
+	store.mu.Lock()
+	store.deleted[k] = true
+	store.mu.Unlock()
+	return nil
+}
+
+// Incr adds one to the integer in k, in the overlay or the base store, and
+// keeps the result in the overlay.
+func (store *Overlay) Incr(k string) (int64, error) {
+	store.incrMu.Lock()
+	defer store.incrMu.Unlock()
+
+	n := int64(0)
+	if v, err := store.Get(k); err == nil {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, fmt.Errorf("value for key %v is not an integer: %v", k, v)
+		}
+	}
+
+	n++
+	return n, store.Set(k, strconv.FormatInt(n, 10), 0)
+}
+
+// ExpiresOn returns the time k expires, in the overlay or the base store.
+func (store *Overlay) ExpiresOn(k string) (time.Time, error) {
+	if t, err := store.changes.ExpiresOn(k); err == nil {
+		return t, nil
+	}
+
+	store.mu.RLock()
+	deleted := store.deleted[k]
+	store.mu.RUnlock()
+
+	if deleted {
+		return time.Time{}, fmt.Errorf("No value in store for key: %v", k)
+	}
+
+	return store.base.ExpiresOn(k)
+}
+
+// Keys returns all keys that start with prefix, in the overlay or the base store.
+func (store *Overlay) Keys(prefix string) ([]string, error) {
+	baseKeys, err := store.base.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	changedKeys, _ := store.changes.Keys(prefix)
+
+	keys := []string{}
+	seen := map[string]bool{}
+	store.mu.RLock()
+	for _, k := range append(changedKeys, baseKeys...) {
+		if !seen[k] && !store.deleted[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	store.mu.RUnlock()
+
+	return keys, nil
+}
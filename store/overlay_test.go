@@ -0,0 +1,88 @@
+package store
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestOverlayStore_BasicLookup(t *testing.T) {
+	base, _ := NewStore("internal", "")
+	testBasicLookup(t, NewOverlayStore(base))
+}
+
+func TestOverlayStore_TTL(t *testing.T) {
+	base, _ := NewStore("internal", "")
+	testTTL(t, NewOverlayStore(base))
+}
+
+func TestOverlayStore_Keys(t *testing.T) {
+	base, _ := NewStore("internal", "")
+	testKeys(t, NewOverlayStore(base))
+}
+
+func TestOverlayStore_ExpiresOn(t *testing.T) {
+	base, _ := NewStore("internal", "")
+	testExpiresOn(t, NewOverlayStore(base))
+}
+
+func TestOverlayStore_Incr(t *testing.T) {
+	base, _ := NewInternalStore()
+	base.Set("counter", "41", 0)
+
+	overlay := NewOverlayStore(base)
+	if n, err := overlay.Incr("counter"); err != nil || n != 42 {
+		t.Errorf("Incr: want 42, got %d, %v", n, err)
+	}
+
+	if v, _ := base.Get("counter"); v != "41" {
+		t.Errorf("Incr wrote to base: got %s", v)
+	}
+
+	testIncr(t, overlay)
+}
+
+func TestOverlayStore_CopyOnWrite(t *testing.T) {
+	base, _ := NewStore("internal", "")
+	base.Set("ns1:account:mo:address", "GA", 0)
+	base.Set("ns1:account:bob:address", "GB", 0)
+
+	store := NewOverlayStore(base)
+	store.Set("ns1:account:mo:address", "GC", 0)
+	store.Set("ns1:account:kelly:address", "GK", 0)
+
+	if err := store.Delete("ns1:account:bob:address"); err != nil {
+		t.Errorf("couldn't delete key in base: %v", err)
+	}
+
+	if err := store.Delete("ns1:account:nobody:address"); err == nil {
+		t.Errorf("deleted missing key: want error, got nil")
+	}
+
+	if v, _ := store.Get("ns1:account:mo:address"); v != "GC" {
+		t.Errorf("want changed value GC, got %v", v)
+	}
+
+	if v, err := store.Get("ns1:account:bob:address"); err == nil {
+		t.Errorf("want deleted key, got %v", v)
+	}
+
+	keys, _ := store.Keys("ns1:")
+	sort.Strings(keys)
+	want := []string{"ns1:account:kelly:address", "ns1:account:mo:address"}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("wrong keys: want %v, got %v", want, keys)
+	}
+
+	// The base store is untouched.
+	if v, _ := base.Get("ns1:account:mo:address"); v != "GA" {
+		t.Errorf("base changed: want GA, got %v", v)
+	}
+
+	if v, err := base.Get("ns1:account:bob:address"); err != nil || v != "GB" {
+		t.Errorf("base changed: want GB, got %v, %v", v, err)
+	}
+
+	if _, err := base.Get("ns1:account:kelly:address"); err == nil {
+		t.Errorf("base changed: want no kelly")
+	}
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	postgresDefaultTable  = "lumen_store"
+	postgresDefaultPrefix = "default"
+)
+
+// Postgres represents a PostgreSQL-based backing store. Keys are scoped by a
+// prefix, so several teams (or lumen installs) can share one table.
+type Postgres struct {
+	*Store
+	db     *sql.DB
+	table  string // quoted table name
+	prefix string
+}
+
+// parsePostgresParams extracts the lumen-specific "table" and "prefix" options
+// from dsn, and returns the remaining DSN for the driver. Both URL DSNs
+// (postgres://...?prefix=foo) and key/value DSNs (host=... prefix=foo) are
+// supported.
+func parsePostgresParams(dsn string) (connStr, table, prefix string, err error) {
+	table = postgresDefaultTable
+	prefix = postgresDefaultPrefix
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", "", "", errors.Wrap(err, "bad postgres URL")
+		}
+
+		q := u.Query()
+		if v := q.Get("table"); v != "" {
+			table = v
+		}
+		if v := q.Get("prefix"); v != "" {
+			prefix = v
+		}
+		q.Del("table")
+		q.Del("prefix")
+		u.RawQuery = q.Encode()
+
+		return u.String(), table, prefix, nil
+	}
+
+	params, err := parsePostgresKeyValues(dsn)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// The other options go to the driver as they were written.
+	rest := []string{}
+	for _, param := range params {
+		switch param.key {
+		case "table":
+			table = param.value
+		case "prefix":
+			prefix = param.value
+		default:
+			rest = append(rest, param.raw)
+		}
+	}
+
+	if len(rest) == len(params) {
+		return dsn, table, prefix, nil
+	}
+
+	return strings.Join(rest, " "), table, prefix, nil
+}
+
+// displayPostgresParams returns dsn without passwords.
+func displayPostgresParams(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "(bad postgres URL)"
+		}
+
+		if u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+
+		q := u.Query()
+		if q.Get("password") != "" || q.Get("sslpassword") != "" {
+			q.Del("password")
+			q.Del("sslpassword")
+			u.RawQuery = q.Encode()
+		}
+
+		return u.String()
+	}
+
+	params, err := parsePostgresKeyValues(dsn)
+	if err != nil {
+		return "(bad postgres DSN)"
+	}
+
+	rest := []string{}
+	for _, param := range params {
+		if param.key != "password" && param.key != "sslpassword" {
+			rest = append(rest, param.raw)
+		}
+	}
+
+	return strings.Join(rest, " ")
+}
+
+// postgresParam is an option in a key/value DSN. raw is the option as it
+// appears in the DSN, quotes and all.
+type postgresParam struct {
+	key, value, raw string
+}
+
+// isPostgresSpace returns true if c separates options in a key/value DSN.
+func isPostgresSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// parsePostgresKeyValues splits a key/value DSN into options, the way libpq
+// does: there can be spaces around "=", values can be single-quoted, and a
+// backslash escapes the next character.
+func parsePostgresKeyValues(dsn string) ([]postgresParam, error) {
+	params := []postgresParam{}
+	skipSpace := func(i int) int {
+		for i < len(dsn) && isPostgresSpace(dsn[i]) {
+			i++
+		}
+		return i
+	}
+
+	for i := skipSpace(0); i < len(dsn); i = skipSpace(i) {
+		start := i
+		for i < len(dsn) && dsn[i] != '=' && !isPostgresSpace(dsn[i]) {
+			i++
+		}
+		key := dsn[start:i]
+
+		if i = skipSpace(i); i >= len(dsn) || dsn[i] != '=' || key == "" {
+			return nil, errors.Errorf("bad postgres DSN: missing \"=\" after %q", key)
+		}
+		i = skipSpace(i + 1)
+
+		value := []byte{}
+		if i < len(dsn) && dsn[i] == '\'' {
+			closed := false
+			for i++; i < len(dsn) && !closed; i++ {
+				switch {
+				case dsn[i] == '\\' && i+1 < len(dsn):
+					i++
+					value = append(value, dsn[i])
+				case dsn[i] == '\'':
+					closed = true
+				default:
+					value = append(value, dsn[i])
+				}
+			}
+
+			if !closed {
+				return nil, errors.Errorf("bad postgres DSN: unterminated quoted value for %s", key)
+			}
+		} else {
+			for ; i < len(dsn) && !isPostgresSpace(dsn[i]); i++ {
+				if dsn[i] == '\\' && i+1 < len(dsn) {
+					i++
+				}
+				value = append(value, dsn[i])
+			}
+		}
+
+		params = append(params, postgresParam{key, string(value), dsn[start:i]})
+	}
+
+	return params, nil
+}
+
+// NewPostgresStore connects to the database in dsn and creates the store
+// table if it doesn't exist.
+func NewPostgresStore(dsn string) (*Postgres, error) {
+	connStr, table, prefix, err := parsePostgresParams(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{"type": "postgres"}).Infof("Connecting to postgres (table: %s, prefix: %s)", table, prefix)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open postgres database")
+	}
+
+	if err := db.Ping(); err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "ping"}).Infof("connection failed: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("can't reach postgres server: %v", err)
+	}
+
+	store := &Postgres{
+		Store: &Store{
+			driver:     "postgres",
+			parameters: dsn,
+		},
+		db:     db,
+		table:  pq.QuoteIdentifier(table),
+		prefix: prefix,
+	}
+
+	if err := store.createTable(table); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// createTable creates the store table and its expiry index, and purges
+// expired rows.
+func (store *Postgres) createTable(table string) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + store.table + ` (
+			prefix     TEXT NOT NULL,
+			key        TEXT NOT NULL,
+			value      TEXT NOT NULL,
+			expires_on TIMESTAMPTZ,
+			PRIMARY KEY (prefix, key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + pq.QuoteIdentifier(table+"_expires_on") +
+			` ON ` + store.table + ` (expires_on) WHERE expires_on IS NOT NULL`,
+		`DELETE FROM ` + store.table + ` WHERE expires_on <= now()`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := store.db.Exec(stmt); err != nil {
+			log.WithFields(log.Fields{"type": "postgres", "method": "create"}).Errorf("Exec: %v", err)
+			return errors.Wrapf(err, "can't create table %s", store.table)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the database connection.
+func (store *Postgres) Close() error {
+	return store.db.Close()
+}
+
+// Set upserts k. A ttl of 0 means the key never expires.
+func (store *Postgres) Set(k string, v string, ttl time.Duration) error {
+	var expiresOn interface{}
+	if ttl > 0 {
+		expiresOn = time.Now().Add(ttl)
+	}
+
+	_, err := store.db.Exec(`INSERT INTO `+store.table+` (prefix, key, value, expires_on)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (prefix, key) DO UPDATE SET value = EXCLUDED.value, expires_on = EXCLUDED.expires_on`,
+		store.prefix, k, v, expiresOn)
+
+	if err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "set"}).Errorf("Set: %v", err)
+	}
+	return err
+}
+
+// Get returns the value of k, or an error if it's missing or expired.
+func (store *Postgres) Get(k string) (string, error) {
+	var v string
+	err := store.db.QueryRow(`SELECT value FROM `+store.table+`
+		WHERE prefix = $1 AND key = $2 AND (expires_on IS NULL OR expires_on > now())`,
+		store.prefix, k).Scan(&v)
+
+	if err == sql.ErrNoRows {
+		return "", errors.Errorf("key not found: %s", k)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "get"}).Debugf("Get: %v", err)
+	}
+	return v, err
+}
+
+// Delete removes k. Deleting a missing key is not an error.
+func (store *Postgres) Delete(k string) error {
+	_, err := store.db.Exec(`DELETE FROM `+store.table+` WHERE prefix = $1 AND key = $2`, store.prefix, k)
+	if err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "delete"}).Errorf("Delete: %v", err)
+	}
+	return err
+}
+
+// Incr adds one to the integer in k, and returns the new value. The upsert
+// locks the row, so concurrent increments are serialized.
+func (store *Postgres) Incr(k string) (int64, error) {
+	var n int64
+	err := store.db.QueryRow(`INSERT INTO `+store.table+` AS t (prefix, key, value, expires_on)
+		VALUES ($1, $2, '1', NULL)
+		ON CONFLICT (prefix, key) DO UPDATE SET
+			value = CASE WHEN t.expires_on <= now() THEN '1' ELSE (t.value::bigint + 1)::text END,
+			expires_on = NULL
+		RETURNING value::bigint`,
+		store.prefix, k).Scan(&n)
+
+	if err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "incr"}).Errorf("Incr: %v", err)
+	}
+	return n, err
+}
+
+// ExpiresOn returns the time k expires, or the zero time if it never expires.
+func (store *Postgres) ExpiresOn(k string) (time.Time, error) {
+	var expiresOn pq.NullTime
+	err := store.db.QueryRow(`SELECT expires_on FROM `+store.table+`
+		WHERE prefix = $1 AND key = $2 AND (expires_on IS NULL OR expires_on > now())`,
+		store.prefix, k).Scan(&expiresOn)
+
+	if err == sql.ErrNoRows {
+		return time.Time{}, errors.Errorf("key not found: %s", k)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "expireson"}).Debugf("ExpiresOn: %v", err)
+		return time.Time{}, err
+	}
+
+	return expiresOn.Time, nil
+}
+
+// likeEscaper escapes the wildcard characters used by LIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Keys returns all unexpired keys that start with prefix.
+func (store *Postgres) Keys(prefix string) ([]string, error) {
+	rows, err := store.db.Query(`SELECT key FROM `+store.table+`
+		WHERE prefix = $1 AND key LIKE $2 ESCAPE '\' AND (expires_on IS NULL OR expires_on > now())`,
+		store.prefix, likeEscaper.Replace(prefix)+"%")
+
+	if err != nil {
+		log.WithFields(log.Fields{"type": "postgres", "method": "keys"}).Errorf("Query: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
@@ -0,0 +1,119 @@
+package store
+
+// Test Postgres Store
+//
+// Make sure postgres is running:
+// $ docker run -it -p 5432:5432 -e POSTGRES_HOST_AUTH_METHOD=trust postgres:alpine
+
+import (
+	"log"
+	"testing"
+)
+
+const testPostgresDSN = "postgres://postgres@localhost:5432/postgres?sslmode=disable&prefix=lumen_test"
+
+func TestPostgresStore_BasicLookup(t *testing.T) {
+	store, err := NewStore("postgres", testPostgresDSN)
+
+	if err != nil {
+		log.Printf("skipping tests: couldn't setup postgres store, want %v, got %v", nil, err)
+		return
+	}
+
+	testBasicLookup(t, store)
+}
+
+func TestPostgresStore_TTL(t *testing.T) {
+	store, err := NewStore("postgres", testPostgresDSN)
+
+	if err != nil {
+		log.Printf("skipping tests: couldn't setup postgres store, want %v, got %v", nil, err)
+		return
+	}
+
+	testTTL(t, store)
+}
+
+func TestPostgresStore_Keys(t *testing.T) {
+	store, err := NewStore("postgres", testPostgresDSN)
+
+	if err != nil {
+		log.Printf("skipping tests: couldn't setup postgres store, want %v, got %v", nil, err)
+		return
+	}
+
+	testKeys(t, store)
+}
+
+func TestPostgresStore_Incr(t *testing.T) {
+	store, err := NewStore("postgres", testPostgresDSN)
+
+	if err != nil {
+		log.Printf("skipping tests: couldn't setup postgres store, want %v, got %v", nil, err)
+		return
+	}
+
+	testIncr(t, store)
+}
+
+func TestPostgresStore_ExpiresOn(t *testing.T) {
+	store, err := NewStore("postgres", testPostgresDSN)
+
+	if err != nil {
+		log.Printf("skipping tests: couldn't setup postgres store, want %v, got %v", nil, err)
+		return
+	}
+
+	testExpiresOn(t, store)
+}
+
+func TestPostgresStore_Params(t *testing.T) {
+	tests := []struct {
+		dsn, connStr, table, prefix string
+	}{
+		{"postgres://u:p@db:5432/lumen?sslmode=disable", "postgres://u:p@db:5432/lumen?sslmode=disable", "lumen_store", "default"},
+		{"postgres://db/lumen?prefix=team1&table=aliases&sslmode=disable", "postgres://db/lumen?sslmode=disable", "aliases", "team1"},
+		{"host=db dbname=lumen prefix=team2 sslmode=disable", "host=db dbname=lumen sslmode=disable", "lumen_store", "team2"},
+		{"host=db password='a b' sslmode=disable", "host=db password='a b' sslmode=disable", "lumen_store", "default"},
+		{`host=db password='it\'s prefix=x' prefix=team3`, `host=db password='it\'s prefix=x'`, "lumen_store", "team3"},
+		{`host = db  table = 'my table' password=a\ b`, `host = db password=a\ b`, "my table", "default"},
+		{"prefix= host=db", "", "lumen_store", "host=db"},
+	}
+
+	for _, test := range tests {
+		connStr, table, prefix, err := parsePostgresParams(test.dsn)
+		if err != nil {
+			t.Fatalf("parsePostgresParams(%q): %v", test.dsn, err)
+		}
+
+		if connStr != test.connStr || table != test.table || prefix != test.prefix {
+			t.Errorf("parsePostgresParams(%q): want (%q, %q, %q), got (%q, %q, %q)",
+				test.dsn, test.connStr, test.table, test.prefix, connStr, table, prefix)
+		}
+	}
+
+	for _, dsn := range []string{"host=db password='a b", "host db", "=db"} {
+		if _, _, _, err := parsePostgresParams(dsn); err == nil {
+			t.Errorf("parsePostgresParams(%q): want error", dsn)
+		}
+	}
+}
+
+func TestDisplayParams(t *testing.T) {
+	tests := []struct {
+		driver, params, want string
+	}{
+		{"postgres", "postgres://u:secret@db:5432/lumen?sslmode=disable", "postgres://u@db:5432/lumen?sslmode=disable"},
+		{"postgres", "postgres://db/lumen?password=secret&prefix=team1", "postgres://db/lumen?prefix=team1"},
+		{"postgres", "host=db password='a secret' sslmode=disable", "host=db sslmode=disable"},
+		{"postgres", "host=db password='secret", "(bad postgres DSN)"},
+		{"redis", "redis://:secret@cache.example.com/3?prefix=team1", "redis://cache.example.com/3?prefix=team1"},
+		{"file", "/tmp/lumen.json", "/tmp/lumen.json"},
+	}
+
+	for _, test := range tests {
+		if got := DisplayParams(test.driver, test.params); got != test.want {
+			t.Errorf("DisplayParams(%s, %q): want %q, got %q", test.driver, test.params, test.want, got)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package store
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -15,23 +21,158 @@ type Redis struct {
 	prefix string // all redis keys are prefixed with this
 }
 
+// redisParams are the connection parameters parsed from a redis address.
+type redisParams struct {
+	options  *redis.Options         // for single-server connections
+	failover *redis.FailoverOptions // for sentinel connections
+	prefix   string
+	display  string // address with credentials removed, for logging
+}
+
+// parseRedisParams parses address, which can be one of:
+//
+//	host:port
+//	redis://[[user]:password@]host[:port][/db][?prefix=team1]
+//	rediss://[[user]:password@]host[:port][/db][?prefix=team1]  (TLS)
+//	redis-sentinel://[[user]:password@]host:port[,host:port...][/db]?master=name[&prefix=team1]
+func parseRedisParams(address string) (*redisParams, error) {
+	if !strings.Contains(address, "://") {
+		return &redisParams{
+			options: &redis.Options{Addr: address},
+			display: address,
+		}, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad redis URL")
+	}
+
+	var user, password string
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	db := 0
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil {
+			return nil, errors.Errorf("bad redis database number: %s", path)
+		}
+	}
+
+	params := &redisParams{}
+	var master string
+	for k, v := range u.Query() {
+		switch k {
+		case "prefix":
+			params.prefix = v[0]
+		case "master":
+			master = v[0]
+		default:
+			return nil, errors.Errorf("unknown redis option: %s", k)
+		}
+	}
+
+	hosts := strings.Split(u.Host, ",")
+	for i, host := range hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			hosts[i] = net.JoinHostPort(host, "6379")
+		}
+	}
+
+	// Redis 6 ACL users need "AUTH user password", which must run before SELECT.
+	var onConnect func(*redis.Conn) error
+	if user != "" {
+		authDB := db
+		onConnect = func(conn *redis.Conn) error {
+			if err := conn.Process(redis.NewStatusCmd("auth", user, password)); err != nil {
+				return err
+			}
+			if authDB > 0 {
+				return conn.Select(authDB).Err()
+			}
+			return nil
+		}
+		password = ""
+		db = 0
+	}
+
+	u.User = nil
+	params.display = u.String()
+
+	switch u.Scheme {
+	case "redis", "rediss":
+		if len(hosts) != 1 {
+			return nil, errors.Errorf("multiple hosts are only supported with redis-sentinel://")
+		}
+
+		params.options = &redis.Options{
+			Addr:      hosts[0],
+			Password:  password,
+			DB:        db,
+			OnConnect: onConnect,
+		}
+
+		if u.Scheme == "rediss" {
+			host, _, _ := net.SplitHostPort(hosts[0])
+			params.options.TLSConfig = &tls.Config{ServerName: host}
+		}
+	case "redis-sentinel":
+		if master == "" {
+			return nil, errors.Errorf("redis-sentinel:// requires a master name, e.g., ?master=mymaster")
+		}
+
+		params.failover = &redis.FailoverOptions{
+			MasterName:    master,
+			SentinelAddrs: hosts,
+			Password:      password,
+			DB:            db,
+			OnConnect:     onConnect,
+		}
+	default:
+		return nil, errors.Errorf("bad redis URL scheme: %s", u.Scheme)
+	}
+
+	return params, nil
+}
+
+// NewRedisStore connects to the redis server at address. See parseRedisParams
+// for the supported address formats.
 func NewRedisStore(address string) (*Redis, error) {
+	params, err := parseRedisParams(address)
+	if err != nil {
+		return nil, err
+	}
+
 	// Try to connect
-	log.WithFields(log.Fields{"type": "redis"}).Infof("Connecting to redis at %v", address)
-	client := redis.NewClient(&redis.Options{Addr: address})
+	log.WithFields(log.Fields{"type": "redis"}).Infof("Connecting to redis at %v", params.display)
+	var client *redis.Client
+	if params.failover != nil {
+		client = redis.NewFailoverClient(params.failover)
+	} else {
+		client = redis.NewClient(params.options)
+	}
 
 	if err := client.Ping().Err(); err != nil {
-		log.WithFields(log.Fields{"type": "redis", "method": "ping"}).Infof("connection failed:", err)
-		return nil, fmt.Errorf("can't reach redis server at %s: %v", address, err)
+		log.WithFields(log.Fields{"type": "redis", "method": "ping"}).Infof("connection failed: %v", err)
+		client.Close()
+		return nil, fmt.Errorf("can't reach redis server at %s: %v", params.display, err)
 	}
 
-	return &Redis{
+	store := &Redis{
 		Store: &Store{
 			driver:     "redis",
 			parameters: address,
 		},
 		client: client,
-	}, nil
+	}
+
+	if params.prefix != "" {
+		store.WithPrefix(params.prefix)
+	}
+
+	return store, nil
 }
 
 func (store *Redis) WithPrefix(prefix string) *Redis {
@@ -62,3 +203,53 @@ func (store *Redis) Delete(k string) error {
 	}
 	return err
 }
+
+// Incr adds one to the integer in k with INCR, and returns the new value.
+func (store *Redis) Incr(k string) (int64, error) {
+	n, err := store.client.Incr(store.prefix + k).Result()
+	if err != nil {
+		log.WithFields(log.Fields{"type": "redis", "method": "incr"}).Errorf("Incr: %v", err)
+	}
+	return n, err
+}
+
+// ExpiresOn returns the time k expires, using PTTL.
+func (store *Redis) ExpiresOn(k string) (time.Time, error) {
+	ttl, err := store.client.PTTL(store.prefix + k).Result()
+	if err != nil {
+		log.WithFields(log.Fields{"type": "redis", "method": "expireson"}).Errorf("PTTL: %v", err)
+		return time.Time{}, err
+	}
+
+	// PTTL returns -2 for missing keys, and -1 for keys that never expire.
+	switch {
+	case ttl == -2*time.Millisecond:
+		return time.Time{}, redis.Nil
+	case ttl < 0:
+		return time.Time{}, nil
+	}
+
+	return time.Now().Add(ttl), nil
+}
+
+// globEscaper escapes the glob characters used by the SCAN MATCH option.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// Keys returns all keys that start with prefix, using SCAN so that large
+// databases don't block the server.
+func (store *Redis) Keys(prefix string) ([]string, error) {
+	match := globEscaper.Replace(store.prefix+prefix) + "*"
+	keys := []string{}
+
+	iter := store.client.Scan(0, match, 100).Iterator()
+	for iter.Next() {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), store.prefix))
+	}
+
+	if err := iter.Err(); err != nil {
+		log.WithFields(log.Fields{"type": "redis", "method": "keys"}).Errorf("Scan: %v", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
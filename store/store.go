@@ -12,9 +12,22 @@ type API interface {
 	Set(k string, v string, ttl time.Duration) error
 	Get(k string) (string, error)
 	Delete(k string) error
+
+	// Keys returns all unexpired keys that start with prefix, in no
+	// particular order.
+	Keys(prefix string) ([]string, error)
+
+	// Incr adds one to the integer in k (zero if k isn't set), and returns
+	// the new value. The key never expires. It's atomic, even when the store
+	// is shared by several processes, so it can hand out sequence numbers.
+	Incr(k string) (int64, error)
+
+	// ExpiresOn returns the time k expires, or the zero time if it never
+	// expires. It returns an error if k isn't set.
+	ExpiresOn(k string) (time.Time, error)
 }
 
-// Store represents the storage backend. Currently, only "internal" and "redis" are supported.
+// Store represents the storage backend. Supported drivers are "internal", "file", "redis" and "postgres".
 type Store struct {
 	driver     string
 	parameters string
@@ -25,6 +38,8 @@ func NewStore(driver, parameters string) (API, error) {
 	case "redis":
 		store, err := NewRedisStore(parameters)
 		return store, err
+	case "postgres":
+		return NewPostgresStore(parameters)
 	case "internal":
 		return NewInternalStore()
 	case "file":
@@ -36,6 +51,24 @@ func NewStore(driver, parameters string) (API, error) {
 	return nil, errors.Errorf("Driver not found: %s", driver)
 }
 
+// DisplayParams returns the parameters for driver with credentials (e.g., the
+// passwords in redis URLs and postgres DSNs) removed, so they can be shown or
+// logged.
+func DisplayParams(driver, parameters string) string {
+	switch driver {
+	case "redis":
+		params, err := parseRedisParams(parameters)
+		if err != nil {
+			return "(bad redis address)"
+		}
+		return params.display
+	case "postgres":
+		return displayPostgresParams(parameters)
+	}
+
+	return parameters
+}
+
 type DummyStore struct {
 	store *Store
 }
@@ -53,3 +86,15 @@ func (store *DummyStore) Get(k string) (string, error) {
 func (store *DummyStore) Delete(k string) error {
 	return errors.Errorf("Dummy store stores nothing!")
 }
+
+func (store *DummyStore) Keys(prefix string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (store *DummyStore) Incr(k string) (int64, error) {
+	return 0, errors.Errorf("Dummy store stores nothing!")
+}
+
+func (store *DummyStore) ExpiresOn(k string) (time.Time, error) {
+	return time.Time{}, errors.Errorf("Dummy store stores nothing!")
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"sort"
 	"testing"
 	"time"
 )
@@ -51,3 +52,78 @@ func testTTL(t *testing.T, store API) {
 
 	store.Delete("mo")
 }
+
+func testKeys(t *testing.T, store API) {
+	store.Set("ns1:account:mo:address", "GA", 0)
+	store.Set("ns1:account:mo:seed", "SA", 0)
+	store.Set("ns1:asset:USD:code", "USD", 0)
+	store.Set("ns2:account:bob:address", "GB", 0)
+	store.Set("ns1:account:expired:address", "GC", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	keys, err := store.Keys("ns1:account:")
+	if err != nil {
+		t.Fatalf("couldn't list keys: %v", err)
+	}
+
+	sort.Strings(keys)
+	want := []string{"ns1:account:mo:address", "ns1:account:mo:seed"}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("wrong keys: want %v, got %v", want, keys)
+	}
+
+	keys, _ = store.Keys("ns3:")
+	if len(keys) != 0 {
+		t.Errorf("wrong keys: want none, got %v", keys)
+	}
+
+	for _, k := range []string{"ns1:account:mo:address", "ns1:account:mo:seed", "ns1:asset:USD:code", "ns2:account:bob:address"} {
+		store.Delete(k)
+	}
+}
+
+func testIncr(t *testing.T, store API) {
+	store.Delete("counter")
+	for want := int64(1); want <= 3; want++ {
+		if n, err := store.Incr("counter"); err != nil || n != want {
+			t.Errorf("Incr: want %d, got %d, %v", want, n, err)
+		}
+	}
+
+	if v, err := store.Get("counter"); err != nil || v != "3" {
+		t.Errorf("counter: want 3, got %q, %v", v, err)
+	}
+
+	store.Set("counter", "bar", 0)
+	if _, err := store.Incr("counter"); err == nil {
+		t.Errorf("Incr of non-integer: want error")
+	}
+
+	store.Delete("counter")
+}
+
+func testExpiresOn(t *testing.T, store API) {
+	store.Set("forever", "bar", 0)
+	if e, err := store.ExpiresOn("forever"); err != nil || !e.IsZero() {
+		t.Errorf("ExpiresOn: want zero time, got %v, %v", e, err)
+	}
+
+	want := time.Now().Add(time.Hour)
+	store.Set("later", "bar", time.Hour)
+	if e, err := store.ExpiresOn("later"); err != nil || e.Sub(want) > time.Second || want.Sub(e) > time.Second {
+		t.Errorf("ExpiresOn: want %v, got %v, %v", want, e, err)
+	}
+
+	store.Set("gone", "bar", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := store.ExpiresOn("gone"); err == nil {
+		t.Errorf("ExpiresOn of expired key: want error")
+	}
+
+	if _, err := store.ExpiresOn("missing"); err == nil {
+		t.Errorf("ExpiresOn of missing key: want error")
+	}
+
+	store.Delete("forever")
+	store.Delete("later")
+}